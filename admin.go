@@ -0,0 +1,164 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"sync/atomic"
+)
+
+/**
+ * 管理服务
+ *
+ * 可选的内置服务 Admin，通过 tiny-rpc 本身管理运行中的服务器：
+ *   Admin.Drain            开始/停止排空：拒绝新连接和新请求，正在处理的请求正常完成
+ *   Admin.SetClientLimit   调整每个客户端的在途请求上限（需要先 SetClientLimit 开启）
+ *   Admin.SetMaxInflight   调整过载保护的在途请求上限（需要先 SetLoadShedding 开启）
+ *   Admin.SetDebug         开关调试日志，打开后记录每个请求
+ *   Admin.Stats            服务器统计
+ *   Admin.Connections      列出连接
+ *   Admin.CloseConnection  关闭一个连接
+ *   Admin.Unregister       注销服务
+ * 调用时需要在元数据 AdminTokenMeta 中带上注册时的 token：
+ *   client.Call("Admin.Drain", true, &ok, geerpc.WithMetadata(geerpc.AdminTokenMeta, token))
+ */
+
+const (
+	AdminServiceName = "Admin"
+	AdminTokenMeta   = "admin-token"
+)
+
+var (
+	ErrAdminUnauthorized = errors.New("rpc admin: unauthorized")
+	ErrServerDraining    = errors.New("rpc server: server is draining")
+)
+
+type adminService struct {
+	server *Server
+	token  string
+}
+
+// 注册管理服务，token 不能为空
+func (server *Server) RegisterAdmin(token string) error {
+	if token == "" {
+		return errors.New("rpc admin: token must not be empty")
+	}
+	return server.RegisterName(AdminServiceName, &adminService{server: server, token: token})
+}
+
+func (a *adminService) auth(ctx context.Context) error {
+	got := MetadataFromContext(ctx)[AdminTokenMeta]
+	if subtle.ConstantTimeCompare([]byte(got), []byte(a.token)) != 1 {
+		return ErrAdminUnauthorized
+	}
+	return nil
+}
+
+func (a *adminService) Drain(ctx context.Context, drain bool, reply *bool) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	*reply = a.server.setDraining(drain)
+	a.server.logf("rpc admin: draining %v", drain)
+	return nil
+}
+
+// 返回之前的上限
+func (a *adminService) SetClientLimit(ctx context.Context, max int, reply *int) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	if a.server.clientLimit == nil {
+		return errors.New("rpc admin: client limit is not enabled")
+	}
+	*reply = a.server.clientLimit.setMax(max)
+	return nil
+}
+
+// 返回之前的上限
+func (a *adminService) SetMaxInflight(ctx context.Context, max int, reply *int) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	if a.server.shed == nil {
+		return errors.New("rpc admin: load shedding is not enabled")
+	}
+	*reply = a.server.shed.setMaxInflight(max)
+	return nil
+}
+
+func (a *adminService) SetDebug(ctx context.Context, on bool, reply *bool) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	*reply = a.server.SetDebug(on)
+	return nil
+}
+
+func (a *adminService) Stats(ctx context.Context, _ int, reply *ServerStats) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	*reply = a.server.Stats()
+	return nil
+}
+
+func (a *adminService) Connections(ctx context.Context, _ int, reply *[]ConnInfo) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	*reply = a.server.Connections()
+	return nil
+}
+
+func (a *adminService) CloseConnection(ctx context.Context, id uint64, reply *bool) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	if err := a.server.CloseConnection(id); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// 不能注销管理服务自己
+func (a *adminService) Unregister(ctx context.Context, name string, reply *bool) error {
+	if err := a.auth(ctx); err != nil {
+		return err
+	}
+	if name == AdminServiceName {
+		return errors.New("rpc admin: can't unregister the admin service")
+	}
+	if err := a.server.Unregister(name); err != nil {
+		return err
+	}
+	*reply = true
+	return nil
+}
+
+// 设置排空状态，返回之前的状态
+func (server *Server) setDraining(drain bool) bool {
+	var v int32
+	if drain {
+		v = 1
+	}
+	return atomic.SwapInt32(&server.draining, v) == 1
+}
+
+func (server *Server) isDraining() bool {
+	return atomic.LoadInt32(&server.draining) == 1
+}
+
+// 开关调试日志，返回之前的状态
+func (server *Server) SetDebug(on bool) bool {
+	var v int32
+	if on {
+		v = 1
+	}
+	return atomic.SwapInt32(&server.debug, v) == 1
+}
+
+func (server *Server) isDebug() bool {
+	return atomic.LoadInt32(&server.debug) == 1
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"geerpc"
+	"log"
+	"time"
+)
+
+/**
+ * 请求审计
+ *
+ * 审计拦截器为每次调用记录一条 Record：谁（客户端标识、对端地址、TLS 证书、应用自定义的身份）、
+ * 调用了什么（方法和参数摘要）、什么时候、结果如何，写入一个或多个 Sink：
+ *   f, _ := audit.NewFileSink("/var/log/rpc-audit.log")
+ *   server.Use(audit.Interceptor(audit.Options{
+ *       Sinks:    []audit.Sink{f, audit.SinkFunc(sendToSIEM)},
+ *       Identity: func(ctx context.Context) string { return userOf(geerpc.AuthTokenFromContext(ctx)) },
+ *       Filter:   func(serviceMethod string) bool { return !strings.HasPrefix(serviceMethod, "Health.") },
+ *   }))
+ * 参数只记录 JSON 编码后的 SHA-256 摘要，不记录内容，避免敏感数据进入审计日志；
+ * 需要核对时对同样的参数计算摘要比较
+ * 记录在服务方法返回后同步写入，写入失败不影响调用的结果，只交给 OnError
+ * 内置的 Sink：NewWriterSink、NewFileSink（每行一个 JSON）、NewSyslogSink、SinkFunc
+ */
+
+type Record struct {
+	Time          time.Time     `json:"time"` //开始处理的时间
+	ServiceMethod string        `json:"serviceMethod"`
+	ClientID      string        `json:"clientID,omitempty"`
+	SessionID     string        `json:"sessionID,omitempty"`
+	Peer          string        `json:"peer,omitempty"`     //对端地址
+	PeerCert      string        `json:"peerCert,omitempty"` //TLS 客户端证书的 Subject
+	Identity      string        `json:"identity,omitempty"` //Options.Identity 返回的身份
+	Tenant        string        `json:"tenant,omitempty"`
+	RequestID     string        `json:"requestID,omitempty"`
+	ArgsDigest    string        `json:"argsDigest,omitempty"` //参数 JSON 编码后的 SHA-256，十六进制
+	Duration      time.Duration `json:"duration"`
+	Code          string        `json:"code"` //结果，见 Code
+	Error         string        `json:"error,omitempty"`
+}
+
+// 审计记录的输出，需要能被并发调用
+type Sink interface {
+	Write(r *Record) error
+}
+
+// 以函数作为 Sink，如发送到消息队列
+type SinkFunc func(r *Record) error
+
+func (f SinkFunc) Write(r *Record) error {
+	return f(r)
+}
+
+type Options struct {
+	Sinks    []Sink
+	Identity func(ctx context.Context) string //调用方的身份（如认证后的用户），为nil时不记录
+	Filter   func(serviceMethod string) bool  //返回 false 的方法不审计，为nil时审计所有方法
+	OnError  func(r *Record, err error)       //写入失败时调用，为nil时记录日志
+}
+
+// 创建审计拦截器
+func Interceptor(opt Options) geerpc.Interceptor {
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}, next geerpc.HandlerFunc) error {
+		if opt.Filter != nil && !opt.Filter(serviceMethod) {
+			return next(ctx, args, reply)
+		}
+		r := newRecord(ctx, serviceMethod, args)
+		if opt.Identity != nil {
+			r.Identity = opt.Identity(ctx)
+		}
+		err := next(ctx, args, reply)
+		r.Duration = time.Since(r.Time)
+		r.Code = Code(err)
+		if err != nil {
+			r.Error = err.Error()
+		}
+		for _, sink := range opt.Sinks {
+			if werr := sink.Write(r); werr != nil {
+				if opt.OnError != nil {
+					opt.OnError(r, werr)
+				} else {
+					log.Printf("rpc audit: write %s record: %v", serviceMethod, werr)
+				}
+			}
+		}
+		return err
+	}
+}
+
+func newRecord(ctx context.Context, serviceMethod string, args interface{}) *Record {
+	r := &Record{
+		Time:          time.Now(),
+		ServiceMethod: serviceMethod,
+		Tenant:        geerpc.TenantFromContext(ctx),
+		RequestID:     geerpc.RequestIDFromContext(ctx),
+		ArgsDigest:    Digest(args),
+	}
+	if ci, ok := geerpc.ClientInfoFromContext(ctx); ok {
+		r.ClientID, r.SessionID = ci.ClientID, ci.SessionID
+	}
+	if p, ok := geerpc.PeerFromContext(ctx); ok {
+		if p.Addr != nil {
+			r.Peer = p.Addr.String()
+		}
+		if p.TLS != nil && len(p.TLS.PeerCertificates) > 0 {
+			r.PeerCert = p.TLS.PeerCertificates[0].Subject.String()
+		}
+	}
+	return r
+}
+
+// 参数的摘要：JSON 编码后的 SHA-256，无法编码时返回空字符串
+func Digest(args interface{}) string {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// 调用结果的分类
+const (
+	CodeOK               = "OK"
+	CodeInvalidArgument  = "InvalidArgument"
+	CodeNotFound         = "NotFound"
+	CodeOverloaded       = "Overloaded"
+	CodeInternal         = "Internal"
+	CodeCanceled         = "Canceled"
+	CodeDeadlineExceeded = "DeadlineExceeded"
+	CodeError            = "Error" //其他错误
+)
+
+// 按错误的类型分类
+func Code(err error) string {
+	var (
+		invalid    *geerpc.InvalidArgumentError
+		notFound   *geerpc.NotFoundError
+		overloaded *geerpc.OverloadedError
+		internal   *geerpc.InternalError
+	)
+	switch {
+	case err == nil:
+		return CodeOK
+	case errors.As(err, &invalid):
+		return CodeInvalidArgument
+	case errors.As(err, &notFound):
+		return CodeNotFound
+	case errors.As(err, &overloaded), errors.Is(err, geerpc.ErrMethodOverloaded), errors.Is(err, geerpc.ErrClientLimitExceeded):
+		return CodeOverloaded
+	case errors.As(err, &internal):
+		return CodeInternal
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	default:
+		return CodeError
+	}
+}
@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// 把记录按 JSON 每行一条写入 w
+type WriterSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w)}
+}
+
+func (s *WriterSink) Write(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(r)
+}
+
+// 追加写入文件，每条记录写入后 Sync，保证进程退出后记录不丢失
+type FileSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	enc  *json.Encoder
+	sync bool
+}
+
+// 打开（不存在时创建）path 并追加写入
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f, enc: json.NewEncoder(f), sync: true}, nil
+}
+
+// 关闭每条记录后的 Sync，吞吐更高，但进程崩溃时可能丢失最后的记录
+func (s *FileSink) NoSync() *FileSink {
+	s.mu.Lock()
+	s.sync = false
+	s.mu.Unlock()
+	return s
+}
+
+func (s *FileSink) Write(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(r); err != nil {
+		return err
+	}
+	if s.sync {
+		return s.f.Sync()
+	}
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
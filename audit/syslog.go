@@ -0,0 +1,36 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// 写入本机的 syslog，设施为 LOG_AUTH，每条记录是一条 JSON 消息
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	w, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+func (s *SyslogSink) Write(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if r.Code != CodeOK {
+		return s.w.Warning(string(data))
+	}
+	return s.w.Info(string(data))
+}
+
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,22 @@
+//go:build windows || plan9
+
+package audit
+
+import "errors"
+
+var errSyslogUnsupported = errors.New("rpc audit: syslog is not supported on this platform")
+
+type SyslogSink struct{}
+
+// 这个平台没有 syslog，总是返回错误
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	return nil, errSyslogUnsupported
+}
+
+func (s *SyslogSink) Write(r *Record) error {
+	return errSyslogUnsupported
+}
+
+func (s *SyslogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package geerpc
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+/**
+ * 客户端写合并
+ *
+ * 默认每个请求写完立即 Flush，一次系统调用。大量并发的小请求时，可以开启写合并：
+ * 请求先写入缓冲区，缓冲区达到 BatchSize 或者第一个字节写入后经过 BatchDelay 时才真正写到连接，
+ * 多个请求共用一次系统调用，以少量延迟换取吞吐量
+ *   opt := &geerpc.Option{..., BatchDelay: 200 * time.Microsecond, BatchSize: 64 << 10}
+ * 写连接的错误在下一次写入时返回，连接出错后接收响应的 goroutine 会让所有调用失败
+ */
+
+const defaultBatchSize = 64 << 10
+
+type batchConn struct {
+	io.ReadWriteCloser
+	delay time.Duration
+	size  int
+	mu    sync.Mutex
+	buf   []byte
+	timer *time.Timer //缓冲区不为空时等待写出的定时器
+	err   error       //之前写连接时的错误
+}
+
+func newBatchConn(conn io.ReadWriteCloser, delay time.Duration, size int) *batchConn {
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	return &batchConn{ReadWriteCloser: conn, delay: delay, size: size}
+}
+
+func (c *batchConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.size {
+		return len(p), c.flushLocked()
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.delay, c.flush)
+	}
+	return len(p), nil
+}
+
+func (c *batchConn) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.flushLocked()
+}
+
+// 写出缓冲区，调用时需要持有 mu
+func (c *batchConn) flushLocked() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if len(c.buf) == 0 || c.err != nil {
+		return c.err
+	}
+	_, c.err = c.ReadWriteCloser.Write(c.buf)
+	c.buf = c.buf[:0]
+	return c.err
+}
+
+// 关闭前写出缓冲的数据
+func (c *batchConn) Close() error {
+	c.mu.Lock()
+	_ = c.flushLocked()
+	c.mu.Unlock()
+	return c.ReadWriteCloser.Close()
+}
@@ -0,0 +1,322 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/**
+ * 文件传输服务
+ *
+ * 可选的内置服务 Blob，在 dir 目录下收发文件：
+ *   server.EnableBlob("/var/data/blobs")
+ *   client.SendFile(ctx, "local.tar.gz", "backup/2024.tar.gz")
+ *   client.RecvFile(ctx, "backup/2024.tar.gz", "restore.tar.gz")
+ * 文件按 BlobChunkSize 分成多次调用传输，每块带 CRC32-C 校验和，
+ * 传输完成后用整个文件的 SHA-256 校验，校验通过才把临时文件改成目标文件名
+ * 断点续传：上传时服务端保留 name.part，下次 SendFile 从它的长度继续；
+ * 下载时本地保留 path.part，下次 RecvFile 从它的长度继续。续传的内容不一致时最后的校验会失败并删除临时文件
+ * 文件名是 dir 下的相对路径，不能包含 ".." 或绝对路径
+ */
+
+const (
+	BlobServiceName = "Blob"
+	BlobChunkSize   = 1 << 20 //每次调用传输的最大字节数
+	blobPartSuffix  = ".part"
+)
+
+var (
+	ErrBlobName     = errors.New("rpc blob: invalid name")
+	ErrBlobChecksum = errors.New("rpc blob: checksum mismatch")
+	ErrBlobOffset   = errors.New("rpc blob: offset does not match the partial file")
+)
+
+type BlobInfo struct {
+	Name    string
+	Size    int64  //文件大小，文件不存在时为-1
+	SHA256  string //文件内容的 SHA-256，十六进制
+	Partial int64  //没有完成的上传已经写入的字节数
+}
+
+type BlobChunk struct {
+	Name     string
+	Offset   int64
+	Data     []byte
+	Checksum uint32 //Data 的 CRC32-C
+}
+
+type BlobRange struct {
+	Name   string
+	Offset int64
+	Length int //0或超过 BlobChunkSize 时为 BlobChunkSize
+}
+
+type BlobCommit struct {
+	Name   string
+	Size   int64
+	SHA256 string
+}
+
+type blobService struct {
+	dir string
+	mu  sync.Mutex //串行化写操作，保证续传的偏移量检查和写入是原子的
+}
+
+// 注册内置的 Blob 服务，文件保存在 dir 目录下
+func (server *Server) EnableBlob(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return server.RegisterName(BlobServiceName, &blobService{dir: dir})
+}
+
+func (b *blobService) path(name string) (string, error) {
+	if name == "" || !filepath.IsLocal(name) {
+		return "", ErrBlobName
+	}
+	return filepath.Join(b.dir, name), nil
+}
+
+func (b *blobService) Stat(name string, reply *BlobInfo) error {
+	p, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	info := BlobInfo{Name: name, Size: -1}
+	if fi, err := os.Stat(p + blobPartSuffix); err == nil {
+		info.Partial = fi.Size()
+	}
+	if fi, err := os.Stat(p); err == nil {
+		info.Size = fi.Size()
+		if info.SHA256, err = fileSHA256(p); err != nil {
+			return err
+		}
+	}
+	*reply = info
+	return nil
+}
+
+// 写一块到临时文件，Offset 必须等于临时文件的长度，为0时重新开始；返回写入后的长度
+func (b *blobService) Write(chunk BlobChunk, reply *int64) error {
+	p, err := b.path(chunk.Name)
+	if err != nil {
+		return err
+	}
+	if crc32.Checksum(chunk.Data, castagnoli) != chunk.Checksum {
+		return ErrBlobChecksum
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	flags := os.O_WRONLY | os.O_CREATE
+	if chunk.Offset == 0 {
+		flags |= os.O_TRUNC
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(p+blobPartSuffix, flags, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if size != chunk.Offset {
+		return ErrBlobOffset
+	}
+	if _, err := f.Write(chunk.Data); err != nil {
+		return err
+	}
+	*reply = size + int64(len(chunk.Data))
+	return nil
+}
+
+// 校验临时文件，通过后改成目标文件名；校验失败时删除临时文件
+func (b *blobService) Commit(c BlobCommit, reply *BlobInfo) error {
+	p, err := b.path(c.Name)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	part := p + blobPartSuffix
+	fi, err := os.Stat(part)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(part)
+	if err != nil {
+		return err
+	}
+	if fi.Size() != c.Size || sum != c.SHA256 {
+		_ = os.Remove(part)
+		return ErrBlobChecksum
+	}
+	if err := os.Rename(part, p); err != nil {
+		return err
+	}
+	*reply = BlobInfo{Name: c.Name, Size: c.Size, SHA256: sum}
+	return nil
+}
+
+// 读一段，到文件末尾时返回的 Data 比请求的短
+func (b *blobService) Read(r BlobRange, reply *BlobChunk) error {
+	p, err := b.path(r.Name)
+	if err != nil {
+		return err
+	}
+	if r.Length <= 0 || r.Length > BlobChunkSize {
+		r.Length = BlobChunkSize
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data := make([]byte, r.Length)
+	n, err := f.ReadAt(data, r.Offset)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	*reply = BlobChunk{Name: r.Name, Offset: r.Offset, Data: data[:n], Checksum: crc32.Checksum(data[:n], castagnoli)}
+	return nil
+}
+
+func (b *blobService) Delete(name string, reply *bool) error {
+	p, err := b.path(name)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_ = os.Remove(p + blobPartSuffix)
+	err = os.Remove(p)
+	*reply = err == nil
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 把本地文件 path 上传为服务端的 name，服务端有没完成的上传时从断点继续
+func (client *Client) SendFile(ctx context.Context, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	var info BlobInfo
+	if err := client.CallContext(ctx, BlobServiceName+".Stat", name, &info); err != nil {
+		return err
+	}
+	offset := info.Partial
+	if offset > fi.Size() {
+		offset = 0
+	}
+	buf := make([]byte, BlobChunkSize)
+	for {
+		n, err := f.ReadAt(buf, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		//空文件也要写一次，服务端才会创建临时文件
+		if n > 0 || offset == 0 {
+			chunk := BlobChunk{Name: name, Offset: offset, Data: buf[:n], Checksum: crc32.Checksum(buf[:n], castagnoli)}
+			if err := client.CallContext(ctx, BlobServiceName+".Write", chunk, &offset); err != nil {
+				return fmt.Errorf("rpc blob: write %s at %d: %w", name, chunk.Offset, err)
+			}
+		}
+		if offset >= fi.Size() {
+			break
+		}
+	}
+	return client.CallContext(ctx, BlobServiceName+".Commit", BlobCommit{Name: name, Size: fi.Size(), SHA256: sum}, &info)
+}
+
+// 把服务端的 name 下载到本地的 path，本地有没完成的下载时从断点继续
+func (client *Client) RecvFile(ctx context.Context, name, path string) error {
+	var info BlobInfo
+	if err := client.CallContext(ctx, BlobServiceName+".Stat", name, &info); err != nil {
+		return err
+	}
+	if info.Size < 0 {
+		return fmt.Errorf("rpc blob: %s: %w", name, os.ErrNotExist)
+	}
+	part := path + blobPartSuffix
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > info.Size {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		offset = 0
+	}
+	for offset < info.Size {
+		var chunk BlobChunk
+		if err := client.CallContext(ctx, BlobServiceName+".Read", BlobRange{Name: name, Offset: offset}, &chunk); err != nil {
+			return err
+		}
+		if crc32.Checksum(chunk.Data, castagnoli) != chunk.Checksum {
+			return ErrBlobChecksum
+		}
+		if len(chunk.Data) == 0 {
+			return fmt.Errorf("rpc blob: %s changed during transfer", name)
+		}
+		if _, err := f.WriteAt(chunk.Data, offset); err != nil {
+			return err
+		}
+		offset += int64(len(chunk.Data))
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	sum, err := fileSHA256(part)
+	if err != nil {
+		return err
+	}
+	if sum != info.SHA256 {
+		_ = os.Remove(part)
+		return ErrBlobChecksum
+	}
+	return os.Rename(part, path)
+}
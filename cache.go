@@ -0,0 +1,261 @@
+package geerpc
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/**
+ * 客户端响应缓存
+ *
+ * 对指定的只读方法，相同参数的调用在有效期内直接返回缓存的响应，不再发送请求：
+ *   client.SetCache(&geerpc.CacheOption{
+ *       TTL:         time.Minute,
+ *       Methods:     []string{"User.Get"},
+ *       Invalidates: map[string][]string{"User.Update": {"User.Get"}},
+ *   })
+ *   client.Cache().Invalidate("User.Get", args) //手动使一条缓存失效
+ *
+ * 缓存的 key 是方法名加参数的 JSON 编码，再加上元数据、优先级和版本等调用选项，
+ * 不同租户、不同凭证的调用不会共享响应；响应用 gob 复制一份保存，
+ * 命中时解码到调用方的 reply 中，调用方修改 reply 不会影响缓存
+ * 同一个 key 没有缓存时，并发的相同调用只发送一次请求，其余的等待它的结果
+ * 出错的调用不缓存，等待它的调用各自重新发送请求
+ * Invalidates 中的方法调用成功后，对应方法的缓存全部失效
+ * 只有同步调用（Call、CallContext）会经过缓存，Go 发起的异步调用不会
+ */
+
+type CacheOption struct {
+	TTL         time.Duration       //缓存的有效期，0表示使用默认值
+	MaxEntries  int                 //最多缓存的响应数，0表示使用默认值
+	Methods     []string            //缓存响应的方法（"Service.Method"）
+	Invalidates map[string][]string //调用成功后使缓存失效：方法 -> 失效的方法
+}
+
+const (
+	defaultCacheTTL        = time.Minute
+	defaultCacheMaxEntries = 1024
+)
+
+type ResponseCache struct {
+	opt     CacheOption
+	methods map[string]bool
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	order   *list.List //按加入的顺序，用于淘汰
+}
+
+type cacheEntry struct {
+	key    string
+	base   string //方法名加参数，不含调用选项
+	method string
+	elem   *list.Element
+	done   chan struct{} //第一次调用完成后关闭
+	reply  []byte        //gob 编码的响应，调用出错时为nil
+	expire time.Time
+}
+
+func NewResponseCache(opt CacheOption) *ResponseCache {
+	if opt.TTL <= 0 {
+		opt.TTL = defaultCacheTTL
+	}
+	if opt.MaxEntries <= 0 {
+		opt.MaxEntries = defaultCacheMaxEntries
+	}
+	c := &ResponseCache{
+		opt:     opt,
+		methods: make(map[string]bool),
+		entries: make(map[string]*cacheEntry),
+		order:   list.New(),
+	}
+	for _, m := range opt.Methods {
+		c.methods[m] = true
+	}
+	return c
+}
+
+/*
+经过缓存发起一次调用，call 负责真正发送请求并把响应写入 reply，opts 是这次调用的选项
+不缓存的方法直接调用 call；参数无法编码成 key 或响应无法复制时不缓存
+*/
+func (c *ResponseCache) Do(ctx context.Context, serviceMethod string, args, reply interface{}, opts []CallOption, call func() error) error {
+	if !c.methods[serviceMethod] {
+		err := call()
+		if err == nil {
+			for _, m := range c.opt.Invalidates[serviceMethod] {
+				c.InvalidateMethod(m)
+			}
+		}
+		return err
+	}
+	base, err := cacheKey(serviceMethod, args)
+	if err != nil {
+		return call()
+	}
+	key := base + "\x00" + newCallOptions(opts).key()
+
+	c.mu.Lock()
+	c.evict()
+	if e, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		//第一次调用出错，自己重新发送
+		if e.reply == nil {
+			return call()
+		}
+		return copyReply(e.reply, reply)
+	}
+	e := &cacheEntry{key: key, base: base, method: serviceMethod, done: make(chan struct{})}
+	e.elem = c.order.PushBack(e)
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	err = call()
+	var data []byte
+	if err == nil {
+		data, _ = encodeReply(reply)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data == nil {
+		c.remove(e)
+	} else {
+		e.reply = data
+		e.expire = time.Now().Add(c.opt.TTL)
+	}
+	close(e.done)
+	return err
+}
+
+// 使一组参数的缓存失效，包括以不同调用选项缓存的响应
+func (c *ResponseCache) Invalidate(serviceMethod string, args interface{}) {
+	if c == nil {
+		return
+	}
+	base, err := cacheKey(serviceMethod, args)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.entries {
+		if e.base == base {
+			c.remove(e)
+		}
+	}
+}
+
+// 使一个方法的缓存全部失效
+func (c *ResponseCache) InvalidateMethod(serviceMethod string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.entries {
+		if e.method == serviceMethod {
+			c.remove(e)
+		}
+	}
+}
+
+// 清空缓存
+func (c *ResponseCache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*cacheEntry)
+	c.order.Init()
+}
+
+// 缓存中的响应数，包括还在等待第一次调用的
+func (c *ResponseCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// 删除一条记录，已经删除时什么都不做；等待中的调用仍然会收到结果
+func (c *ResponseCache) remove(e *cacheEntry) {
+	if c.entries[e.key] == e {
+		delete(c.entries, e.key)
+		c.order.Remove(e.elem)
+	}
+}
+
+// 淘汰过期的和超出数量的记录，还在等待第一次调用的记录不淘汰
+func (c *ResponseCache) evict() {
+	now := time.Now()
+	for elem := c.order.Front(); elem != nil; {
+		e := elem.Value.(*cacheEntry)
+		next := elem.Next()
+		select {
+		case <-e.done:
+			if now.After(e.expire) || c.order.Len() >= c.opt.MaxEntries {
+				c.remove(e)
+				elem = next
+				continue
+			}
+		default:
+		}
+		if c.order.Len() < c.opt.MaxEntries {
+			return
+		}
+		elem = next
+	}
+}
+
+// 方法名加参数的 JSON 编码，map 的 key 是排好序的，相同的参数得到相同的 key
+func cacheKey(serviceMethod string, args interface{}) (string, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	return serviceMethod + "\x00" + string(data), nil
+}
+
+func encodeReply(reply interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(reply); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gob 不传输零值字段，解码前先把 reply 清零，避免残留调用方原来的值
+func copyReply(data []byte, reply interface{}) error {
+	v := reflect.ValueOf(reply)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(reply)
+}
+
+// 开启响应缓存，opt 为nil时关闭；重新设置会丢弃已有的缓存
+func (client *Client) SetCache(opt *CacheOption) {
+	if opt == nil {
+		client.cache.Store(nil)
+		return
+	}
+	client.cache.Store(NewResponseCache(*opt))
+}
+
+// 当前的响应缓存，用于手动失效；没有开启时为nil，调用它的失效方法是安全的
+func (client *Client) Cache() *ResponseCache {
+	return client.cache.Load()
+}
@@ -0,0 +1,82 @@
+package geerpc
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/**
+ * 单次调用的选项
+ *
+ * Go、Call、CallContext 等调用接口最后都可以传入 CallOption，按调用调整行为，不需要为此创建不同的客户端：
+ *   client.Call("Foo.Sum", args, &reply, geerpc.WithTimeout(time.Second), geerpc.WithPriority(10))
+ * 编解码方式在握手时按连接协商，不能按调用修改，需要不同的编解码方式时使用不同的 Client
+ */
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	timeout  time.Duration
+	priority int
+	meta     map[string]string
+	version  string
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	o := new(callOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+/*
+会影响服务端响应的选项（元数据、优先级、版本）的编码，响应缓存和调用合并用它区分不同的调用
+超时时间不影响响应，不计入；没有设置这些选项时为空字符串
+*/
+func (o *callOptions) key() string {
+	if o.priority == 0 && o.version == "" && len(o.meta) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(struct {
+		Priority int
+		Version  string
+		Meta     map[string]string
+	}{o.priority, o.version, o.meta})
+	return string(data)
+}
+
+// 调用的超时时间，超时后放弃调用并通知服务端，服务端处理时的 context 带有同样的截止时间
+func WithTimeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// 请求优先级，数值越大越优先，默认为0，服务端开启优先级调度时生效
+func WithPriority(priority int) CallOption {
+	return func(o *callOptions) {
+		o.priority = priority
+	}
+}
+
+// 附加一个元数据，可以多次使用，键转换为规范形式（见 CanonicalMetaKey）
+func WithMetadata(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.meta == nil {
+			o.meta = make(map[string]string)
+		}
+		o.meta[CanonicalMetaKey(key)] = value
+	}
+}
+
+// 设置幂等键，重试时使用同一个键，服务端开启去重后相同幂等键的请求只会执行一次
+func WithIdempotencyKey(key string) CallOption {
+	return WithMetadata(IdempotencyKeyMeta, key)
+}
+
+// 指定这次调用的服务版本，覆盖 Option.Version
+func WithVersion(version string) CallOption {
+	return func(o *callOptions) {
+		o.version = version
+	}
+}
@@ -0,0 +1,184 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geerpc/codec"
+	"log"
+	"reflect"
+	"sync"
+)
+
+/**
+ * 双向 RPC：服务端回调客户端
+ *
+ * 客户端在 Option.Callbacks 中提供一个 Server，注册可以被服务端调用的服务，
+ * 服务端在同一个连接上调用这些服务，客户端不需要监听端口，可以用于推送通知和回调：
+ *   callbacks := geerpc.NewServer()
+ *   _ = callbacks.Register(&Notifier{})
+ *   client, _ := geerpc.Dial("tcp", addr, &geerpc.Option{..., Callbacks: callbacks})
+ *
+ *   //服务端的方法中
+ *   func (s *Foo) Subscribe(ctx context.Context, topic string, ok *bool) error {
+ *       cb := geerpc.CallbackFromContext(ctx) //客户端没有提供 Callbacks 时为nil
+ *       go cb.Call(context.Background(), "Notifier.Notify", "hello", &ack) //连接断开前都可以使用
+ *   }
+ *
+ * 回调的请求和响应在请求头中设置 Callback 标志，与普通的请求和响应区分开，编号也是独立的
+ */
+
+var ErrCallbacksDisabled = errors.New("rpc client: callbacks are not enabled, set Option.Callbacks")
+
+type callbackKey struct{}
+
+// 返回发起这个请求的连接上的回调句柄，连接不支持回调（如 net/rpc 客户端）时返回nil
+func CallbackFromContext(ctx context.Context) *Callback {
+	cb, _ := ctx.Value(callbackKey{}).(*Callback)
+	return cb
+}
+
+// 服务端调用客户端服务的句柄，同一个连接上的所有请求共用
+type Callback struct {
+	cc      codec.Codec
+	sending *sendLock  //与服务端发送响应共用，保证消息完整
+	mu      sync.Mutex //保护以下字段
+	seq     uint64
+	pending map[uint64]*Call
+	closed  bool
+}
+
+func newCallback(cc codec.Codec, sending *sendLock) *Callback {
+	return &Callback{cc: cc, sending: sending, seq: 1, pending: make(map[uint64]*Call)}
+}
+
+// 异步回调，done 为nil时创建容量为1的通道
+func (cb *Callback) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 1)
+	}
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done}
+	cb.mu.Lock()
+	if cb.closed {
+		cb.mu.Unlock()
+		call.Error = ErrShutdown
+		call.done()
+		return call
+	}
+	call.Seq = cb.seq
+	cb.seq++
+	cb.pending[call.Seq] = call
+	cb.mu.Unlock()
+
+	h := codec.Header{ServiceMethod: serviceMethod, Seq: call.Seq, Callback: true}
+	cb.sending.Lock()
+	err := cb.cc.Write(&h, args)
+	cb.sending.Unlock()
+	if err != nil {
+		if call := cb.remove(h.Seq); call != nil {
+			call.Error = err
+			call.done()
+		}
+	}
+	return call
+}
+
+// 同步回调，ctx 结束时放弃等待，之后收到的响应会被丢弃
+func (cb *Callback) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	call := cb.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	select {
+	case <-ctx.Done():
+		cb.remove(call.Seq)
+		return fmt.Errorf("rpc server: callback failed: %w", ctx.Err())
+	case call := <-call.Done:
+		return call.Error
+	}
+}
+
+func (cb *Callback) remove(seq uint64) *Call {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	call := cb.pending[seq]
+	delete(cb.pending, seq)
+	return call
+}
+
+// 服务端读到客户端对回调的响应，读取响应体，出错时连接不再可用
+func (cb *Callback) receive(cc codec.Codec, h *codec.Header) error {
+	call := cb.remove(h.Seq)
+	if call == nil {
+		return cc.ReadBody(nil)
+	}
+	var err error
+	if h.Error != "" {
+		call.Error = ServerError(h.Error)
+		err = cc.ReadBody(nil)
+	} else if err = cc.ReadBody(call.Reply); err != nil {
+		call.Error = errors.New("reading body " + err.Error())
+	}
+	call.done()
+	return err
+}
+
+// 连接断开，还没有收到响应的回调都以 ErrShutdown 结束
+func (cb *Callback) close() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.closed = true
+	for seq, call := range cb.pending {
+		delete(cb.pending, seq)
+		call.Error = ErrShutdown
+		call.done()
+	}
+}
+
+// 客户端处理服务端的回调请求，只有读请求体出错时返回错误
+func (client *Client) serveCallback(h *codec.Header) error {
+	if h.ServiceMethod == deliverServiceMethod {
+		return client.deliver(h)
+	}
+	server := client.opt.Callbacks
+	if server == nil {
+		if err := client.cc.ReadBody(nil); err != nil {
+			return err
+		}
+		client.replyCallback(h, ErrCallbacksDisabled, invalidRequest)
+		return nil
+	}
+	svc, mtype, err := server.lookupService(h.ServiceMethod, h.Version, "")
+	if err != nil {
+		if err := client.cc.ReadBody(nil); err != nil {
+			return err
+		}
+		client.replyCallback(h, err, invalidRequest)
+		return nil
+	}
+	argv, replyv := mtype.newArgv(), mtype.newReplyv()
+	argvi := argv.Interface()
+	if argv.Type().Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
+	}
+	if err := client.cc.ReadBody(argvi); err != nil {
+		return err
+	}
+	go func() {
+		if err := server.call(context.Background(), svc, mtype, argv, replyv); err != nil {
+			client.replyCallback(h, err, invalidRequest)
+			return
+		}
+		client.replyCallback(h, nil, replyv.Interface())
+	}()
+	return nil
+}
+
+func (client *Client) replyCallback(h *codec.Header, err error, body interface{}) {
+	resp := codec.Header{ServiceMethod: h.ServiceMethod, Seq: h.Seq, Callback: true}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	if err := client.cc.Write(&resp, body); err != nil {
+		log.Println("rpc client: write callback response error:", err)
+	}
+}
@@ -0,0 +1,135 @@
+package geerpc
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * 故障注入
+ *
+ * 按概率注入延迟、错误、丢弃和断开连接，用于测试重试、熔断、超时等容错逻辑，不需要外部工具：
+ *   server.SetChaos(&geerpc.ChaosOption{Latency: 100 * time.Millisecond, LatencyRate: 0.1, ErrorRate: 0.05})
+ *   client.SetChaos(&geerpc.ChaosOption{DropRate: 0.01, Methods: []string{"Foo.Sum"}})
+ * 服务端：错误作为响应返回，不调用服务方法；丢弃是调用服务方法但不回复；断开是关闭整个连接
+ * 客户端：错误直接返回给调用方，请求不会发出；丢弃是请求不发出，调用方只能等到超时或取消；断开是在发送前关闭连接
+ * 服务端注入的错误对客户端来说是 ServerError，Error 设为 "rpc server: overloaded" 开头时会被识别为 OverloadedError，
+ * 可以用来测试按服务端错误分类的重试逻辑
+ * 只用于测试，SetChaos(nil) 关闭
+ */
+
+type ChaosOption struct {
+	Latency     time.Duration //注入延迟的上限，实际延迟在 [0, Latency) 之间随机
+	LatencyRate float64       //注入延迟的概率
+	ErrorRate   float64       //返回错误的概率
+	Error       string        //注入的错误信息，为空时使用 ErrChaos
+	DropRate    float64       //丢弃的概率
+	ResetRate   float64       //断开连接的概率
+	Methods     []string      //只对这些 ServiceMethod 生效，为空时对所有方法生效
+}
+
+var ErrChaos = errors.New("rpc chaos: injected fault")
+
+type chaosFault int
+
+const (
+	chaosNone chaosFault = iota
+	chaosFail
+	chaosDrop
+	chaosReset
+)
+
+type chaos struct {
+	opt     ChaosOption
+	methods map[string]bool
+	mu      sync.Mutex //保护 rnd
+	rnd     *rand.Rand
+}
+
+func newChaos(opt *ChaosOption) *chaos {
+	if opt == nil {
+		return nil
+	}
+	c := &chaos{opt: *opt, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if len(opt.Methods) > 0 {
+		c.methods = make(map[string]bool, len(opt.Methods))
+		for _, m := range opt.Methods {
+			c.methods[m] = true
+		}
+	}
+	return c
+}
+
+// 决定一次调用注入的延迟和故障，错误、丢弃、断开最多只会发生一个
+func (c *chaos) decide(serviceMethod string) (time.Duration, chaosFault) {
+	if c == nil || (c.methods != nil && !c.methods[serviceMethod]) {
+		return 0, chaosNone
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var delay time.Duration
+	if c.opt.Latency > 0 && c.rnd.Float64() < c.opt.LatencyRate {
+		delay = time.Duration(c.rnd.Int63n(int64(c.opt.Latency)))
+	}
+	r := c.rnd.Float64()
+	switch {
+	case r < c.opt.ErrorRate:
+		return delay, chaosFail
+	case r < c.opt.ErrorRate+c.opt.DropRate:
+		return delay, chaosDrop
+	case r < c.opt.ErrorRate+c.opt.DropRate+c.opt.ResetRate:
+		return delay, chaosReset
+	}
+	return delay, chaosNone
+}
+
+func (c *chaos) err() error {
+	if c.opt.Error != "" {
+		return errors.New(c.opt.Error)
+	}
+	return ErrChaos
+}
+
+// 服务端开启故障注入，opt 为 nil 时关闭
+func (server *Server) SetChaos(opt *ChaosOption) {
+	server.chaos.Store(newChaos(opt))
+}
+
+// 客户端开启故障注入，opt 为 nil 时关闭
+func (client *Client) SetChaos(opt *ChaosOption) {
+	client.chaos.Store(newChaos(opt))
+}
+
+// 客户端发送前注入故障，返回 true 表示请求不再发送
+func (client *Client) injectFault(call *Call) bool {
+	c := client.chaos.Load()
+	delay, fault := c.decide(call.ServiceMethod)
+	if delay > 0 {
+		//不超过调用的截止时间
+		if !call.deadline.IsZero() {
+			if left := time.Until(call.deadline); left < delay {
+				delay = left
+			}
+		}
+		time.Sleep(delay)
+	}
+	switch fault {
+	case chaosFail:
+		call.Error = c.err()
+		client.complete(call)
+		return true
+	case chaosDrop:
+		//注册后不发送，调用方超时或取消时正常移除
+		if _, err := client.registerCall(call); err != nil {
+			call.Error = err
+			client.complete(call)
+		}
+		return true
+	case chaosReset:
+		//之后的发送和接收都会失败，所有调用以连接错误结束
+		_ = client.cc.Close()
+	}
+	return false
+}
@@ -1,14 +1,18 @@
 package geerpc
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"geerpc/codec"
 	"io"
 	"log"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /**
@@ -20,34 +24,110 @@ import (
 */
 type Call struct {
 	Seq           uint64
-	ServiceMethod string      //如Service.<Method>
-	Args          interface{} //请求参数
-	Reply         interface{} //函数响应
-	Error         error       // 错误处理设置
-	Done          chan *Call  //完整被调用时Done,用于通知调用方
+	ServiceMethod string                    //如Service.<Method>
+	Args          interface{}               //请求参数
+	Reply         interface{}               //函数响应
+	Error         error                     // 错误处理设置
+	Done          chan *Call                //完整被调用时Done,用于通知调用方
+	RequestID     string                    //请求 ID，发送时确定，见 requestid.go
+	deadline      time.Time                 //截止时间，随请求头发给服务端
+	priority      int                       //优先级，随请求头发给服务端
+	meta          map[string]string         //元数据，随请求头发给服务端
+	version       string                    //服务版本，为空时使用 Option.Version
+	policy        DonePolicy                //Done 通道满时的处理策略
+	timer         atomic.Pointer[callTimer] //WithTimeout 的定时器，调用完成时停止
 }
 
+// 调用的超时定时器，调用完成后换成 timerStopped
+type callTimer struct {
+	t Timer
+}
+
+var timerStopped = new(callTimer)
+
+// 记录超时定时器，调用已经完成时直接停止
+func (call *Call) setTimer(t Timer) {
+	if !call.timer.CompareAndSwap(nil, &callTimer{t}) {
+		t.Stop()
+	}
+}
+
+// 调用完成，停止超时定时器
+func (call *Call) stopTimer() {
+	if old := call.timer.Swap(timerStopped); old != nil && old != timerStopped {
+		old.t.Stop()
+	}
+}
+
+/*
+Done 通道满时的处理策略，通知是在接收响应的 goroutine 中发送的：
+DoneBlock 等待调用方取走，消费慢时会阻塞这个连接上所有响应的接收
+DoneDrop  丢弃这次通知并记录日志（与标准库 net/rpc 相同），接收不受影响，但调用方收不到这个调用的完成通知
+无缓冲的通道总是在单独的 goroutine 中发送，不受策略影响
+*/
+type DonePolicy int
+
+const (
+	DoneBlock DonePolicy = iota
+	DoneDrop
+)
+
+const defaultDoneBuffer = 10
+
 /*
 异步调用，调用结束后，调用call.Done去通知调用方
 */
 func (call *Call) done() {
-	call.Done <- call //传入call本身
+	switch {
+	case cap(call.Done) == 0:
+		go func() { call.Done <- call }()
+	case call.policy == DoneDrop:
+		select {
+		case call.Done <- call:
+		default:
+			log.Println("rpc client: discarding Call reply due to insufficient Done chan capacity")
+		}
+	default:
+		call.Done <- call //传入call本身
+	}
 }
 
 /*
 核心部分：一个Client可以有多个调用，也可以同时被多个goroutine使用
 */
 type Client struct {
-	cc      codec.Codec      //编解码器
-	opt     *Option          //协商协议
-	sending sync.Mutex       //保护上下文，保证请求的有序发送（多个请求时），方式多个请求报文混淆
-	header  codec.Header     //请求头，发送请求时才需要，每个客户端只需要一个，可以复用
-	mu      sync.Mutex       //保护上下文
-	seq     uint64           //请求编号
-	pending map[uint64]*Call //存储未进行调用的Call，键是编号，值是 Call 实例
-	//任意一个为true，标识客户端不可用
-	closing  bool //主动关闭，调用Close方法
-	shutdown bool //有错误发生
+	cc      codec.Codec  //编解码器
+	opt     *Option      //协商协议
+	sending sync.Mutex   //保护上下文，保证请求的有序发送（多个请求时），方式多个请求报文混淆
+	header  codec.Header //请求头，发送请求时才需要，每个客户端只需要一个，可以复用
+	mu      sync.Mutex   //保护状态的变化：关闭、出错和优雅关闭
+	seq     uint64       //下一个请求编号，原子操作
+	//存储未进行调用的Call，按编号分片，并发调用时不同分片之间没有锁竞争
+	pending  [pendingShards]pendingShard
+	inflight int64 //已经注册还没有结束的调用数，原子操作
+	//连接状态，见 client_state.go，在 mu 内修改，读取时不需要加锁
+	state    atomic.Int32
+	watchers stateWatchers
+	released bool //Close 已经关闭了连接，由 mu 保护
+	stats    *clientStats
+	//优雅关闭：inflight 归零或连接出错后关闭，由 mu 保护
+	drained chan struct{}
+	//订阅的主题 -> 处理函数
+	subsMu   sync.Mutex
+	subs     map[string]func(Message)
+	chaos    atomic.Pointer[chaos]         //故障注入，为nil时不开启
+	cache    atomic.Pointer[ResponseCache] //响应缓存，为nil时不开启
+	coalesce atomic.Pointer[Coalescer]     //合并并发的相同调用，为nil时不开启
+	//没有收到响应就结束的调用，用于区分迟到和重复的响应
+	abandoned abandonedSeqs
+}
+
+const pendingShards = 32
+
+// pending 的一个分片
+type pendingShard struct {
+	mu    sync.Mutex
+	calls map[uint64]*Call
 }
 
 /*
@@ -58,61 +138,142 @@ var _ io.Closer = (*Client)(nil)
 
 var ErrShutdown = errors.New("connection is shut down")
 
+var ErrCallCanceled = errors.New("rpc client: call canceled")
+
+// 等待响应的调用数达到 Option.MaxPending，请求没有发出
+var ErrTooManyPending = errors.New("rpc client: too many pending calls")
+
+// 服务端返回的错误，与连接错误区分开，调用方可以据此判断请求是否已经被服务端处理
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
 /*
 *
 Close接口的具体实现，用户主动调用Close函数
+立即关闭连接，还没有收到响应的调用会以错误结束，需要等待它们完成时使用 Shutdown
 */
 func (client *Client) Close() error {
 	client.mu.Lock()
 	defer client.mu.Unlock()
-	if client.closing {
+	if client.released {
 		return ErrShutdown
 	}
-	//主动调用的修改
-	client.closing = true
+	//连接出错后状态已经是 Closed，仍然需要关闭连接
+	client.released = true
+	client.setState(ClientClosed, nil)
 	return client.cc.Close() //调用编解码器的Close，一般就是连接关闭
 }
 
 /*
-检验客户端是否工作
+*
+优雅关闭：不再接受新的调用，等待已发出的调用完成后关闭连接
+ctx 结束时还有调用没有完成，则直接关闭连接并返回 ctx 的错误
 */
-func (client *Client) IsAvailable() bool {
+func (client *Client) Shutdown(ctx context.Context) error {
+	client.mu.Lock()
+	if client.released {
+		client.mu.Unlock()
+		return ErrShutdown
+	}
+	if client.drained == nil {
+		client.drained = make(chan struct{})
+		client.setState(ClientDraining, nil)
+		client.checkDrained()
+	}
+	drained := client.drained
+	client.mu.Unlock()
+
+	select {
+	case <-drained:
+		return client.Close()
+	case <-ctx.Done():
+		_ = client.Close()
+		return ctx.Err()
+	}
+}
+
+// 一个调用结束（响应体已经读完或者调用失败），优雅关闭时检查是否可以关闭连接
+func (client *Client) callFinished() {
+	atomic.AddInt64(&client.inflight, -1)
+	if client.State() != ClientDraining {
+		return
+	}
 	client.mu.Lock()
 	defer client.mu.Unlock()
-	return !client.shutdown && !client.closing
+	client.checkDrained()
+}
+
+// 优雅关闭时，调用全部结束或连接出错后通知 Shutdown，调用时需要持有 mu
+func (client *Client) checkDrained() {
+	if client.drained == nil {
+		return
+	}
+	if atomic.LoadInt64(&client.inflight) == 0 || client.State() == ClientClosed {
+		select {
+		case <-client.drained:
+		default:
+			close(client.drained)
+		}
+	}
+}
+
+/*
+检验客户端是否工作：Ready 或 Degraded 时可以发起调用
+*/
+func (client *Client) IsAvailable() bool {
+	s := client.State()
+	return s == ClientReady || s == ClientDegraded
 }
 
 /*
 调用注册,设置根据机器设置seq到Call结构,将参数call添到client.pending,并同时更新seq作为下一个新请求的编号
 */
 func (client *Client) registerCall(call *Call) (uint64, error) {
-	client.mu.Lock()
-	defer client.mu.Unlock()
-	if client.closing || client.shutdown {
+	call.Seq = atomic.AddUint64(&client.seq, 1) - 1
+	shard := client.shard(call.Seq)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	//在分片锁内检查状态：terminateCalls 先进入 Closed 再逐个锁住分片，不会漏掉这里加入的调用
+	if !client.IsAvailable() {
 		return 0, ErrShutdown
 	}
+	//先占一个名额，超过上限时退回；各分片并发注册，不能先读再加
+	n := atomic.AddInt64(&client.inflight, 1)
+	if max := client.opt.MaxPending; max > 0 && n > int64(max) {
+		atomic.AddInt64(&client.inflight, -1)
+		atomic.AddUint64(&client.stats.rejected, 1)
+		return 0, ErrTooManyPending
+	}
 	//rpc调用
-	call.Seq = client.seq
-	client.pending[call.Seq] = call //添加至调用map
-	client.seq++                    //下一个使用
+	shard.calls[call.Seq] = call //添加至调用map
+	atomic.AddUint64(&client.stats.calls, 1)
 	return call.Seq, nil
 }
 
+func (client *Client) shard(seq uint64) *pendingShard {
+	return &client.pending[seq%pendingShards]
+}
+
 /*
 移除调用从pending移除对应的call并返回
+返回不为nil时，调用方结束这个调用后需要调用 callFinished
 */
 func (client *Client) removeCall(seq uint64) *Call {
-	client.mu.Lock()
-	defer client.mu.Unlock()
+	shard := client.shard(seq)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 	//根据seq移除调用
-	call := client.pending[seq] //当没有要处理的Call请求
-	delete(client.pending, seq) //将map中key为seq从pending删除
-	return call                 //返回对应调用call
+	call := shard.calls[seq] //当没有要处理的Call请求
+	delete(shard.calls, seq) //将map中key为seq从pending删除
+	return call              //返回对应调用call
 }
 
 /*
 *
-CS发生错误时调用，shutdown改成true，并将错误信息通知所有pending状态的call
+CS发生错误时调用，进入 Closed 状态，并将错误信息通知所有pending状态的call
 保证数据传输时CS都正常
 */
 func (client *Client) terminateCalls(err error) {
@@ -120,12 +281,21 @@ func (client *Client) terminateCalls(err error) {
 	client.sending.Lock()
 	defer client.sending.Unlock()
 	client.mu.Lock()
-	defer client.mu.Unlock()
-	client.shutdown = true
-	//遍历pending，一个map，不要索引
-	for _, call := range client.pending {
-		call.Error = err //若为空，则设置为nil
-		call.done()      //通知，结束client
+	client.setState(ClientClosed, err)
+	client.checkDrained()
+	client.mu.Unlock()
+	//遍历pending的每个分片
+	for i := range client.pending {
+		shard := &client.pending[i]
+		shard.mu.Lock()
+		calls := shard.calls
+		shard.calls = make(map[uint64]*Call)
+		shard.mu.Unlock()
+		for _, call := range calls {
+			call.Error = err      //若为空，则设置为nil
+			client.complete(call) //通知，结束client
+			atomic.AddInt64(&client.inflight, -1)
+		}
 	}
 }
 
@@ -144,6 +314,11 @@ func (client *Client) receive() {
 		if err = client.cc.ReadHeader(&h); err != nil {
 			break
 		}
+		//服务端的回调请求
+		if h.Callback {
+			err = client.serveCallback(&h)
+			continue
+		}
 		//正在处理这个Call调用，需要先从将执行的Call map中移除
 		call := client.removeCall(h.Seq)
 		switch {
@@ -151,21 +326,34 @@ func (client *Client) receive() {
 			//常用于Write函数部分错误，call已经被移除
 			//不存在map中
 			err = client.cc.ReadBody(nil) //call为空说明，没有待rpc调用的请求
+			if err == nil {
+				err = client.strayReply(&h)
+			}
 		case h.Error != "":
-			call.Error = fmt.Errorf(h.Error)
+			call.Error = parseServerError(h.Error)
+			client.observeReply(call.Error)
 			err = client.cc.ReadBody(nil)
-			call.done() //用于调用下一个Call
+			client.complete(call) //用于调用下一个Call
 		default:
-			//读响应体，放在调用call的Reply结构
-			err = client.cc.ReadBody(call.Reply)
+			client.observeReply(nil)
+			//读响应体，放在调用call的Reply结构；响应体带类型标签时按标签解码
+			err = readTypedBody(client.cc, h.BodyType, call.Reply)
 			//解码读请求体出错
 			if err != nil {
-				call.Error = errors.New("reading body " + err.Error())
+				call.Error = fmt.Errorf("reading body %w", err)
 			}
-			call.done()
+			//响应体已经完整读出只是解码失败，只影响这一个调用，连接继续使用
+			var de *codec.DecodeError
+			if errors.As(err, &de) {
+				err = nil
+			}
+			client.complete(call)
+		}
+		//响应体读完后才算完成，避免优雅关闭提前关闭连接
+		if call != nil {
+			client.callFinished()
 		}
 	}
-	log.Println("me!")
 	//服务端或客户端错误发生了，被动关闭RPC相关调用
 	client.terminateCalls(err)
 }
@@ -174,61 +362,70 @@ func (client *Client) receive() {
 新建客户端，前面Dial检验了Option，地址，然后通过Option找编解码器，如果合适，就进行编码opt
 */
 func NewClient(conn net.Conn, opt *Option) (*Client, error) {
-	f := codec.NewCodecFuncMap[opt.CodecType] //协商协议找对应编解码器的具体实现
+	notifyDialState(opt, ClientIdle, ClientConnecting, nil)
+	return connectClient(conn, opt)
+}
+
+// 在建立好的连接上握手，失败时通知 Closed
+func connectClient(conn net.Conn, opt *Option) (*Client, error) {
+	f, err := codecFunc(opt.Codecs, opt) //协商协议找对应编解码器的具体实现
 	//不存在对应编解码器
-	if f == nil {
-		err := fmt.Errorf("invalid codec type %s", opt.CodecType)
+	if err != nil {
 		log.Println("rpc client:codec error: ", err)
+		notifyDialState(opt, ClientConnecting, ClientClosed, err)
 		return nil, err
 	}
+	opt = withIdentity(opt)
+	//总是接受回调：发布/订阅的推送也是回调，没有提供 Callbacks 时其他回调返回错误
+	opt.Flags |= FlagCallbacks
+	stats := new(clientStats)
+	cconn := &countingConn{ReadWriteCloser: conn, stats: stats}
 	//发送options
-	if err := json.NewEncoder(conn).Encode(opt); err != nil {
+	if err := WriteHandshake(cconn, opt); err != nil {
 		log.Println("rpc client:options error: ", err)
 		_ = conn.Close()
+		notifyDialState(opt, ClientConnecting, ClientClosed, err)
 		return nil, err
 	}
+	var rwc io.ReadWriteCloser = cconn
+	if opt.BatchDelay > 0 {
+		rwc = newBatchConn(cconn, opt.BatchDelay, opt.BatchSize)
+	}
 	//f为需要的编解码器构造函数
-	return newClientCodec(f(conn), opt), nil
+	return newClientCodec(f(rwc), opt, stats), nil
 }
 
-func newClientCodec(cc codec.Codec, opt *Option) *Client {
+// stats 为 nil 时不统计读写字节数
+func newClientCodec(cc codec.Codec, opt *Option, stats *clientStats) *Client {
+	if stats == nil {
+		stats = new(clientStats)
+	}
 	client := &Client{
-		seq:     1, //从1开始，0意味着invalid call
-		cc:      cc,
-		opt:     opt,
-		pending: make(map[uint64]*Call),
+		seq:   1, //从1开始，0意味着invalid call
+		cc:    cc,
+		opt:   opt,
+		stats: stats,
+	}
+	for i := range client.pending {
+		client.pending[i].calls = make(map[uint64]*Call)
 	}
+	client.state.Store(int32(ClientConnecting))
+	client.mu.Lock()
+	client.setState(ClientReady, nil)
+	client.mu.Unlock()
 	go client.receive() //协程调用接收响应
 	return client
 }
 
-// 解析Options，通过...*Option 实现可选参数,其实就是[]*Option,变成slice
-func parseOptions(opts ...*Option) (*Option, error) {
-	//opts is nil 或者让nil作为参数,opt一般是第一个信息
-	if len(opts) == 0 || opts[0] == nil {
-		return DefaultOption, nil
-	}
-	if len(opts) != 1 {
-		return nil, errors.New("number of options is more than 1")
-	}
-	opt := opts[0]                              //第一个值
-	opt.MagicNumber = DefaultOption.MagicNumber //是否是RPC调用
-	if opt.CodecType == "" {
-		opt.CodecType = DefaultOption.CodecType //若类型为空则以默认调用
-	}
-	return opt, nil
-}
-
 /*
 用户传入服务端地址，创建Client实例，简化调用，创建完整的连接，调用接收响应
 */
-func Dial(network, address string, opts ...*Option) (client *Client, err error) {
-	opt, err := parseOptions(opts...)
-	if err != nil {
-		return nil, err //opt错误
-	}
-	conn, err := net.Dial(network, address)
+func Dial(network, address string, opts ...DialOption) (client *Client, err error) {
+	opt := parseOptions(opts...)
+	notifyDialState(opt, ClientIdle, ClientConnecting, nil)
+	conn, err := dialConn(network, address, opt)
 	if err != nil {
+		notifyDialState(opt, ClientConnecting, ClientClosed, err)
 		return nil, err //来凝结错误
 	}
 	//出现错误，关闭连接
@@ -237,7 +434,71 @@ func Dial(network, address string, opts ...*Option) (client *Client, err error)
 			_ = conn.Close() //服务器不存在，当然断开连接
 		}
 	}()
-	return NewClient(conn, opt)
+	//握手同样受连接超时时间的限制
+	if opt.ConnectTimeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(opt.ConnectTimeout))
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+	return connectClient(conn, opt)
+}
+
+// 按 Option 建立连接，设置了 TLSConfig 时进行 TLS 握手
+func dialConn(network, address string, opt *Option) (net.Conn, error) {
+	ctx := context.Background()
+	if opt.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opt.ConnectTimeout)
+		defer cancel()
+	}
+	var conn net.Conn
+	var err error
+	if opt.Dialer != nil {
+		conn, err = opt.Dialer(ctx, network, address)
+	} else {
+		conn, err = dialRace(ctx, network, address, opt.DialStagger)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := opt.TCP.apply(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if opt.TLSConfig != nil {
+		//与 tls.Dial 相同，没有设置 ServerName 时使用地址中的主机名
+		config := opt.TLSConfig
+		if config.ServerName == "" {
+			host, _, _ := net.SplitHostPort(address)
+			config = config.Clone()
+			config.ServerName = host
+		}
+		tc := tls.Client(conn, config)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	if opt.OnConnect != nil {
+		if err := opt.OnConnect(conn); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+/*
+根据 protocol@addr 格式的地址建立连接，如 tcp@127.0.0.1:9999、unix@/tmp/geerpc.sock
+供负载均衡的客户端使用
+*/
+func XDial(rpcAddr string, opts ...DialOption) (*Client, error) {
+	parts := strings.SplitN(rpcAddr, "@", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
+	}
+	protocol, addr := parts[0], parts[1]
+	return Dial(protocol, addr, opts...)
 }
 
 /*
@@ -245,6 +506,10 @@ func Dial(network, address string, opts ...*Option) (client *Client, err error)
 发送请求
 */
 func (client *Client) send(call *Call) {
+	call.ensureRequestID()
+	if client.injectFault(call) {
+		return
+	}
 	//发送完整的请求，需要利用到互斥锁
 	client.sending.Lock()
 	defer client.sending.Unlock()
@@ -253,7 +518,7 @@ func (client *Client) send(call *Call) {
 	seq, err := client.registerCall(call) //call放在map，且通过函数获得seq
 	if err != nil {
 		call.Error = err
-		call.done() //能到这
+		client.complete(call) //能到这
 		return
 	}
 
@@ -263,17 +528,31 @@ func (client *Client) send(call *Call) {
 	client.header.ServiceMethod = call.ServiceMethod
 	client.header.Seq = seq
 	client.header.Error = "" //默认错误为空字符串
+	client.header.Version = client.opt.Version
+	if call.version != "" {
+		client.header.Version = call.version
+	}
+	client.header.Priority = call.priority
+	client.header.Meta = call.meta
+	var args interface{}
+	client.header.BodyType, args = taggedBody(call.Args)
+	client.header.Deadline = 0
+	if !call.deadline.IsZero() {
+		client.header.Deadline = call.deadline.UnixNano()
+	}
 
 	/**
 	编码和发送请求
 	*/
-	if err := client.cc.Write(&client.header, call.Args); err != nil {
+	if err := client.cc.Write(&client.header, args); err != nil {
 		call := client.removeCall(seq) //没有错误，不调用
 		//call可能是nil，如果发生写错误
 		//客户端还是需要接收响应并处理
 		if call != nil {
+			client.abandoned.add(seq)
 			call.Error = err
-			call.done() //通知调用方
+			client.complete(call) //通知调用方
+			client.callFinished()
 		}
 	}
 }
@@ -282,31 +561,148 @@ func (client *Client) send(call *Call) {
 Go和Call是暴露给user的两个RPC服务调用接口，Go异步接口，返回call实例
 */
 
-func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
-	//异步rpc调用函数，它返回调用Call指针，代表它的invocation调用
-	//异步接口
-	if done == nil {
-		//初始化，并发为10
-		done = make(chan *Call, 10)
-	} else if cap(done) == 0 {
-		//done通道无缓存
-		log.Panic("rpc client:done channel is unbuffered")
-	}
-
+// 根据调用选项创建 Call，截止时间按 clock 计算
+func newCall(serviceMethod string, args, reply interface{}, done chan *Call, o *callOptions, clock Clock) *Call {
 	call := &Call{
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		Reply:         reply,
 		Done:          done,
+		priority:      o.priority,
+		meta:          o.meta,
+		version:       o.version,
+	}
+	if o.timeout > 0 {
+		call.deadline = clockOrReal(clock).Now().Add(o.timeout)
+	}
+	return call
+}
+
+func (client *Client) Go(serviceMethod string, args, reply interface{}, done chan *Call, opts ...CallOption) *Call {
+	//异步rpc调用函数，它返回调用Call指针，代表它的invocation调用
+	//异步接口
+	if done == nil {
+		//初始化，默认并发为10
+		size := client.opt.DoneBuffer
+		if size <= 0 {
+			size = defaultDoneBuffer
+		}
+		done = make(chan *Call, size)
 	}
+	//done通道无缓存时在单独的 goroutine 中通知
+
+	o := newCallOptions(opts)
+	call := newCall(serviceMethod, args, reply, done, o, client.opt.Clock)
+	call.policy = client.opt.DonePolicy
 	//根据call去send
 	client.send(call)
+	if o.timeout > 0 {
+		//超时后放弃调用，调用完成时停止定时器
+		call.setTimer(clockOrReal(client.opt.Clock).AfterFunc(o.timeout, func() {
+			client.cancel(call, fmt.Errorf("rpc client: call timeout: expect within %s", o.timeout))
+		}))
+	}
 	return call
 }
 
-func (client *Client) Call(serviceMethod string, args, reply interface{}) error {
+func (client *Client) Call(serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	return client.through(context.Background(), serviceMethod, args, reply, opts, func() error {
+		return client.call(serviceMethod, args, reply, opts...)
+	})
+}
+
+func (client *Client) call(serviceMethod string, args, reply interface{}, opts ...CallOption) error {
 	//调用有名函数，等到他完成，并返回它的错误状态，是对Go的封装，阻塞call.Done，等待响应返回，一个同步接口
 	//call := <-client.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done //先处理内部再处理外部
-	call := <-client.Go(serviceMethod, args, reply, nil).Done
+	call := <-client.Go(serviceMethod, args, reply, nil, opts...).Done
 	return call.Error
 }
+
+/*
+带 context 的同步调用，ctx 被取消或超时后放弃这次调用，并通知服务端停止处理
+ctx 的截止时间会放在请求头中，服务端处理时的 context 带有同样的截止时间
+*/
+func (client *Client) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	return client.through(ctx, serviceMethod, args, reply, opts, func() error {
+		return client.callContext(ctx, serviceMethod, args, reply, opts...)
+	})
+}
+
+// 同步调用依次经过响应缓存和调用合并，都没有开启时直接调用 call
+func (client *Client) through(ctx context.Context, serviceMethod string, args, reply interface{}, opts []CallOption, call func() error) error {
+	if g := client.coalesce.Load(); g != nil {
+		next := call
+		call = func() error { return g.Do(ctx, serviceMethod, args, reply, opts, next) }
+	}
+	if cache := client.cache.Load(); cache != nil {
+		return cache.Do(ctx, serviceMethod, args, reply, opts, call)
+	}
+	return call()
+}
+
+func (client *Client) callContext(ctx context.Context, serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	o := newCallOptions(opts)
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = WithClockTimeout(ctx, client.opt.Clock, o.timeout)
+		defer cancel()
+	}
+	call := newCall(serviceMethod, args, reply, make(chan *Call, 1), o, client.opt.Clock)
+	if deadline, ok := ctx.Deadline(); ok {
+		call.deadline = deadline
+	}
+	//在服务方法中发起的调用沿用当前请求的 ID 和链路追踪上下文
+	call.RequestID = RequestIDFromContext(ctx)
+	if tp := TraceParentFromContext(ctx); tp != "" && call.meta[TraceParentMeta] == "" {
+		if call.meta == nil {
+			call.meta = make(map[string]string, 1)
+		}
+		call.meta[TraceParentMeta] = tp
+	}
+	client.send(call)
+	select {
+	case <-ctx.Done():
+		if client.cancel(call, ctx.Err()) {
+			return fmt.Errorf("rpc client: call failed: %w", ctx.Err())
+		}
+		//取消前调用已经完成
+		call = <-call.Done
+		return call.Error
+	case call := <-call.Done:
+		return call.Error
+	}
+}
+
+/*
+放弃一个通过 Go 发起的调用：call.Error 设为 ErrCallCanceled 并通知 Done，同时通知服务端停止处理
+调用已经完成时返回 false
+*/
+func (client *Client) Cancel(call *Call) bool {
+	return client.cancel(call, ErrCallCanceled)
+}
+
+func (client *Client) cancel(call *Call, err error) bool {
+	//先从pending移除，之后收到的响应会被丢弃
+	if client.removeCall(call.Seq) == nil {
+		return false
+	}
+	client.abandoned.add(call.Seq)
+	call.Error = err
+	client.complete(call)
+	client.sendCancel(call.Seq)
+	client.callFinished()
+	return true
+}
+
+// 发送取消消息，请求体为空
+func (client *Client) sendCancel(seq uint64) {
+	client.sending.Lock()
+	defer client.sending.Unlock()
+	if !client.IsAvailable() {
+		return
+	}
+	h := codec.Header{ServiceMethod: CancelServiceMethod, Seq: seq}
+	if err := client.cc.Write(&h, invalidRequest); err != nil {
+		log.Println("rpc client: send cancel error:", err)
+	}
+}
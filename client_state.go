@@ -0,0 +1,219 @@
+package geerpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+/**
+ * 客户端连接状态
+ *
+ * 客户端在以下状态之间变化，State 返回当前状态：
+ *   Idle ──Dial──▶ Connecting ──握手完成──▶ Ready ◀──▶ Degraded
+ *                      │                     │           │
+ *                      │                 Shutdown     Shutdown
+ *                      │                     ▼           ▼
+ *                      └──失败──▶ Closed ◀── Draining ◀──┘
+ * Ready 和 Degraded 时可以发起调用；服务端返回过载或正在排空时进入 Degraded，之后收到其他响应时恢复为 Ready
+ * 任何状态下调用 Close 或连接出错都进入 Closed，连接出错时 StateChange.Err 为出错的原因
+ *
+ * 状态变化按发生的顺序在单独的 goroutine 中通知，有三种方式：
+ *   Option.OnStateChange  从 Dial 开始通知，包括建立连接和握手的过程
+ *   SetStateCallback      客户端创建之后设置的回调
+ *   WatchState            返回一个通道，适合在 select 中使用：
+ *     changes, stop := client.WatchState()
+ *     defer stop()
+ *     for c := range changes {
+ *         log.Printf("rpc client: %s -> %s (%v)", c.From, c.To, c.Err)
+ *     }
+ */
+
+type ClientState int32
+
+const (
+	ClientIdle       ClientState = iota //还没有开始建立连接
+	ClientConnecting                    //正在建立连接和握手
+	ClientReady                         //可用
+	ClientDegraded                      //可用，但服务端过载或正在排空
+	ClientDraining                      //优雅关闭中，不再接受新的调用，等待已发出的调用完成
+	ClientClosed                        //已关闭，调用 Close 或者连接出错
+)
+
+// Deprecated: 连接出错时同样进入 ClientClosed，出错的原因见 StateChange.Err
+const ClientShutdown = ClientClosed
+
+func (s ClientState) String() string {
+	switch s {
+	case ClientIdle:
+		return "idle"
+	case ClientConnecting:
+		return "connecting"
+	case ClientReady:
+		return "ready"
+	case ClientDegraded:
+		return "degraded"
+	case ClientDraining:
+		return "draining"
+	case ClientClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// 一次状态变化
+type StateChange struct {
+	From ClientState
+	To   ClientState
+	Err  error //导致这次变化的错误，如连接出错、服务端过载，没有时为nil
+	Time time.Time
+}
+
+// WatchState 返回的通道的容量，来不及读取的通知会被丢弃，State 总是返回最新的状态
+const stateWatchBuffer = 16
+
+// 状态变化的订阅者，通知在单独的 goroutine 中按顺序发出
+type stateWatchers struct {
+	mu       sync.Mutex
+	callback func(ClientState, error)
+	chans    map[chan StateChange]struct{}
+	queue    []StateChange //还没有通知的状态变化
+	running  bool          //通知 goroutine 正在运行
+	closed   bool          //已经进入 Closed，通知完后关闭所有通道
+}
+
+// 当前状态
+func (client *Client) State() ClientState {
+	return ClientState(client.state.Load())
+}
+
+// 设置状态变化的回调，err 为导致这次变化的错误
+func (client *Client) SetStateCallback(fn func(state ClientState, err error)) {
+	w := &client.watchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = fn
+}
+
+/**
+ * 订阅状态变化，返回的通道在客户端关闭并通知完 Closed 后关闭，stop 取消订阅并关闭通道
+ * 通道满时丢弃新的通知，不会阻塞客户端
+ */
+func (client *Client) WatchState() (<-chan StateChange, func()) {
+	w := &client.watchers
+	ch := make(chan StateChange, stateWatchBuffer)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed && !w.running && len(w.queue) == 0 {
+		close(ch)
+		return ch, func() {}
+	}
+	if w.chans == nil {
+		w.chans = make(map[chan StateChange]struct{})
+	}
+	w.chans[ch] = struct{}{}
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if _, ok := w.chans[ch]; ok {
+				delete(w.chans, ch)
+				close(ch)
+			}
+		})
+	}
+}
+
+/**
+ * 变为 to 状态，调用时需要持有 mu；状态没有变化或者已经关闭时返回 false
+ * 第一次进入 Closed 时调用 Option.OnDisconnect
+ */
+func (client *Client) setState(to ClientState, err error) bool {
+	from := client.State()
+	if from == to || from == ClientClosed {
+		return false
+	}
+	client.state.Store(int32(to))
+	client.watchers.publish(client.opt, StateChange{From: from, To: to, Err: err, Time: clockOrReal(client.opt.Clock).Now()})
+	if to == ClientClosed && client.opt.OnDisconnect != nil {
+		go client.opt.OnDisconnect(err)
+	}
+	return true
+}
+
+func (w *stateWatchers) publish(opt *Option, c StateChange) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.queue = append(w.queue, c)
+	if c.To == ClientClosed {
+		w.closed = true
+	}
+	if !w.running {
+		w.running = true
+		go w.run(opt.OnStateChange)
+	}
+}
+
+// 按顺序通知，队列为空时退出，客户端关闭后关闭所有通道
+func (w *stateWatchers) run(onChange func(StateChange)) {
+	w.mu.Lock()
+	for len(w.queue) > 0 {
+		c := w.queue[0]
+		w.queue = w.queue[1:]
+		fn := w.callback
+		for ch := range w.chans {
+			select {
+			case ch <- c:
+			default:
+			}
+		}
+		w.mu.Unlock()
+		if onChange != nil {
+			onChange(c)
+		}
+		if fn != nil {
+			fn(c.To, c.Err)
+		}
+		w.mu.Lock()
+	}
+	w.running = false
+	if w.closed {
+		for ch := range w.chans {
+			close(ch)
+		}
+		w.chans = nil
+	}
+	w.mu.Unlock()
+}
+
+// 客户端还没有创建时（建立连接和握手期间）的状态变化，直接通知 Option.OnStateChange
+func notifyDialState(opt *Option, from, to ClientState, err error) {
+	if opt.OnStateChange != nil {
+		opt.OnStateChange(StateChange{From: from, To: to, Err: err, Time: clockOrReal(opt.Clock).Now()})
+	}
+}
+
+// 服务端过载或正在排空，连接本身是好的
+func isDegradedError(err error) bool {
+	var overloaded *OverloadedError
+	return errors.As(err, &overloaded) || err == ServerError(ErrServerDraining.Error())
+}
+
+// 按响应的错误在 Ready 和 Degraded 之间切换，状态没有变化时不加锁
+func (client *Client) observeReply(err error) {
+	to := ClientReady
+	if isDegradedError(err) {
+		to = ClientDegraded
+	} else {
+		err = nil
+	}
+	if from := client.State(); from == to || from != ClientReady && from != ClientDegraded {
+		return
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if from := client.State(); from == ClientReady || from == ClientDegraded {
+		client.setState(to, err)
+	}
+}
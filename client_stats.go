@@ -0,0 +1,95 @@
+package geerpc
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 客户端统计
+ *
+ * Stats 返回客户端当前的统计数据，应用可以据此导出 RPC 客户端的健康状况
+ * 客户端的连接状态见 client_state.go
+ */
+
+type ClientStats struct {
+	Inflight         int       //等待响应的调用数
+	Calls            uint64    //发出的调用总数
+	Errors           uint64    //失败的调用数
+	Reconnects       uint64    //通过 Resume 恢复会话的次数
+	Coalesced        uint64    //被合并、没有发送请求的调用数
+	Rejected         uint64    //等待响应的调用数达到上限被拒绝的调用数，见 Option.MaxPending
+	LateReplies      uint64    //调用结束后才到达的响应数，见 stray.go
+	DuplicateReplies uint64    //重复的响应数
+	UnknownReplies   uint64    //编号从未发出过的响应数
+	BytesSent        uint64    //发送的字节数，包括握手
+	BytesReceived    uint64    //接收的字节数
+	LastError        string    //最近一次调用失败的错误
+	LastErrorTime    time.Time //最近一次调用失败的时间
+}
+
+type clientStats struct {
+	calls, errors, reconnects uint64
+	rejected                  uint64 //超过 Option.MaxPending 被拒绝的调用
+	late, duplicate, unknown  uint64 //找不到调用的响应，见 stray.go
+	sent, received            uint64
+	mu                        sync.Mutex //保护以下字段
+	lastErr                   string
+	lastErrTime               time.Time
+	onStray                   func(StrayReply) error
+}
+
+// 统计读写字节数的连接
+type countingConn struct {
+	io.ReadWriteCloser
+	stats *clientStats
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddUint64(&c.stats.received, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.stats.sent, uint64(n))
+	return n, err
+}
+
+func (client *Client) Stats() ClientStats {
+	inflight := int(atomic.LoadInt64(&client.inflight))
+	st := client.stats
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return ClientStats{
+		Inflight:         inflight,
+		Calls:            atomic.LoadUint64(&st.calls),
+		Errors:           atomic.LoadUint64(&st.errors),
+		Reconnects:       atomic.LoadUint64(&st.reconnects),
+		Coalesced:        client.coalesce.Load().Coalesced(),
+		Rejected:         atomic.LoadUint64(&st.rejected),
+		LateReplies:      atomic.LoadUint64(&st.late),
+		DuplicateReplies: atomic.LoadUint64(&st.duplicate),
+		UnknownReplies:   atomic.LoadUint64(&st.unknown),
+		BytesSent:        atomic.LoadUint64(&st.sent),
+		BytesReceived:    atomic.LoadUint64(&st.received),
+		LastError:        st.lastErr,
+		LastErrorTime:    st.lastErrTime,
+	}
+}
+
+// 调用结束：统计错误并通知调用方
+func (client *Client) complete(call *Call) {
+	call.stopTimer()
+	if call.Error != nil {
+		atomic.AddUint64(&client.stats.errors, 1)
+		client.stats.mu.Lock()
+		client.stats.lastErr = call.Error.Error()
+		client.stats.lastErrTime = time.Now()
+		client.stats.mu.Unlock()
+	}
+	call.done()
+}
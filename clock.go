@@ -0,0 +1,157 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/**
+ * 时间源
+ *
+ * 超时、心跳和重试退避都通过 Clock 获取时间和创建定时器，默认为真实时间 RealClock，
+ * 测试中可以换成假时钟（见 rpctest.FakeClock），手动推进时间，不需要真的等待：
+ *   clock := rpctest.NewFakeClock(time.Now())
+ *   client, _ := geerpc.Dial("tcp", addr, geerpc.WithClock(clock))
+ *   call := client.Go("Foo.Sleep", args, &reply, nil, geerpc.WithTimeout(time.Second))
+ *   clock.BlockUntil(1)            //等调用的超时定时器创建
+ *   clock.Advance(time.Second)     //调用立即以超时结束
+ * 使用 Clock 的地方：
+ *   客户端  调用超时（WithTimeout），自动重连的等待时间和退避间隔，XClient 的重试等待和请求对冲
+ *   服务端  处理超时（WithHandleTimeout、MethodOption.Timeout），连接关闭时等待请求的时间
+ *   注册中心 心跳间隔和实例过期
+ * 请求头中的截止时间同样按 Clock 计算，服务端按自己的 Clock 比较，测试中两端要使用同一个假时钟
+ * （如 server.NewLocalClient 或同一进程中的服务端都设置这个时钟）；
+ * 网络连接的读写超时（如 ConnectTimeout、握手超时）由操作系统计时，不受 Clock 影响
+ */
+
+type Clock interface {
+	Now() time.Time
+	// 创建定时器，d 之后向 C() 发送当时的时间
+	NewTimer(d time.Duration) Timer
+	// d 之后调用 f，返回的 Timer 的 C() 为nil
+	AfterFunc(d time.Duration, f func()) Timer
+	// 创建周期为 d 的定时器
+	NewTicker(d time.Duration) Ticker
+}
+
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool //定时器还没有触发时返回 true
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// 真实时间，即 time 包
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return realTimer{time.AfterFunc(d, f)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// 为nil时使用 RealClock
+func clockOrReal(c Clock) Clock {
+	if c == nil {
+		return RealClock
+	}
+	return c
+}
+
+// 等待 d，ctx 先结束时返回 false
+func Sleep(ctx context.Context, clock Clock, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := clockOrReal(clock).NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// 同 context.WithTimeout，按 clock 计时；clock 为真实时间时就是 context.WithTimeout
+func WithClockTimeout(parent context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	clock = clockOrReal(clock)
+	if _, ok := clock.(realClock); ok {
+		return context.WithTimeout(parent, d)
+	}
+	//截止时间会随服务方法发起的调用发给对端，与请求头中的截止时间一样按 clock 计算
+	deadline := clock.Now().Add(d)
+	if dl, ok := parent.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	cctx, cancel := context.WithCancel(parent)
+	ctx := &clockCtx{Context: cctx, deadline: deadline}
+	t := clock.AfterFunc(d, func() {
+		ctx.mu.Lock()
+		if ctx.err == nil && cctx.Err() == nil {
+			ctx.err = context.DeadlineExceeded
+		}
+		ctx.mu.Unlock()
+		cancel()
+	})
+	return ctx, func() {
+		t.Stop()
+		cancel()
+	}
+}
+
+// 按 Clock 计时的 context，计时结束时 Err 返回 context.DeadlineExceeded
+type clockCtx struct {
+	context.Context
+	deadline time.Time
+	mu       sync.Mutex
+	err      error //计时结束时设置，先于取消
+}
+
+func (c *clockCtx) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func (c *clockCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.Context.Err()
+}
+
+// 同 SetClock
+func WithServerClock(c Clock) ServerOption {
+	return func(server *Server) {
+		server.SetClock(c)
+	}
+}
+
+// 设置服务端的时间源，为nil时使用 RealClock，需要在 Accept 之前调用
+func (server *Server) SetClock(c Clock) {
+	server.clock = c
+}
+
+// 设置客户端的时间源，见 Option.Clock
+func WithClock(c Clock) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.Clock = c
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"geerpc"
+	"geerpc/codec"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 压测工具，按指定的并发数、请求大小、编解码器和时长压测服务端，输出吞吐量和延迟分位数：
+ *   tinyrpc-bench -c 64 -size 1024 -codec application/cbor -d 10s            //压测内置的 Echo 服务
+ *   tinyrpc-bench -serve -listen :9999                                       //只启动 Echo 服务
+ *   tinyrpc-bench -addr host:9999 -c 64 -d 30s                               //压测远端的 Echo 服务
+ * 没有指定 -addr 时在本进程的回环地址上启动 Echo 服务，作为基准；
+ * -method 可以压测其他方法，参数为 []byte，响应为 *[]byte
+ */
+
+// 内置的 Echo 服务，原样返回参数
+type Echo struct{}
+
+func (Echo) Echo(args []byte, reply *[]byte) error {
+	*reply = args
+	return nil
+}
+
+// 一个连接上的压测结果
+type result struct {
+	latencies []time.Duration
+	errors    uint64
+}
+
+func main() {
+	addr := flag.String("addr", "", "server address, empty to benchmark a built-in echo server on loopback")
+	serve := flag.Bool("serve", false, "only run the echo server")
+	listen := flag.String("listen", "127.0.0.1:0", "listen address of the echo server")
+	method := flag.String("method", "Echo.Echo", "method to call, args []byte and reply *[]byte")
+	conns := flag.Int("conns", 1, "number of connections, callers are spread over them")
+	concurrency := flag.Int("c", 16, "number of concurrent callers")
+	size := flag.Int("size", 128, "payload size in bytes")
+	codecType := flag.String("codec", string(codec.GobType), "codec type")
+	duration := flag.Duration("d", 10*time.Second, "benchmark duration")
+	flag.Parse()
+
+	if *serve || *addr == "" {
+		l, err := startEcho(*listen)
+		if err != nil {
+			log.Fatal("tinyrpc-bench: ", err)
+		}
+		if *serve {
+			log.Printf("tinyrpc-bench: echo server listening on %s", l.Addr())
+			select {}
+		}
+		*addr = l.Addr().String()
+	}
+	if *conns <= 0 || *concurrency <= 0 {
+		log.Fatal("tinyrpc-bench: -conns and -c must be positive")
+	}
+
+	clients := make([]*geerpc.Client, *conns)
+	for i := range clients {
+		client, err := geerpc.Dial("tcp", *addr, &geerpc.Option{CodecType: codec.Type(*codecType)})
+		if err != nil {
+			log.Fatal("tinyrpc-bench: ", err)
+		}
+		defer func() { _ = client.Close() }()
+		clients[i] = client
+	}
+
+	payload := make([]byte, *size)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	results := make([]result, *concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, r := clients[i%len(clients)], &results[i]
+			var reply []byte
+			for ctx.Err() == nil {
+				t := time.Now()
+				err := client.CallContext(ctx, *method, payload, &reply)
+				if ctx.Err() != nil {
+					return //压测结束时被取消的请求不计入
+				}
+				if err != nil {
+					atomic.AddUint64(&r.errors, 1)
+					continue
+				}
+				r.latencies = append(r.latencies, time.Since(t))
+			}
+		}(i)
+	}
+	wg.Wait()
+	report(results, time.Since(start), *size)
+}
+
+// 在 addr 上启动 Echo 服务
+func startEcho(addr string) (net.Listener, error) {
+	server := geerpc.NewServer()
+	if err := server.Register(Echo{}); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() { _ = server.Accept(l) }()
+	return l, nil
+}
+
+func report(results []result, elapsed time.Duration, size int) {
+	var all []time.Duration
+	var errs uint64
+	for _, r := range results {
+		all = append(all, r.latencies...)
+		errs += r.errors
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	n := len(all)
+	secs := elapsed.Seconds()
+	fmt.Printf("requests:   %d ok, %d errors in %s\n", n, errs, elapsed.Round(time.Millisecond))
+	fmt.Printf("throughput: %.0f req/s, %.2f MB/s\n", float64(n)/secs, float64(n)*float64(size)*2/secs/(1<<20))
+	if n == 0 {
+		os.Exit(1)
+	}
+	var sum time.Duration
+	for _, d := range all {
+		sum += d
+	}
+	percentile := func(p float64) time.Duration { return all[int(p*float64(n-1))] }
+	fmt.Printf("latency:    avg %s, p50 %s, p90 %s, p99 %s, p99.9 %s, max %s\n",
+		sum/time.Duration(n), percentile(0.5), percentile(0.9), percentile(0.99), percentile(0.999), all[n-1])
+}
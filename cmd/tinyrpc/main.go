@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"geerpc"
+	"geerpc/codec"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+/**
+ * 命令行客户端，类似 grpcurl，用于调试：
+ *   tinyrpc -addr localhost:9999 list
+ *   tinyrpc -addr localhost:9999 describe Foo
+ *   tinyrpc -addr localhost:9999 call Foo.Sum '{"Num1": 1, "Num2": 2}'
+ *   echo '{"Num1": 1}' | tinyrpc -addr localhost:9999 call Foo.Sum -
+ * 使用 JSON 编解码器，参数和响应都是 JSON；list 和 describe 需要服务端调用 EnableReflection
+ */
+
+// 可以重复的 -H key=value 参数
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m metadataFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("metadata must be key=value, got %q", s)
+	}
+	m[k] = v
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: tinyrpc [flags] <command>
+
+commands:
+  list                              list services
+  describe <Service>                show methods and argument types of a service
+  call <Service.Method> [json|-]    call a method, arguments from the command line or stdin
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:9999", "server address, protocol@addr is also accepted (e.g. unix@/tmp/rpc.sock)")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of the whole command")
+	version := flag.String("version", "", "service version to call")
+	indent := flag.Bool("indent", true, "pretty-print the JSON reply")
+	md := metadataFlag{}
+	flag.Var(md, "H", "request metadata key=value, can be repeated")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	rpcAddr := *addr
+	if !strings.Contains(rpcAddr, "@") {
+		rpcAddr = "tcp@" + rpcAddr
+	}
+	client, err := geerpc.XDial(rpcAddr, &geerpc.Option{CodecType: codec.JsonType, Version: *version})
+	if err != nil {
+		fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	var opts []geerpc.CallOption
+	for k, v := range md {
+		opts = append(opts, geerpc.WithMetadata(k, v))
+	}
+	args := flag.Args()
+	switch args[0] {
+	case "list":
+		var names []string
+		if err = client.CallContext(ctx, geerpc.ReflectionServiceName+".List", struct{}{}, &names, opts...); err != nil {
+			fatal(err)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "describe":
+		if len(args) != 2 {
+			usage()
+			os.Exit(2)
+		}
+		var info geerpc.ServiceInfo
+		if err = client.CallContext(ctx, geerpc.ReflectionServiceName+".Describe", args[1], &info, opts...); err != nil {
+			fatal(err)
+		}
+		describe(&info)
+	case "call":
+		if len(args) < 2 || len(args) > 3 {
+			usage()
+			os.Exit(2)
+		}
+		body, err := readArgs(args[2:])
+		if err != nil {
+			fatal(err)
+		}
+		var reply json.RawMessage
+		if err = client.CallContext(ctx, args[1], body, &reply, opts...); err != nil {
+			fatal(err)
+		}
+		printJSON(reply, *indent)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// 调用的参数：命令行中的 JSON，"-" 表示从标准输入读取，没有时为 null（参数的零值）
+func readArgs(args []string) (json.RawMessage, error) {
+	if len(args) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	data := []byte(args[0])
+	if args[0] == "-" {
+		var err error
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, err
+		}
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("arguments are not valid JSON: %s", data)
+	}
+	return data, nil
+}
+
+func describe(info *geerpc.ServiceInfo) {
+	fmt.Printf("service %s\n", info.Name)
+	for _, m := range info.Methods {
+		fmt.Printf("  %s(%s) %s\n", m.Name, m.ArgType, m.ReplyType)
+		fmt.Printf("    args:  %s\n", m.ArgSchema)
+		fmt.Printf("    reply: %s\n", m.ReplySchema)
+	}
+	if info.Components != "{}" {
+		fmt.Println("types:")
+		printJSON(json.RawMessage(info.Components), true)
+	}
+}
+
+func printJSON(data json.RawMessage, indent bool) {
+	if indent {
+		var buf bytes.Buffer
+		if json.Indent(&buf, data, "", "  ") == nil {
+			data = buf.Bytes()
+		}
+	}
+	fmt.Println(string(data))
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "tinyrpc:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,111 @@
+package geerpc
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ * 合并并发的相同调用
+ *
+ * 指定的方法在同一时刻、参数相同的多个调用只发送一次请求，响应复制给所有等待的调用方，
+ * 后端变慢或缓存失效时，可以避免大量相同的请求同时打到服务端：
+ *   client.SetCoalesce("User.Get", "Config.Load")
+ *
+ * 与响应缓存不同，请求完成后不保留结果，下一次调用会重新发送
+ * 参数相同的判断方式和响应缓存一样（方法名加参数的 JSON 编码，再加上元数据、优先级和版本等调用选项），
+ * 选项不同的调用不会合并；响应用 gob 复制
+ * 发送请求的调用出错时，等待的调用收到同样的错误；
+ * 但如果是它自己的 ctx 被取消或超时，等待的调用各自重新发送
+ * 只应该对没有副作用的方法开启，只有同步调用（Call、CallContext）会被合并
+ */
+
+type Coalescer struct {
+	methods   map[string]bool
+	mu        sync.Mutex
+	calls     map[string]*coalescedCall //进行中的调用
+	coalesced uint64                    //被合并、没有发送请求的调用数，原子操作
+}
+
+type coalescedCall struct {
+	done  chan struct{}
+	reply []byte //gob 编码的响应
+	err   error
+	retry bool //结果不能共享，等待的调用需要自己发送
+}
+
+func NewCoalescer(serviceMethods ...string) *Coalescer {
+	g := &Coalescer{
+		methods: make(map[string]bool),
+		calls:   make(map[string]*coalescedCall),
+	}
+	for _, m := range serviceMethods {
+		g.methods[m] = true
+	}
+	return g
+}
+
+// 经过合并发起一次调用，call 负责真正发送请求并把响应写入 reply，opts 是这次调用的选项
+func (g *Coalescer) Do(ctx context.Context, serviceMethod string, args, reply interface{}, opts []CallOption, call func() error) error {
+	if !g.methods[serviceMethod] {
+		return call()
+	}
+	key, err := cacheKey(serviceMethod, args)
+	if err != nil {
+		return call()
+	}
+	key += "\x00" + newCallOptions(opts).key()
+
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if c.retry {
+			return call()
+		}
+		atomic.AddUint64(&g.coalesced, 1)
+		if c.err != nil {
+			return c.err
+		}
+		return copyReply(c.reply, reply)
+	}
+	c := &coalescedCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.err = call()
+	if c.err == nil {
+		var encErr error
+		c.reply, encErr = encodeReply(reply)
+		c.retry = encErr != nil
+	} else {
+		c.retry = ctx.Err() != nil
+	}
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+	return c.err
+}
+
+// 被合并、没有发送请求的调用数
+func (g *Coalescer) Coalesced() uint64 {
+	if g == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&g.coalesced)
+}
+
+// 合并 serviceMethods 中方法的并发调用，不传参数时关闭
+func (client *Client) SetCoalesce(serviceMethods ...string) {
+	if len(serviceMethods) == 0 {
+		client.coalesce.Store(nil)
+		return
+	}
+	client.coalesce.Store(NewCoalescer(serviceMethods...))
+}
@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"bufio"
+	"io"
+)
+
+/**
+ * 读写缓冲区大小
+ *
+ * 内置的编解码器默认使用 bufio 的 4KB 缓冲区。消息很大、吞吐很高时，更大的缓冲区可以减少系统调用，
+ * 连接很多、消息很小时可以调小来节省内存。用 WithBufferSizes 包装连接后再创建编解码器：
+ *   cc := codec.NewGobCodec(codec.WithBufferSizes(conn, codec.BufferOptions{ReadSize: 64 << 10, WriteSize: 64 << 10}))
+ * 客户端和服务端通常不需要直接调用，设置 Option.ReadBufferSize/WriteBufferSize（geerpc.WithBufferSizes）
+ * 或 Server.SetBufferSizes 即可；缓冲区大小只影响本端，不需要两端一致
+ * 第三方编解码器把包装后的连接当作普通的连接使用
+ */
+
+type BufferOptions struct {
+	ReadSize  int //读缓冲区的字节数，0表示默认的 4KB
+	WriteSize int //写缓冲区的字节数，也是加固的 Gob 编码缓冲区的初始大小，0表示默认的 4KB
+}
+
+// 带缓冲区大小的连接
+type sizedConn struct {
+	io.ReadWriteCloser
+	opt BufferOptions
+}
+
+// 包装连接，内置的编解码器按 opt 创建读写缓冲区
+func WithBufferSizes(conn io.ReadWriteCloser, opt BufferOptions) io.ReadWriteCloser {
+	if opt.ReadSize <= 0 && opt.WriteSize <= 0 {
+		return conn
+	}
+	if sc, ok := conn.(*sizedConn); ok {
+		conn = sc.ReadWriteCloser
+	}
+	return &sizedConn{ReadWriteCloser: conn, opt: opt}
+}
+
+// 连接的缓冲区大小和被包装的连接，读写时直接使用被包装的连接，少一次转发
+func bufferSizes(conn io.ReadWriteCloser) (BufferOptions, io.ReadWriteCloser) {
+	if sc, ok := conn.(*sizedConn); ok {
+		return sc.opt, sc.ReadWriteCloser
+	}
+	return BufferOptions{}, conn
+}
+
+func newWriter(conn io.ReadWriteCloser) *bufio.Writer {
+	opt, conn := bufferSizes(conn)
+	return bufio.NewWriterSize(conn, opt.WriteSize)
+}
+
+func newReader(conn io.ReadWriteCloser) *bufio.Reader {
+	opt, conn := bufferSizes(conn)
+	return bufio.NewReaderSize(conn, opt.ReadSize)
+}
+
+/**
+ * 流式解码器（gob、JSON、CBOR）读取的 Reader：没有设置读缓冲区时直接使用连接，
+ * 由解码器自己缓冲（gob 包装为 4KB 的 bufio.Reader，JSON 和 CBOR 按需增长）
+ */
+func streamReader(conn io.ReadWriteCloser) io.Reader {
+	opt, conn := bufferSizes(conn)
+	if opt.ReadSize <= 0 {
+		return conn
+	}
+	return bufio.NewReaderSize(conn, opt.ReadSize)
+}
@@ -0,0 +1,76 @@
+package codec
+
+import (
+	"io"
+	"log"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+/**
+ * CBOR 编解码器（RFC 8949）
+ *
+ * 紧凑的二进制格式，不需要预先定义 schema，各种语言都有实现，适合已经使用 CBOR 的物联网客户端
+ * 请求头和请求体依次编码为两个 CBOR 数据项，结构体按字段名编码为 map
+ */
+
+type CborCodec struct {
+	conn io.ReadWriteCloser
+	buf  *corkWriter
+	dec  *cbor.Decoder
+	enc  *cbor.Encoder
+}
+
+var _ Codec = (*CborCodec)(nil)
+
+func NewCborCodec(conn io.ReadWriteCloser) Codec {
+	buf := newCorkWriter(conn)
+	return &CborCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  cbor.NewDecoder(streamReader(conn)),
+		enc:  cbor.NewEncoder(buf),
+	}
+}
+
+func (c *CborCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *CborCodec) ReadHeader(h *Header) error {
+	return c.dec.Decode(h)
+}
+
+// body 为 nil 时读出并丢弃一个数据项
+func (c *CborCodec) ReadBody(body interface{}) error {
+	var raw cbor.RawMessage
+	if err := c.dec.Decode(&raw); err != nil || body == nil {
+		return err
+	}
+	//先读出完整的数据项再解码，解码出错不影响流中后面的数据
+	if err := cbor.Unmarshal(raw, body); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+func (c *CborCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = c.buf.flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	if err = c.enc.Encode(h); err != nil {
+		log.Println("rpc codec:cbor error encoding header:", err)
+		return err
+	}
+	if err = c.enc.Encode(body); err != nil {
+		log.Println("rpc codec:cbor error encoding body:", err)
+		return err
+	}
+	return nil
+}
+
+func (c *CborCodec) Cork()         { c.buf.Cork() }
+func (c *CborCodec) Uncork() error { return c.buf.Uncork() }
@@ -0,0 +1,185 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+/**
+ * 带校验和的编解码器
+ *
+ * 握手时 Option 中设置了校验和标志后使用。请求头和请求体分别编码为一个帧：
+ *   | 长度(4字节) | CRC32-C(4字节) | 数据 |
+ * 每个帧单独编码（gob 每次使用新的编码器，会重复发送类型信息），不依赖之前的帧，
+ * 所以请求体校验失败时只丢弃这个帧，这次请求返回 ErrChecksum，连接上后续的请求不受影响
+ * 请求头校验失败时无法知道是哪个请求，只能关闭连接
+ */
+
+var ErrChecksum = errors.New("rpc codec: checksum mismatch")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// 单个值的编解码函数，marshal 追加到 buf 后面，buf 来自缓冲池
+type marshaler struct {
+	marshal   func(buf *bytes.Buffer, v interface{}) error
+	unmarshal func(data []byte, v interface{}) error
+}
+
+// 每个帧单独编码时使用，带校验和的和按消息压缩的编解码器共用
+var frameMarshalers = map[Type]marshaler{
+	GobType: {
+		marshal: func(buf *bytes.Buffer, v interface{}) error {
+			return gob.NewEncoder(buf).Encode(v)
+		},
+		unmarshal: gobUnmarshal,
+	},
+	CborType: {
+		marshal: func(buf *bytes.Buffer, v interface{}) error {
+			return cbor.NewEncoder(buf).Encode(v)
+		},
+		unmarshal: cbor.Unmarshal,
+	},
+}
+
+// 每个帧使用新的解码器，解码时的 panic 转换为错误，与加固的 Gob 一致
+func gobUnmarshal(data []byte, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rpc codec: gob decode panic: %v", r)
+		}
+	}()
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// 返回 t 对应的带校验和的编解码器，不支持的类型返回错误
+func NewChecksumCodecFunc(t Type) (NewCodecFunc, error) {
+	m, ok := frameMarshalers[t]
+	if !ok {
+		return nil, fmt.Errorf("rpc codec: checksum is not supported by codec type %s", t)
+	}
+	return func(conn io.ReadWriteCloser) Codec {
+		return &checksumCodec{
+			conn: conn,
+			r:    newReader(conn),
+			w:    newCorkWriter(conn),
+			m:    m,
+		}
+	}, nil
+}
+
+type checksumCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	w    *corkWriter
+	m    marshaler
+}
+
+var _ Codec = (*checksumCodec)(nil)
+
+func (c *checksumCodec) Close() error {
+	return c.conn.Close()
+}
+
+// 读一个帧并校验，返回的数据在 buf 中，用完后放回缓冲池
+func (c *checksumCodec) readFrame() (buf *bytes.Buffer, data []byte, err error) {
+	var prefix [checksumPrefixLen]byte
+	if _, err = io.ReadFull(c.r, prefix[:]); err != nil {
+		return nil, nil, err
+	}
+	n, sum, err := parseChecksumPrefix(prefix[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	buf, data = getFrame(n)
+	if _, err = io.ReadFull(c.r, data); err != nil {
+		putBuffer(buf)
+		return nil, nil, err
+	}
+	if err = verifyChecksum(data, sum); err != nil {
+		putBuffer(buf)
+		return nil, nil, err
+	}
+	return buf, data, nil
+}
+
+func (c *checksumCodec) ReadHeader(h *Header) error {
+	buf, data, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	return c.m.unmarshal(data, h)
+}
+
+func (c *checksumCodec) ReadBody(body interface{}) error {
+	buf, data, err := c.readFrame()
+	if err == ErrChecksum {
+		return &DecodeError{Err: err}
+	}
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	if body == nil {
+		return nil
+	}
+	return decodeFrame(c.m, data, body)
+}
+
+// 解码一个完整的帧，出错时帧已经读完，不影响后面的帧
+func decodeFrame(m marshaler, data []byte, v interface{}) error {
+	if err := m.unmarshal(data, v); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+// 在缓冲区中先留出前缀的位置，编码后填上长度和校验和，一次写出
+func (c *checksumCodec) writeFrame(v interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	var prefix [8]byte
+	buf.Write(prefix[:])
+	if err := c.m.marshal(buf, v); err != nil {
+		return err
+	}
+	frame := buf.Bytes()
+	data := frame[len(prefix):]
+	if len(data) > DefaultMaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(data, castagnoli))
+	_, err := c.w.Write(frame)
+	return err
+}
+
+func (c *checksumCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = c.w.flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	if err = c.writeFrame(h); err != nil {
+		log.Println("rpc codec: error encoding header:", err)
+		return err
+	}
+	if err = c.writeFrame(body); err != nil {
+		log.Println("rpc codec: error encoding body:", err)
+		return err
+	}
+	return nil
+}
+
+func (c *checksumCodec) Cork()         { c.w.Cork() }
+func (c *checksumCodec) Uncork() error { return c.w.Uncork() }
@@ -0,0 +1,283 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+/**
+ * 分块传输的编解码器
+ *
+ * 握手时 Option 中设置了分块标志后使用。请求头和请求体编码为一个消息：
+ *   | 请求头长度(4字节) | 请求头 | 请求体 |
+ * 消息再切成不超过 ChunkSize 的块发送，每块：
+ *   | 长度(4字节) | 消息编号(4字节) | 标志(1字节) | 数据 |
+ * 标志为 chunkLast 时是消息的最后一块，接收方按消息编号把块拼起来，
+ * 拼好的消息不能超过 MaxBodySize，超过时返回 ErrBodyTooLarge 并关闭连接
+ *
+ * 发送由一个单独的 goroutine 完成，最多 maxInterleaved 个消息轮流各发一块，
+ * 几 MB 的响应不会让后面的小响应一直排队；Write 编码后放入发送队列就返回，
+ * 队列满时阻塞，发送出错时关闭连接，之后的 Write 返回这个错误
+ * 编码后超过 MaxBodySize 的消息不发送，Write 返回 ErrBodyTooLarge，连接不受影响
+ * Close 先等待队列中的消息发送完（最多 chunkCloseTimeout），再关闭连接
+ */
+
+const (
+	DefaultChunkSize   = 64 << 10 //默认每块的最大字节数
+	DefaultMaxBodySize = 64 << 20 //默认拼好的消息的最大字节数
+)
+
+var ErrBodyTooLarge = errors.New("rpc codec: body too large")
+
+const (
+	chunkLast         byte = 1
+	maxInterleaved         = 16  //同时交替发送的消息数，也是接收方允许同时拼接的消息数
+	maxQueuedMessages      = 256 //发送队列的长度，满时 Write 阻塞
+	chunkCloseTimeout      = time.Second
+)
+
+type ChunkOptions struct {
+	ChunkSize   int //每块的最大字节数，0表示 DefaultChunkSize
+	MaxBodySize int //拼好的消息的最大字节数，0表示 DefaultMaxBodySize
+}
+
+// 返回 t 对应的分块传输的编解码器，不支持的类型返回错误
+func NewChunkedCodecFunc(t Type, opts ChunkOptions) (NewCodecFunc, error) {
+	m, ok := frameMarshalers[t]
+	if !ok {
+		return nil, fmt.Errorf("rpc codec: chunking is not supported by codec type %s", t)
+	}
+	if opts.ChunkSize <= 0 || opts.ChunkSize > DefaultMaxFrameSize {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+	return func(conn io.ReadWriteCloser) Codec {
+		c := &chunkedCodec{
+			conn:    conn,
+			r:       newReader(conn),
+			m:       m,
+			opts:    opts,
+			partial: make(map[uint32]*bytes.Buffer),
+			done:    make(chan struct{}),
+		}
+		c.cond = sync.NewCond(&c.mu)
+		go c.writeLoop()
+		return c
+	}, nil
+}
+
+type chunkedCodec struct {
+	conn io.ReadWriteCloser
+	m    marshaler
+	opts ChunkOptions
+	//读，只在读 goroutine 中使用
+	r       *bufio.Reader
+	partial map[uint32]*bytes.Buffer //消息编号 -> 还没有拼完的消息
+	body    []byte                   //当前消息的请求体
+	//写，由 mu 保护
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []*chunkedMessage //等待发送的消息，前 maxInterleaved 个轮流发送
+	nextID  uint32
+	err     error         //发送出错或已经关闭
+	closing bool          //调用了 Close，发送完队列后退出
+	done    chan struct{} //发送 goroutine 已经退出
+}
+
+var _ Codec = (*chunkedCodec)(nil)
+
+type chunkedMessage struct {
+	id   uint32
+	buf  *bytes.Buffer
+	data []byte //还没有发送的部分
+}
+
+// 读一块，拼好一个消息时返回它，调用方用完后 putBuffer
+func (c *chunkedCodec) readMessage() (*bytes.Buffer, error) {
+	for {
+		var prefix [chunkPrefixLen]byte
+		if _, err := io.ReadFull(c.r, prefix[:]); err != nil {
+			return nil, err
+		}
+		n, id, last, err := parseChunkPrefix(prefix[:])
+		if err != nil {
+			return nil, err
+		}
+		b, ok := c.partial[id]
+		if !ok {
+			if len(c.partial) >= maxInterleaved {
+				return nil, errors.New("rpc codec: too many interleaved messages")
+			}
+			b = getBuffer()
+			c.partial[id] = b
+		}
+		if b.Len()+n > c.opts.MaxBodySize {
+			return nil, ErrBodyTooLarge
+		}
+		if _, err := io.CopyN(b, c.r, int64(n)); err != nil {
+			return nil, err
+		}
+		if last {
+			delete(c.partial, id)
+			return b, nil
+		}
+	}
+}
+
+func (c *chunkedCodec) ReadHeader(h *Header) error {
+	buf, err := c.readMessage()
+	if err != nil {
+		return err
+	}
+	header, body, err := SplitChunkedMessage(buf.Bytes())
+	if err != nil {
+		putBuffer(buf)
+		return err
+	}
+	err = c.m.unmarshal(header, h)
+	//请求体在 ReadBody 中解码，拷贝一份后缓冲区可以放回池中
+	c.body = append(c.body[:0], body...)
+	putBuffer(buf)
+	return err
+}
+
+func (c *chunkedCodec) ReadBody(body interface{}) error {
+	if body == nil {
+		return nil
+	}
+	return decodeFrame(c.m, c.body, body)
+}
+
+// 编码后放入发送队列
+func (c *chunkedCodec) Write(h *Header, body interface{}) error {
+	buf := getBuffer()
+	var hl [4]byte
+	buf.Write(hl[:])
+	if err := c.m.marshal(buf, h); err != nil {
+		putBuffer(buf)
+		return err
+	}
+	binary.BigEndian.PutUint32(buf.Bytes()[:4], uint32(buf.Len()-4))
+	if err := c.m.marshal(buf, body); err != nil {
+		putBuffer(buf)
+		return err
+	}
+	if buf.Len() > c.opts.MaxBodySize {
+		putBuffer(buf)
+		return ErrBodyTooLarge
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.err == nil && !c.closing && len(c.queue) >= maxQueuedMessages {
+		c.cond.Wait()
+	}
+	if c.err != nil || c.closing {
+		putBuffer(buf)
+		if c.err != nil {
+			return c.err
+		}
+		return io.ErrClosedPipe
+	}
+	c.queue = append(c.queue, &chunkedMessage{id: c.nextID, buf: buf, data: buf.Bytes()})
+	c.nextID++
+	c.cond.Broadcast()
+	return nil
+}
+
+// 发送 goroutine：队列前面的消息轮流各发一块，一轮之后写出缓冲
+func (c *chunkedCodec) writeLoop() {
+	defer close(c.done)
+	w := newWriter(c.conn)
+	var round []*chunkedMessage
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && !c.closing && c.err == nil {
+			c.cond.Wait()
+		}
+		if len(c.queue) == 0 || c.err != nil {
+			c.mu.Unlock()
+			return
+		}
+		n := len(c.queue)
+		if n > maxInterleaved {
+			n = maxInterleaved
+		}
+		round = append(round[:0], c.queue[:n]...)
+		c.mu.Unlock()
+
+		err := c.writeRound(w, round)
+		if err == nil {
+			err = w.Flush()
+		}
+
+		c.mu.Lock()
+		if err != nil {
+			c.err = err
+			c.cond.Broadcast()
+			c.mu.Unlock()
+			_ = c.conn.Close()
+			return
+		}
+		//去掉发送完的消息，保持其余消息的顺序
+		queue := c.queue[:0]
+		for _, msg := range c.queue {
+			if len(msg.data) > 0 {
+				queue = append(queue, msg)
+			} else {
+				putBuffer(msg.buf)
+			}
+		}
+		for i := len(queue); i < len(c.queue); i++ {
+			c.queue[i] = nil
+		}
+		c.queue = queue
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	}
+}
+
+func (c *chunkedCodec) writeRound(w *bufio.Writer, round []*chunkedMessage) error {
+	for _, msg := range round {
+		n := len(msg.data)
+		var prefix [chunkPrefixLen]byte
+		if n > c.opts.ChunkSize {
+			n = c.opts.ChunkSize
+		} else {
+			prefix[8] = chunkLast
+		}
+		binary.BigEndian.PutUint32(prefix[:4], uint32(n))
+		binary.BigEndian.PutUint32(prefix[4:8], msg.id)
+		if _, err := w.Write(prefix[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(msg.data[:n]); err != nil {
+			return err
+		}
+		msg.data = msg.data[n:]
+	}
+	return nil
+}
+
+// 等待队列中的消息发送完再关闭连接，对端不读时最多等待 chunkCloseTimeout
+func (c *chunkedCodec) Close() error {
+	c.mu.Lock()
+	c.closing = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	t := time.NewTimer(chunkCloseTimeout)
+	defer t.Stop()
+	select {
+	case <-c.done:
+	case <-t.C:
+	}
+	return c.conn.Close()
+}
@@ -6,9 +6,15 @@ package codec
 import "io"
 
 type Header struct {
-	ServiceMethod string //服务名和方法名，通常与 Go 语言中的结构体和方法相映射
-	Seq           uint64 //用于区分不同的请求序号，可以认为是一个64位的请求ID，区分不同请求
-	Error         string //请求失败，错误信息
+	ServiceMethod string            //服务名和方法名，通常与 Go 语言中的结构体和方法相映射
+	Seq           uint64            //用于区分不同的请求序号，可以认为是一个64位的请求ID，区分不同请求
+	Error         string            //请求失败，错误信息
+	Deadline      int64             //调用方的绝对截止时间（UnixNano），0表示没有截止时间
+	Version       string            //客户端固定的服务版本，为空表示不指定
+	Priority      int               //请求优先级，越大越优先，服务端开启优先级调度时生效
+	Meta          map[string]string //请求元数据，由调用方设置，服务端可以在 context 中读取
+	Callback      bool              //服务端回调客户端的请求和它的响应，编号与普通请求相互独立
+	BodyType      string            //请求体具体类型的标签，参数或响应声明为接口时使用，见 RegisterTag
 }
 
 // Codec 接口：对消息体进行编解码的抽象
@@ -19,6 +25,18 @@ type Codec interface {
 	Write(*Header, interface{}) error
 }
 
+/*
+请求体已经完整读出，只是无法解码到传入的值（类型不匹配、校验失败等），
+连接上后面的数据不受影响，调用方可以只让这一个请求失败而不关闭连接
+按帧读写的编解码器（JSON、CBOR、带校验和、按消息压缩、分块传输）会返回这个错误
+*/
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string { return e.Err.Error() }
+func (e *DecodeError) Unwrap() error { return e.Err }
+
 // 定义一个匿名函数的类型
 type NewCodecFunc func(conn io.ReadWriteCloser) Codec
 
@@ -26,11 +44,14 @@ type Type string
 
 const (
 	GobType  Type = "application/gob"
-	JsonType Type = "application/json" //没实现
+	JsonType Type = "application/json"
+	CborType Type = "application/cbor"
 )
 
 /**
  *  全局变量，根据Type找对消息体进行编解码的具体实现
+ *
+ *  Deprecated: 使用 Register 注册，直接修改这个 map 不是并发安全的
  */
 var NewCodecFuncMap map[Type]NewCodecFunc
 
@@ -38,5 +59,14 @@ func init() {
 	//返回是构造函数而不是实例，像工厂模式（返回实例）但不是
 	NewCodecFuncMap = make(map[Type]NewCodecFunc) //初始化全局变量，分配内存空间
 	//CS可以通过Codec的Type得到构造函数，从而创建Codec实例
-	NewCodecFuncMap[GobType] = NewGobCodec //一个包下，直接调用
+	builtin := map[Type]NewCodecFunc{
+		GobType:         NewGobCodec,
+		HardenedGobType: NewHardenedGobCodecFunc(GobOptions{}),
+		CborType:        NewCborCodec,
+		JsonType:        NewJsonCodec,
+	}
+	for t, f := range builtin {
+		mustRegister(t, f)
+		NewCodecFuncMap[t] = f
+	}
 }
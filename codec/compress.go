@@ -0,0 +1,231 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+/**
+ * 压缩
+ *
+ * 两种方式，握手时由客户端选择：
+ * 1. 整个连接压缩：NewGzipConn 包装连接，所有消息在同一个 gzip 流里，可以利用消息之间的重复内容，
+ *    适合大量相似的小消息
+ * 2. 按消息压缩：NewCompressedCodecFunc，请求头和请求体分别编码为一个帧，只压缩不小于阈值的帧，
+ *    小消息不付出压缩的开销，适合大小差别很大的消息
+ *      | 长度(4字节) | 标志(1字节) | 数据 |
+ *    标志为 frameGzip 时数据是 gzip 压缩过的
+ */
+
+const DefaultCompressThreshold = 1024 //按消息压缩时默认只压缩不小于 1KB 的帧
+
+const frameGzip byte = 1
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return w
+	}}
+	gzipReaders sync.Pool
+)
+
+// 整个连接压缩，每次 Write 之后 Flush，保证对端能及时解压出完整的消息
+type gzipConn struct {
+	io.ReadWriteCloser
+	w  *gzip.Writer
+	zr *gzip.Reader //第一次读时创建，创建时会阻塞读取 gzip 头
+	br *bufio.Reader
+}
+
+func NewGzipConn(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	w, _ := gzip.NewWriterLevel(conn, gzip.BestSpeed)
+	return &gzipConn{ReadWriteCloser: conn, w: w, br: bufio.NewReader(conn)}
+}
+
+func (c *gzipConn) Read(p []byte) (int, error) {
+	if c.zr == nil {
+		zr, err := gzip.NewReader(c.br)
+		if err != nil {
+			return 0, err
+		}
+		c.zr = zr
+	}
+	return c.zr.Read(p)
+}
+
+func (c *gzipConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+// 返回按消息压缩的编解码器，只压缩不小于 threshold 字节的帧，threshold 为0时使用默认值
+func NewCompressedCodecFunc(t Type, threshold int) (NewCodecFunc, error) {
+	m, ok := frameMarshalers[t]
+	if !ok {
+		return nil, fmt.Errorf("rpc codec: per-message compression is not supported by codec type %s", t)
+	}
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	return func(conn io.ReadWriteCloser) Codec {
+		return &compressedCodec{
+			conn:      conn,
+			r:         newReader(conn),
+			w:         newCorkWriter(conn),
+			m:         m,
+			threshold: threshold,
+		}
+	}, nil
+}
+
+type compressedCodec struct {
+	conn      io.ReadWriteCloser
+	r         *bufio.Reader
+	w         *corkWriter
+	m         marshaler
+	threshold int
+}
+
+var _ Codec = (*compressedCodec)(nil)
+
+func (c *compressedCodec) Close() error {
+	return c.conn.Close()
+}
+
+// 读一个帧，需要时解压，返回的数据在 buf 中，用完后放回缓冲池
+func (c *compressedCodec) readFrame() (buf *bytes.Buffer, data []byte, err error) {
+	var prefix [compressPrefixLen]byte
+	if _, err = io.ReadFull(c.r, prefix[:]); err != nil {
+		return nil, nil, err
+	}
+	n, flag, err := parseCompressPrefix(prefix[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	buf, data = getFrame(n)
+	if _, err = io.ReadFull(c.r, data); err != nil {
+		putBuffer(buf)
+		return nil, nil, err
+	}
+	if flag&frameGzip == 0 {
+		return buf, data, nil
+	}
+	defer putBuffer(buf)
+	return gunzip(data)
+}
+
+// 解压到一个新的缓冲区
+func gunzip(data []byte) (*bytes.Buffer, []byte, error) {
+	zr, _ := gzipReaders.Get().(*gzip.Reader)
+	var err error
+	if zr == nil {
+		zr, err = gzip.NewReader(bytes.NewReader(data))
+	} else {
+		err = zr.Reset(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gzipReaders.Put(zr)
+	out := getBuffer()
+	//解压后的大小同样受帧大小的限制，防止压缩炸弹
+	if _, err = out.ReadFrom(io.LimitReader(zr, DefaultMaxFrameSize+1)); err != nil {
+		putBuffer(out)
+		return nil, nil, err
+	}
+	if out.Len() > DefaultMaxFrameSize {
+		putBuffer(out)
+		return nil, nil, ErrFrameTooLarge
+	}
+	return out, out.Bytes(), nil
+}
+
+// 压缩 data 追加到 dst 后面
+func gzipTo(dst *bytes.Buffer, data []byte) error {
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+	w.Reset(dst)
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (c *compressedCodec) ReadHeader(h *Header) error {
+	buf, data, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	return c.m.unmarshal(data, h)
+}
+
+func (c *compressedCodec) ReadBody(body interface{}) error {
+	buf, data, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	defer putBuffer(buf)
+	if body == nil {
+		return nil
+	}
+	return decodeFrame(c.m, data, body)
+}
+
+func (c *compressedCodec) writeFrame(v interface{}) error {
+	raw := getBuffer()
+	defer putBuffer(raw)
+	if err := c.m.marshal(raw, v); err != nil {
+		return err
+	}
+	data, flag := raw.Bytes(), byte(0)
+	if len(data) >= c.threshold {
+		z := getBuffer()
+		defer putBuffer(z)
+		//压缩后没有变小时发送原始数据
+		if err := gzipTo(z, data); err == nil && z.Len() < len(data) {
+			data, flag = z.Bytes(), frameGzip
+		}
+	}
+	if len(data) > DefaultMaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	var prefix [compressPrefixLen]byte
+	binary.BigEndian.PutUint32(prefix[:4], uint32(len(data)))
+	prefix[4] = flag
+	if _, err := c.w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := c.w.Write(data)
+	return err
+}
+
+func (c *compressedCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = c.w.flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	if err = c.writeFrame(h); err != nil {
+		log.Println("rpc codec: error encoding header:", err)
+		return err
+	}
+	if err = c.writeFrame(body); err != nil {
+		log.Println("rpc codec: error encoding body:", err)
+		return err
+	}
+	return nil
+}
+
+func (c *compressedCodec) Cork()         { c.w.Cork() }
+func (c *compressedCodec) Uncork() error { return c.w.Uncork() }
@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"bufio"
+	"io"
+)
+
+/**
+ * 暂缓写出（cork/uncork）
+ *
+ * 内置的编解码器把请求头和请求体编码到同一个缓冲区，每个消息写完 Flush 一次，
+ * 不超过缓冲区大小的消息（见 WithBufferSizes）只用一次系统调用，请求头和请求体在同一个 TCP 包里
+ * 连续写多个消息时，可以先 Cork，之后的 Write 只编码到缓冲区，Uncork 时一次写出，多个小消息合并发送：
+ *   if ck, ok := cc.(codec.Corker); ok {
+ *       ck.Cork()
+ *       defer ck.Uncork()
+ *   }
+ *   for _, r := range replies {
+ *       _ = cc.Write(r.h, r.body)
+ *   }
+ * Cork 可以嵌套，与 Uncork 成对调用，最外层的 Uncork 才写出；缓冲区满时仍然会写出，Cork 期间内存不会无限增长
+ * Cork/Uncork 与 Write 一样不能并发调用
+ * 服务端有多个响应等待发送时自动 Cork，最后一个响应写完后 Uncork；分块传输的编解码器由发送 goroutine 合并写出，不实现 Corker
+ */
+
+type Corker interface {
+	Cork()
+	Uncork() error //写出 Cork 之后缓冲的数据，返回写连接的错误
+}
+
+// 支持 Cork 的带缓冲的 Writer，内置的编解码器共用
+type corkWriter struct {
+	w      *bufio.Writer
+	corked int //Cork 的层数，大于0时 flush 不写出
+}
+
+func newCorkWriter(conn io.ReadWriteCloser) *corkWriter {
+	return &corkWriter{w: newWriter(conn)}
+}
+
+func (c *corkWriter) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// 一个消息写完，没有 Cork 时写出
+func (c *corkWriter) flush() error {
+	if c.corked > 0 {
+		return nil
+	}
+	return c.w.Flush()
+}
+
+func (c *corkWriter) Cork() {
+	c.corked++
+}
+
+func (c *corkWriter) Uncork() error {
+	if c.corked > 0 {
+		c.corked--
+	}
+	return c.flush()
+}
+
+var (
+	_ Corker = (*GobCodec)(nil)
+	_ Corker = (*hardenedGobCodec)(nil)
+	_ Corker = (*jsonCodec)(nil)
+	_ Corker = (*CborCodec)(nil)
+	_ Corker = (*checksumCodec)(nil)
+	_ Corker = (*compressedCodec)(nil)
+)
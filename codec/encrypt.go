@@ -0,0 +1,262 @@
+package codec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+/**
+ * 加密的编解码器包装
+ *
+ * 在无法使用 TLS 的环境（嵌入式设备、跨越信任边界的 unix socket）中加密连接上的数据：
+ * 内层编解码器写出的数据被切分成帧，每帧用 AEAD 加密，帧格式为 | 长度(4字节) | 密文 |
+ * 连接开始时两端各发送32字节的随机盐（握手模式下还有 X25519 临时公钥），用 HKDF 从密钥材料和双方的盐
+ * 派生两个方向各自的密钥，所以：
+ *   每个连接的密钥都不同，录下的数据在新的连接上重放会解密失败
+ *   两个方向的密钥不同，帧被发回给发送方会解密失败
+ *   nonce 是每个方向从0开始的计数器，不在帧中发送，帧被重放、调换顺序或丢弃后，之后的帧都会解密失败
+ * 密钥材料可以是预共享密钥，也可以是 X25519 交换临时公钥得到的共享密钥（前向安全），
+ * 两者同时使用时预共享密钥也混入会话密钥，用于认证对方，防止中间人；只用握手时无法认证对方
+ * 解密失败返回 ErrDecrypt，连接上之后的数据不再可用
+ * 作为一个新的编解码器类型注册，客户端和服务端使用相同的选项：
+ *   f := codec.NewEncryptedCodecFunc(codec.NewGobCodec, codec.EncryptOption{Cipher: codec.AESGCM, Key: psk})
+ *   _ = r.Register("application/gob+aes-gcm", f)
+ */
+
+type Cipher string
+
+const (
+	AESGCM           Cipher = "aes-gcm"
+	ChaCha20Poly1305 Cipher = "chacha20-poly1305" //XChaCha20-Poly1305，nonce 同样是计数器
+)
+
+type EncryptOption struct {
+	Cipher    Cipher
+	Key       []byte //预共享密钥，任意长度，与盐一起用 HKDF 派生会话密钥
+	Handshake bool   //通过 X25519 交换临时密钥派生会话密钥
+}
+
+var ErrDecrypt = errors.New("rpc codec: message authentication failed")
+
+// 单个帧的最大明文长度
+const maxPlainFrame = 64 << 10
+
+// 连接开始时交换的随机盐的长度
+const saltLen = 32
+
+// 包装 inner，返回加密的编解码器的构造函数
+func NewEncryptedCodecFunc(inner NewCodecFunc, opt EncryptOption) NewCodecFunc {
+	return func(conn io.ReadWriteCloser) Codec {
+		sc, err := newSecureConn(conn, opt)
+		if err != nil {
+			_ = conn.Close()
+			return errCodec{err: err}
+		}
+		return inner(sc)
+	}
+}
+
+func newAEAD(c Cipher, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case AESGCM, "":
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, fmt.Errorf("rpc codec: unknown cipher %s", c)
+}
+
+// 交换盐和公钥，派生两个方向的密钥
+func newSecureConn(conn io.ReadWriteCloser, opt EncryptOption) (*secureConn, error) {
+	if !opt.Handshake && len(opt.Key) == 0 {
+		return nil, errors.New("rpc codec: encryption requires a key or a handshake")
+	}
+	hello := make([]byte, saltLen, saltLen+32)
+	if _, err := rand.Read(hello); err != nil {
+		return nil, err
+	}
+	var priv *ecdh.PrivateKey
+	if opt.Handshake {
+		var err error
+		if priv, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+			return nil, err
+		}
+		hello = append(hello, priv.PublicKey().Bytes()...)
+	}
+	//两端同时先写后读，写放在 goroutine 中，避免同步的连接（如 net.Pipe）死锁
+	sent := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(hello)
+		sent <- err
+	}()
+	peerHello := make([]byte, len(hello))
+	if _, err := io.ReadFull(conn, peerHello); err != nil {
+		return nil, err
+	}
+	if err := <-sent; err != nil {
+		return nil, err
+	}
+	mySalt, peerSalt := hello[:saltLen], peerHello[:saltLen]
+	if string(mySalt) == string(peerSalt) {
+		//对方原样发回了我们的盐，两个方向会得到相同的密钥
+		return nil, errors.New("rpc codec: peer reflected the key exchange")
+	}
+
+	//密钥材料：X25519 的共享密钥和预共享密钥
+	secret := append([]byte(nil), opt.Key...)
+	if opt.Handshake {
+		peer, err := ecdh.X25519().NewPublicKey(peerHello[saltLen:])
+		if err != nil {
+			return nil, err
+		}
+		shared, err := priv.ECDH(peer)
+		if err != nil {
+			return nil, err
+		}
+		secret = append(shared, secret...)
+	}
+	//双方发送的内容按字节序排列后作为 HKDF 的盐，两端得到相同的值
+	a, b := hello, peerHello
+	if string(a) > string(b) {
+		a, b = b, a
+	}
+	transcript := append(append([]byte(nil), a...), b...)
+	sendKey, err := deriveKey(secret, transcript, opt.Cipher, mySalt)
+	if err != nil {
+		return nil, err
+	}
+	recvKey, err := deriveKey(secret, transcript, opt.Cipher, peerSalt)
+	if err != nil {
+		return nil, err
+	}
+	sc := &secureConn{conn: conn}
+	if sc.send, err = newAEAD(opt.Cipher, sendKey); err != nil {
+		return nil, err
+	}
+	if sc.recv, err = newAEAD(opt.Cipher, recvKey); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// 派生发送方 senderSalt 这个方向的32字节密钥
+func deriveKey(secret, transcript []byte, c Cipher, senderSalt []byte) ([]byte, error) {
+	info := append([]byte("geerpc "+string(c)+" "), senderSalt...)
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, transcript, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// 读写时加解密的连接
+type secureConn struct {
+	conn io.ReadWriteCloser
+	send cipher.AEAD //本端发送方向的密钥
+	recv cipher.AEAD //对端发送方向的密钥
+	//两个方向各自的帧计数，作为 nonce，只有一个 goroutine 读、一个 goroutine 写
+	sendSeq uint64
+	recvSeq uint64
+	plain   []byte //已经解密还没有读走的数据
+	//读写各自复用的帧缓冲区，读和写分别只有一个 goroutine
+	rbuf []byte
+	wbuf []byte
+}
+
+func (c *secureConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxPlainFrame {
+			n = maxPlainFrame
+		}
+		if need := 4 + n + c.send.Overhead(); cap(c.wbuf) < need {
+			c.wbuf = make([]byte, 0, need)
+		}
+		nonce, err := seqNonce(c.send, &c.sendSeq)
+		if err != nil {
+			return written, err
+		}
+		frame := c.send.Seal(c.wbuf[:4], nonce, p[:n], nil)
+		binary.BigEndian.PutUint32(frame[:4], uint32(len(frame)-4))
+		if _, err := c.conn.Write(frame); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (c *secureConn) Read(p []byte) (int, error) {
+	if len(c.plain) == 0 {
+		var size [4]byte
+		if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+			return 0, err
+		}
+		n := int(binary.BigEndian.Uint32(size[:]))
+		if n < c.recv.Overhead() || n > maxPlainFrame+c.recv.Overhead() {
+			return 0, ErrFrameTooLarge
+		}
+		//解密后的数据还在 rbuf 里，所以只在 plain 读完后才会复用
+		if cap(c.rbuf) < n {
+			c.rbuf = make([]byte, n)
+		}
+		frame := c.rbuf[:n]
+		if _, err := io.ReadFull(c.conn, frame); err != nil {
+			return 0, err
+		}
+		nonce, err := seqNonce(c.recv, &c.recvSeq)
+		if err != nil {
+			return 0, err
+		}
+		//帧被重放、调换顺序或丢弃时计数对不上，解密失败
+		plain, err := c.recv.Open(frame[:0], nonce, frame, nil)
+		if err != nil {
+			return 0, ErrDecrypt
+		}
+		c.plain = plain
+	}
+	n := copy(p, c.plain)
+	c.plain = c.plain[n:]
+	return n, nil
+}
+
+// 按计数生成下一个 nonce：前面补0，最后8字节是大端序的计数
+func seqNonce(aead cipher.AEAD, seq *uint64) ([]byte, error) {
+	if *seq == ^uint64(0) {
+		return nil, errors.New("rpc codec: too many frames on one connection")
+	}
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], *seq)
+	*seq++
+	return nonce, nil
+}
+
+func (c *secureConn) Close() error {
+	return c.conn.Close()
+}
+
+// 创建失败时返回，所有操作都返回同一个错误
+type errCodec struct {
+	err error
+}
+
+func (c errCodec) Close() error                     { return nil }
+func (c errCodec) ReadHeader(*Header) error         { return c.err }
+func (c errCodec) ReadBody(interface{}) error       { return c.err }
+func (c errCodec) Write(*Header, interface{}) error { return c.err }
@@ -0,0 +1,230 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+/**
+ * 帧和请求头的解析
+ *
+ * 各个编解码器读取连接时使用的解析逻辑，同时以纯函数的形式导出，输入是字节切片，不需要连接，
+ * 可以直接作为 Go 原生模糊测试的入口：
+ *   func FuzzChecksumFrame(f *testing.F) {
+ *       f.Fuzz(func(t *testing.T, data []byte) {
+ *           fr, _, err := codec.DecodeFrame(codec.ChecksumFrame, data)
+ *           if err == nil {
+ *               _ = codec.DecodeHeader(codec.GobType, fr.Data, new(codec.Header))
+ *           }
+ *       })
+ *   }
+ *   func FuzzJsonStream(f *testing.F) {
+ *       f.Fuzz(func(t *testing.T, data []byte) { _ = codec.DecodeStream(codec.NewJsonCodec, data, nil) })
+ *   }
+ * 任何输入都只会返回错误，不会 panic，也不会按输入中的长度字段分配超过帧大小上限的内存
+ */
+
+// 帧不符合格式：长度字段与数据不一致、未知的标志位等
+var ErrMalformedFrame = errors.New("rpc codec: malformed frame")
+
+// 帧的格式，对应各个按帧读写的编解码器
+type FrameFormat int
+
+const (
+	ChecksumFrame   FrameFormat = iota + 1 //| 长度(4字节) | CRC32-C(4字节) | 数据 |，见 checksum.go
+	CompressedFrame                        //| 长度(4字节) | 标志(1字节) | 数据 |，见 compress.go
+	ChunkFrame                             //| 长度(4字节) | 消息编号(4字节) | 标志(1字节) | 数据 |，见 chunk.go
+	LengthFrame                            //| 长度(4字节) | 数据 |，加固的 Gob，见 gob_hardened.go
+)
+
+// 各种帧的前缀长度
+const (
+	checksumPrefixLen = 8
+	compressPrefixLen = 5
+	chunkPrefixLen    = 9
+	lengthPrefixLen   = 4
+)
+
+type Frame struct {
+	Data []byte //帧的数据，压缩过的已经解压；没有压缩时引用传入的切片
+	ID   uint32 //消息编号，只用于 ChunkFrame
+	Last bool   //是否是消息的最后一块，只用于 ChunkFrame
+}
+
+/**
+ * 从 data 开头解析一个帧，返回帧和它占用的字节数，后面的数据是下一个帧
+ * data 不完整时返回 io.ErrUnexpectedEOF（data 为空时返回 io.EOF），校验和不一致时返回 ErrChecksum
+ */
+func DecodeFrame(format FrameFormat, data []byte) (Frame, int, error) {
+	var prefixLen int
+	switch format {
+	case ChecksumFrame:
+		prefixLen = checksumPrefixLen
+	case CompressedFrame:
+		prefixLen = compressPrefixLen
+	case ChunkFrame:
+		prefixLen = chunkPrefixLen
+	case LengthFrame:
+		prefixLen = lengthPrefixLen
+	default:
+		return Frame{}, 0, fmt.Errorf("rpc codec: unknown frame format %d", format)
+	}
+	if len(data) == 0 {
+		return Frame{}, 0, io.EOF
+	}
+	if len(data) < prefixLen {
+		return Frame{}, 0, io.ErrUnexpectedEOF
+	}
+	prefix := data[:prefixLen]
+	var f Frame
+	var n int
+	var sum uint32
+	var flag byte
+	var err error
+	switch format {
+	case ChecksumFrame:
+		n, sum, err = parseChecksumPrefix(prefix)
+	case CompressedFrame:
+		n, flag, err = parseCompressPrefix(prefix)
+	case ChunkFrame:
+		n, f.ID, f.Last, err = parseChunkPrefix(prefix)
+	case LengthFrame:
+		n, err = parseLengthPrefix(prefix, DefaultMaxFrameSize)
+	}
+	if err != nil {
+		return Frame{}, 0, err
+	}
+	if len(data)-prefixLen < n {
+		return Frame{}, 0, io.ErrUnexpectedEOF
+	}
+	f.Data = data[prefixLen : prefixLen+n]
+	switch {
+	case format == ChecksumFrame:
+		err = verifyChecksum(f.Data, sum)
+	case format == CompressedFrame && flag&frameGzip != 0:
+		var buf *bytes.Buffer
+		if buf, f.Data, err = gunzip(f.Data); err == nil {
+			//解压的缓冲区来自缓冲池，拷贝一份后放回
+			f.Data = append([]byte(nil), f.Data...)
+			putBuffer(buf)
+		}
+	}
+	if err != nil {
+		return Frame{}, 0, err
+	}
+	return f, prefixLen + n, nil
+}
+
+// 帧的长度不能超过 max，在读数据之前检查，不会按恶意的长度分配内存
+func parseLengthPrefix(prefix []byte, max int) (int, error) {
+	n := binary.BigEndian.Uint32(prefix[:4])
+	if uint64(n) > uint64(max) {
+		return 0, ErrFrameTooLarge
+	}
+	return int(n), nil
+}
+
+func parseChecksumPrefix(prefix []byte) (n int, sum uint32, err error) {
+	if n, err = parseLengthPrefix(prefix, DefaultMaxFrameSize); err != nil {
+		return 0, 0, err
+	}
+	return n, binary.BigEndian.Uint32(prefix[4:8]), nil
+}
+
+func verifyChecksum(data []byte, sum uint32) error {
+	if crc32.Checksum(data, castagnoli) != sum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// 标志中只能有已知的位
+func parseCompressPrefix(prefix []byte) (n int, flag byte, err error) {
+	if n, err = parseLengthPrefix(prefix, DefaultMaxFrameSize); err != nil {
+		return 0, 0, err
+	}
+	if flag = prefix[4]; flag&^frameGzip != 0 {
+		return 0, 0, ErrMalformedFrame
+	}
+	return n, flag, nil
+}
+
+func parseChunkPrefix(prefix []byte) (n int, id uint32, last bool, err error) {
+	if n, err = parseLengthPrefix(prefix, DefaultMaxFrameSize); err != nil {
+		return 0, 0, false, err
+	}
+	flag := prefix[8]
+	if flag&^chunkLast != 0 {
+		return 0, 0, false, ErrMalformedFrame
+	}
+	return n, binary.BigEndian.Uint32(prefix[4:8]), flag&chunkLast != 0, nil
+}
+
+// 把分块传输拼好的消息 | 请求头长度(4字节) | 请求头 | 请求体 | 拆分为请求头和请求体，都引用 msg
+func SplitChunkedMessage(msg []byte) (header, body []byte, err error) {
+	if len(msg) < 4 {
+		return nil, nil, ErrMalformedFrame
+	}
+	hl := binary.BigEndian.Uint32(msg[:4])
+	if uint64(hl) > uint64(len(msg)-4) {
+		return nil, nil, ErrMalformedFrame
+	}
+	return msg[4 : 4+hl], msg[4+hl:], nil
+}
+
+/**
+ * 解码单独编码的请求头，即带校验和、按消息压缩和分块传输的帧中的请求头
+ * t 为 GobType、CborType 或 JsonType（JSON 与 JsonCodec 相同，请求头是一个 JSON 值）
+ */
+func DecodeHeader(t Type, data []byte, h *Header) error {
+	if t == JsonType {
+		return json.Unmarshal(data, h)
+	}
+	m, ok := frameMarshalers[t]
+	if !ok {
+		return fmt.Errorf("rpc codec: framed header is not supported by codec type %s", t)
+	}
+	return m.unmarshal(data, h)
+}
+
+/**
+ * 用 f 创建的编解码器从 data 中依次读出所有消息，data 正好读完时返回nil，否则返回第一个导致连接关闭的错误
+ * newBody 按请求头返回解码请求体的值，为nil或返回nil时读出后丢弃；
+ * 请求体解码失败（DecodeError）与服务端一样只影响这一个消息，继续读下一个
+ */
+func DecodeStream(f NewCodecFunc, data []byte, newBody func(*Header) interface{}) error {
+	c := f(&byteConn{Reader: bytes.NewReader(data)})
+	defer func() { _ = c.Close() }()
+	for {
+		var h Header
+		if err := c.ReadHeader(&h); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var body interface{}
+		if newBody != nil {
+			body = newBody(&h)
+		}
+		if err := c.ReadBody(body); err != nil {
+			var de *DecodeError
+			if !errors.As(err, &de) {
+				return err
+			}
+		}
+	}
+}
+
+// 从字节切片读、写入的数据丢弃的连接，供 DecodeStream 使用
+type byteConn struct {
+	*bytes.Reader
+}
+
+func (c *byteConn) Write(p []byte) (int, error) { return len(p), nil }
+func (c *byteConn) Close() error                { return nil }
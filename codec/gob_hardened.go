@@ -0,0 +1,183 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+/**
+ * 加固的 Gob 编解码器
+ *
+ * 普通的 GobCodec 直接从连接上解码，恶意的数据可以让 gob 分配很大的内存。加固模式下：
+ * 1.每次 Write 的请求头和请求体放在一个帧里，帧前面是4字节大端序的长度，读取时长度超过 MaxFrameSize 直接报错，不会分配内存
+ * 2.每个帧单独解码，请求头和请求体必须在它们开始的帧内结束，跨帧的值和帧末尾多余的数据都返回 ErrMalformedFrame 并关闭连接，
+ *   所以一个消息（连同 gob 的类型定义）不会超过 MaxFrameSize
+ * 3.解码时的 panic 转换为错误
+ * 不限制对端发送的类型：gob 的类型定义和接口值的类型名都嵌在数据中，需要完整解析 gob 的数据才能检查
+ * 两端都需要使用 HardenedGobType，默认注册的是默认选项，需要其他选项时注册到自己的注册表中：
+ *   r := codec.NewRegistry()
+ *   _ = r.Register(codec.HardenedGobType, codec.NewHardenedGobCodecFunc(codec.GobOptions{MaxFrameSize: 1 << 20}))
+ *   server.SetCodecRegistry(r)
+ */
+
+const HardenedGobType Type = "application/gob+framed"
+
+// 默认的最大帧大小
+const DefaultMaxFrameSize = 4 << 20
+
+var ErrFrameTooLarge = errors.New("rpc codec: frame too large")
+
+type GobOptions struct {
+	MaxFrameSize int //单个帧（请求头+请求体）的最大字节数，0表示 DefaultMaxFrameSize
+}
+
+type hardenedGobCodec struct {
+	conn  io.ReadWriteCloser
+	w     *corkWriter
+	frame bytes.Buffer //正在写的帧
+	enc   *gob.Encoder //写入 frame
+	fr    *frameReader
+	dec   *gob.Decoder //从 fr 读，类型定义在帧之间保留
+	max   int
+}
+
+var _ Codec = (*hardenedGobCodec)(nil)
+
+// 根据选项创建加固的 Gob 编解码器的构造函数
+func NewHardenedGobCodecFunc(opt GobOptions) NewCodecFunc {
+	max := opt.MaxFrameSize
+	if max <= 0 {
+		max = DefaultMaxFrameSize
+	}
+	return func(conn io.ReadWriteCloser) Codec {
+		bufs, _ := bufferSizes(conn)
+		c := &hardenedGobCodec{
+			conn: conn,
+			w:    newCorkWriter(conn),
+			fr:   &frameReader{r: streamReader(conn), max: max},
+			max:  max,
+		}
+		c.dec = gob.NewDecoder(c.fr)
+		c.frame.Grow(bufs.WriteSize)
+		c.enc = gob.NewEncoder(&c.frame)
+		return c
+	}
+}
+
+func (c *hardenedGobCodec) Close() error {
+	return c.conn.Close()
+}
+
+// 读入下一个帧，请求头必须在这个帧内
+func (c *hardenedGobCodec) ReadHeader(h *Header) error {
+	if err := c.fr.next(); err != nil {
+		return err
+	}
+	return frameEnd(c.decode(h))
+}
+
+func (c *hardenedGobCodec) ReadBody(body interface{}) error {
+	return gobTypeError(frameEnd(c.decode(body)))
+}
+
+// 当前帧的数据读完了值还没有结束，说明值跨过了帧的边界
+func frameEnd(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrMalformedFrame
+	}
+	return err
+}
+
+func (c *hardenedGobCodec) decode(v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rpc codec: gob decode panic: %v", r)
+		}
+	}()
+	return c.dec.Decode(v)
+}
+
+func (c *hardenedGobCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		//编码器已经认为类型信息发出去了，帧发不出去时连接上的数据不再可用，只能关闭
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	c.frame.Reset()
+	if err = c.enc.Encode(h); err != nil {
+		log.Println("rpc codec:gob error encoding header:", err)
+		return err
+	}
+	if err = c.enc.Encode(body); err != nil {
+		err = gobTypeError(err)
+		log.Println("rpc codec:gob error encoding body:", err)
+		return err
+	}
+	if c.frame.Len() > c.max {
+		return ErrFrameTooLarge
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(c.frame.Len()))
+	if _, err = c.w.Write(size[:]); err != nil {
+		return err
+	}
+	if _, err = c.w.Write(c.frame.Bytes()); err != nil {
+		return err
+	}
+	return c.w.flush()
+}
+
+/**
+ * 一次只提供一个帧的数据，当前帧读完后返回 io.EOF，不会把相邻的帧拼成连续的数据流
+ * 实现了 io.ByteReader，gob 直接从帧中读取，不会再包装一层预读的缓冲
+ */
+type frameReader struct {
+	r     io.Reader
+	max   int
+	buf   []byte
+	frame bytes.Reader //当前帧
+}
+
+// 读入下一个帧，上一个帧必须正好读完
+func (f *frameReader) next() error {
+	if f.frame.Len() > 0 {
+		return ErrMalformedFrame
+	}
+	var size [lengthPrefixLen]byte
+	if _, err := io.ReadFull(f.r, size[:]); err != nil {
+		return err
+	}
+	n, err := parseLengthPrefix(size[:], f.max)
+	if err != nil {
+		return err
+	}
+	if cap(f.buf) < n {
+		f.buf = make([]byte, n)
+	}
+	f.buf = f.buf[:n]
+	if _, err := io.ReadFull(f.r, f.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	f.frame.Reset(f.buf)
+	return nil
+}
+
+func (f *frameReader) Read(p []byte) (int, error) {
+	return f.frame.Read(p)
+}
+
+func (f *frameReader) ReadByte() (byte, error) {
+	return f.frame.ReadByte()
+}
+
+func (c *hardenedGobCodec) Cork()         { c.w.Cork() }
+func (c *hardenedGobCodec) Uncork() error { return c.w.Uncork() }
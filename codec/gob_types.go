@@ -0,0 +1,139 @@
+package codec
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/**
+ * gob 的类型注册
+ *
+ * 接口类型（interface{} 或自定义接口）的值在 gob 中带着具体类型的名字传输，
+ * 两端都需要事先注册具体类型，否则发送方编码失败，或者接收方无法解码：
+ *   codec.RegisterType(Circle{})   //两端的 init 中都要调用，也可以使用 geerpc.RegisterType
+ *   type Args struct{ Shape Shape }    //Shape 是接口，Circle 实现了它
+ * RegisterType 还会注册 value 中接口类型的字段、切片元素、map 的值当前保存的具体类型，
+ * 所以传入一个字段都填好的示例值就能注册整个消息用到的类型
+ * 没有注册的类型返回 UnregisteredTypeError 说明缺少哪个类型；解码时只让这一个请求失败，连接仍然可用
+ */
+
+// 接口值的具体类型没有注册
+type UnregisteredTypeError struct {
+	Name   string //类型名，编码时为 Go 的类型名，解码时为对端注册的名字
+	Encode bool   //true 表示发送方没有注册，false 表示接收方没有注册
+}
+
+func (e *UnregisteredTypeError) Error() string {
+	if e.Encode {
+		return fmt.Sprintf("rpc codec: gob: type %s is sent as an interface value but not registered, call RegisterType with a value of this type on both ends", e.Name)
+	}
+	return fmt.Sprintf("rpc codec: gob: received interface value of type %q which is not registered locally, call RegisterType with a value of this type on both ends", e.Name)
+}
+
+// 注册 value 的类型以及其中接口值的具体类型，名字冲突时返回错误
+func RegisterType(value interface{}) error {
+	return RegisterTypeName("", value)
+}
+
+/**
+ * 以指定的名字注册 value 的类型，类型移动了包或者改了名字时用旧的名字注册，保持与旧版本的兼容
+ * name 为空时使用 gob 的默认名字；value 中接口值的具体类型总是使用默认名字
+ */
+func RegisterTypeName(name string, value interface{}) error {
+	if value == nil {
+		return errors.New("rpc codec: can't register nil type")
+	}
+	if err := gobRegister(name, value); err != nil {
+		return err
+	}
+	return registerInterfaces(reflect.ValueOf(value), make(map[reflect.Type]bool))
+}
+
+// gob.Register 在名字冲突时 panic，转换为错误
+func gobRegister(name string, value interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("rpc codec: register %T: %v", value, r)
+		}
+	}()
+	if name == "" {
+		gob.Register(value)
+	} else {
+		gob.RegisterName(name, value)
+	}
+	return nil
+}
+
+// 注册 v 中接口值的具体类型，seen 记录已经检查过的结构体类型，防止循环引用
+func registerInterfaces(v reflect.Value, seen map[reflect.Type]bool) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if err := gobRegister("", v.Elem().Interface()); err != nil {
+			return err
+		}
+		return registerInterfaces(v.Elem(), seen)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return registerInterfaces(v.Elem(), seen)
+	case reflect.Struct:
+		if seen[v.Type()] {
+			return nil
+		}
+		seen[v.Type()] = true
+		for i := 0; i < v.NumField(); i++ {
+			//gob 不传输未导出的字段
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := registerInterfaces(v.Field(i), seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := registerInterfaces(v.Index(i), seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := registerInterfaces(iter.Key(), seen); err != nil {
+				return err
+			}
+			if err := registerInterfaces(iter.Value(), seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 把 gob 关于类型没有注册的错误转换为 UnregisteredTypeError，其他错误原样返回
+func gobTypeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if i := strings.Index(msg, "type not registered for interface: "); i >= 0 {
+		return &UnregisteredTypeError{Name: msg[i+len("type not registered for interface: "):], Encode: true}
+	}
+	if i := strings.Index(msg, "name not registered for interface: "); i >= 0 {
+		name := msg[i+len("name not registered for interface: "):]
+		if s, uerr := strconv.Unquote(name); uerr == nil {
+			name = s
+		}
+		//gob 已经读完整个消息，后面的数据不受影响
+		return &DecodeError{Err: &UnregisteredTypeError{Name: name}}
+	}
+	return err
+}
@@ -0,0 +1,230 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strings"
+)
+
+/**
+ * JSON 编解码器
+ *
+ * 请求头和请求体依次编码为两个 JSON 值，方便调试和其他语言接入
+ * 默认与 encoding/json 的行为一致：忽略未知字段，字段名不区分大小写
+ * 客户端和服务端的结构体定义不一致时这些差异会被静默忽略，可以通过 JsonOptions 让它们报错：
+ *   reg := codec.NewRegistry()
+ *   _ = reg.Register(codec.JsonType, codec.NewJsonCodecFunc(codec.JsonOptions{DisallowUnknownFields: true, CaseSensitive: true}))
+ *   server.SetCodecRegistry(reg)
+ * 这些选项只影响请求体，请求头总是宽松解码，以兼容新版本增加的字段
+ */
+
+type JsonOptions struct {
+	DisallowUnknownFields bool //请求体中有结构体没有的字段时报错
+	CaseSensitive         bool //字段名必须与结构体的 JSON 字段名大小写一致
+	//解码前按 default tag 设置字段的默认值，请求体中没有的字段保留默认值，如 `default:"10"`
+	//字符串字段直接使用 tag 的值，其他类型的 tag 按 JSON 解析
+	ApplyDefaults bool
+}
+
+type jsonCodec struct {
+	conn io.ReadWriteCloser
+	buf  *corkWriter
+	dec  *json.Decoder
+	enc  *json.Encoder
+	opt  JsonOptions
+}
+
+var _ Codec = (*jsonCodec)(nil)
+
+// 默认选项的 JSON 编解码器
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	return NewJsonCodecFunc(JsonOptions{})(conn)
+}
+
+func NewJsonCodecFunc(opt JsonOptions) NewCodecFunc {
+	return func(conn io.ReadWriteCloser) Codec {
+		buf := newCorkWriter(conn)
+		return &jsonCodec{
+			conn: conn,
+			buf:  buf,
+			dec:  json.NewDecoder(streamReader(conn)),
+			enc:  json.NewEncoder(buf),
+			opt:  opt,
+		}
+	}
+}
+
+func (c *jsonCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *jsonCodec) ReadHeader(h *Header) error {
+	return c.dec.Decode(h)
+}
+
+func (c *jsonCodec) ReadBody(body interface{}) error {
+	var raw json.RawMessage
+	if err := c.dec.Decode(&raw); err != nil || body == nil {
+		return err
+	}
+	if err := c.decodeBody(raw, body); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+func (c *jsonCodec) decodeBody(raw json.RawMessage, body interface{}) error {
+	if c.opt.ApplyDefaults {
+		if err := applyDefaults(reflect.ValueOf(body)); err != nil {
+			return err
+		}
+	}
+	//按选项单独解码，解码出错不影响流中后面的数据
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if c.opt.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(body); err != nil {
+		return err
+	}
+	if c.opt.CaseSensitive {
+		return checkFieldCase(raw, reflect.TypeOf(body))
+	}
+	return nil
+}
+
+func (c *jsonCodec) Write(h *Header, body interface{}) (err error) {
+	defer func() {
+		_ = c.buf.flush()
+		if err != nil {
+			_ = c.Close()
+		}
+	}()
+	if err = c.enc.Encode(h); err != nil {
+		log.Println("rpc codec:json error encoding header:", err)
+		return err
+	}
+	if err = c.enc.Encode(body); err != nil {
+		log.Println("rpc codec:json error encoding body:", err)
+		return err
+	}
+	return nil
+}
+
+// 按 default tag 设置结构体字段的默认值，嵌套的结构体也会处理
+func applyDefaults(v reflect.Value) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if def, ok := f.Tag.Lookup("default"); ok {
+			if fv.Kind() == reflect.String {
+				fv.SetString(def)
+			} else if err := json.Unmarshal([]byte(def), fv.Addr().Interface()); err != nil {
+				return fmt.Errorf("rpc codec: invalid default for field %s: %v", f.Name, err)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Struct {
+			if err := applyDefaults(fv.Addr()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 结构体的 JSON 字段名，匿名嵌入的结构体字段会展开，与 encoding/json 一致
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			jsonFields(ft, fields)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+}
+
+// 检查 JSON 中的字段名与结构体定义的大小写是否一致，递归检查嵌套的结构体、切片和 map
+func checkFieldCase(raw json.RawMessage, t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		jsonFields(t, fields)
+		for key, value := range obj {
+			ft, ok := fields[key]
+			if !ok {
+				for name := range fields {
+					if strings.EqualFold(name, key) {
+						return fmt.Errorf("rpc codec: json field %q does not match the case of %q", key, name)
+					}
+				}
+				continue
+			}
+			if err := checkFieldCase(value, ft); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil
+		}
+		for _, item := range items {
+			if err := checkFieldCase(item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil
+		}
+		for _, value := range obj {
+			if err := checkFieldCase(value, t.Elem()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *jsonCodec) Cork()         { c.buf.Cork() }
+func (c *jsonCodec) Uncork() error { return c.buf.Uncork() }
@@ -0,0 +1,36 @@
+package codec
+
+import (
+	"bytes"
+	"sync"
+)
+
+/**
+ * 缓冲区复用
+ *
+ * 按帧编解码的编解码器每个消息都需要一块临时缓冲区，高 QPS 时频繁分配会增加 GC 压力，
+ * 这里用 sync.Pool 复用。过大的缓冲区不放回池中，避免偶尔的大消息长期占用内存
+ */
+
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// 从池中取一个缓冲区，返回长度为 n 的切片用于读数据，用完后 putBuffer
+func getFrame(n int) (*bytes.Buffer, []byte) {
+	b := getBuffer()
+	b.Grow(n)
+	return b, b.Bytes()[:n]
+}
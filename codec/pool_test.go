@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+/**
+ * 按帧编解码的编解码器的基准测试，关注每个消息的分配次数：
+ *   go test ./codec -run '^$' -bench . -benchmem
+ * 缓冲区复用之前和之后的对比见 BenchmarkFrameBuffer，
+ * 也可以在复用之前的提交上运行同样的基准测试（只依赖导出的构造函数）对比 allocs/op
+ */
+
+// 写入的数据留在内存中，由同一个编解码器读回
+type loopback struct {
+	bytes.Buffer
+}
+
+func (l *loopback) Close() error { return nil }
+
+type benchBody struct {
+	ID    int
+	Name  string
+	Items []string
+}
+
+var benchBodies = map[string]*benchBody{
+	"small": {ID: 1, Name: "foo"},
+	"large": {ID: 2, Name: strings.Repeat("bar", 1000), Items: strings.Fields(strings.Repeat("item ", 500))},
+}
+
+func benchmarkRoundTrip(b *testing.B, f NewCodecFunc) {
+	for name, body := range benchBodies {
+		b.Run(name, func(b *testing.B) {
+			conn := new(loopback)
+			cc := f(conn)
+			h := &Header{ServiceMethod: "Foo.Sum", Seq: 1}
+			var rh Header
+			var rb benchBody
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := cc.Write(h, body); err != nil {
+					b.Fatal(err)
+				}
+				rh = Header{}
+				if err := cc.ReadHeader(&rh); err != nil {
+					b.Fatal(err)
+				}
+				rb = benchBody{}
+				if err := cc.ReadBody(&rb); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkChecksumCodec(b *testing.B) {
+	f, err := NewChecksumCodecFunc(GobType)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkRoundTrip(b, f)
+}
+
+func BenchmarkCompressedCodec(b *testing.B) {
+	f, err := NewCompressedCodecFunc(GobType, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkRoundTrip(b, f)
+}
+
+// 一端写，另一端读，包括加解密
+func BenchmarkEncryptedCodec(b *testing.B) {
+	opt := EncryptOption{Cipher: ChaCha20Poly1305, Key: bytes.Repeat([]byte{7}, 32)}
+	f := NewEncryptedCodecFunc(NewGobCodec, opt)
+	for name, body := range benchBodies {
+		b.Run(name, func(b *testing.B) {
+			c1, c2 := net.Pipe()
+			ch := make(chan Codec)
+			go func() { ch <- f(c2) }()
+			client := f(c1)
+			server := <-ch
+			defer func() { _ = client.Close(); _ = server.Close() }()
+			h := &Header{ServiceMethod: "Foo.Sum", Seq: 1}
+			errc := make(chan error, 1)
+			b.ReportAllocs()
+			b.ResetTimer()
+			go func() {
+				for i := 0; i < b.N; i++ {
+					if err := client.Write(h, body); err != nil {
+						errc <- err
+						return
+					}
+				}
+				errc <- nil
+			}()
+			var rh Header
+			var rb benchBody
+			for i := 0; i < b.N; i++ {
+				if err := server.ReadHeader(&rh); err != nil {
+					b.Fatal(err)
+				}
+				rb = benchBody{}
+				if err := server.ReadBody(&rb); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := <-errc; err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// 读帧时复用缓冲区与每次分配的对比
+func BenchmarkFrameBuffer(b *testing.B) {
+	for _, size := range []int{512, 16 << 10} {
+		src := bytes.Repeat([]byte{1}, size)
+		b.Run("pooled/"+strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf, data := getFrame(size)
+				copy(data, src)
+				putBuffer(buf)
+			}
+		})
+		b.Run("unpooled/"+strconv.Itoa(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data := make([]byte, size)
+				copy(data, src)
+				sink = data
+			}
+		})
+	}
+}
+
+var sink []byte
@@ -0,0 +1,73 @@
+package codec
+
+import (
+	"fmt"
+	"sync"
+)
+
+/**
+ * 编解码器注册
+ *
+ * 第三方编解码器通过 Register 注册到默认的注册表，不需要修改全局的 NewCodecFuncMap，并发安全，重复注册返回错误
+ * Server 和 Client 也可以使用自己的注册表（Server.SetCodecRegistry、Option.Codecs），
+ * 例如为某个服务器使用不同参数的同类型编解码器；自己的注册表中找不到时再查默认注册表
+ */
+
+type Registry struct {
+	mu     sync.RWMutex
+	codecs map[Type]NewCodecFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{codecs: make(map[Type]NewCodecFunc)}
+}
+
+// 默认注册表，包含内置的编解码器
+var DefaultRegistry = NewRegistry()
+
+// 注册编解码器，同一个类型只能注册一次
+func (r *Registry) Register(t Type, f NewCodecFunc) error {
+	if t == "" || f == nil {
+		return fmt.Errorf("rpc codec: invalid registration for type %q", t)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.codecs[t]; dup {
+		return fmt.Errorf("rpc codec: codec type %s already registered", t)
+	}
+	r.codecs[t] = f
+	return nil
+}
+
+// 找不到时返回 nil
+func (r *Registry) Get(t Type) NewCodecFunc {
+	r.mu.RLock()
+	f := r.codecs[t]
+	r.mu.RUnlock()
+	if f == nil && r == DefaultRegistry {
+		//兼容直接修改 NewCodecFuncMap 的旧代码
+		f = NewCodecFuncMap[t]
+	}
+	return f
+}
+
+// 注册到默认注册表
+func Register(t Type, f NewCodecFunc) error {
+	return DefaultRegistry.Register(t, f)
+}
+
+// 先在 r 中查找，找不到时查默认注册表，r 可以为 nil
+func Lookup(r *Registry, t Type) NewCodecFunc {
+	if r != nil {
+		if f := r.Get(t); f != nil {
+			return f
+		}
+	}
+	return DefaultRegistry.Get(t)
+}
+
+func mustRegister(t Type, f NewCodecFunc) {
+	if err := Register(t, f); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,38 @@
+package codec
+
+import (
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// 只计数的 Writer
+type countWriter int
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	*w += countWriter(len(p))
+	return len(p), nil
+}
+
+/**
+ * 按编解码类型计算 v 编码后的字节数，用于发送前检查大小
+ * gob 的结果包含类型定义，比连接上实际发送的略大；不认识的类型返回 false
+ */
+func EncodedSize(t Type, v interface{}) (int, bool, error) {
+	switch t {
+	case GobType, HardenedGobType:
+		var w countWriter
+		if err := gob.NewEncoder(&w).Encode(v); err != nil {
+			return 0, true, gobTypeError(err)
+		}
+		return int(w), true, nil
+	case JsonType:
+		data, err := json.Marshal(v)
+		return len(data), true, err
+	case CborType:
+		data, err := cbor.Marshal(v)
+		return len(data), true, err
+	}
+	return 0, false, nil
+}
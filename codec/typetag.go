@@ -0,0 +1,188 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+/**
+ * 类型标签
+ *
+ * JSON、CBOR 等编码不带 Go 的类型信息，接口类型的值无法还原为原来的具体类型。
+ * 为具体类型注册一个与语言无关的标签后：
+ * 1.服务方法的参数或响应声明为接口时，发送方在请求头 BodyType 中带上请求体的标签，接收方按标签创建具体类型再解码（见 geerpc 的 typetag.go）
+ * 2.结构体中的接口字段声明为 Any，编码为 {"@type": 标签, "value": 值}，解码时按标签还原：
+ *   codec.RegisterTag("shape.circle", Circle{})
+ *   codec.RegisterTag("shape.square", &Square{})   //注册指针时解码得到的也是指针
+ *   type Drawing struct{ Shapes []codec.Any }
+ *   d.Shapes[0].Value.(Circle)
+ * 两端需要注册同样的标签；发送的值必须与注册时的类型一致（值或指针），否则不带标签
+ * 注册标签时同时向 gob 注册这个类型（见 RegisterType），gob 编解码也可以使用
+ */
+
+var (
+	tagMu     sync.RWMutex
+	tagTypes  = make(map[string]reflect.Type)
+	typeTags  = make(map[reflect.Type]string)
+	tagsInUse int32 //注册过标签时为1，没有注册时发送方跳过查找
+)
+
+// 为 value 的类型注册标签，标签或类型已经注册过时返回错误（同样的标签和类型重复注册除外）
+func RegisterTag(tag string, value interface{}) error {
+	if tag == "" || value == nil {
+		return errors.New("rpc codec: invalid type tag registration")
+	}
+	t := reflect.TypeOf(value)
+	tagMu.Lock()
+	defer tagMu.Unlock()
+	if old, ok := tagTypes[tag]; ok && old != t {
+		return fmt.Errorf("rpc codec: type tag %q already registered for %s", tag, old)
+	}
+	if old, ok := typeTags[t]; ok && old != tag {
+		return fmt.Errorf("rpc codec: type %s already registered with tag %q", t, old)
+	}
+	//gob 按自己的注册传输接口值，一起注册后 Any 在 gob 中也可以使用
+	if err := gobRegister("", value); err != nil {
+		return err
+	}
+	tagTypes[tag], typeTags[t] = t, tag
+	atomic.StoreInt32(&tagsInUse, 1)
+	return nil
+}
+
+// value 的类型注册的标签，没有注册时返回 false
+func TagOf(value interface{}) (string, bool) {
+	if value == nil || atomic.LoadInt32(&tagsInUse) == 0 {
+		return "", false
+	}
+	tagMu.RLock()
+	tag, ok := typeTags[reflect.TypeOf(value)]
+	tagMu.RUnlock()
+	return tag, ok
+}
+
+// 标签对应的类型，没有注册时返回 false
+func TagType(tag string) (reflect.Type, bool) {
+	tagMu.RLock()
+	t, ok := tagTypes[tag]
+	tagMu.RUnlock()
+	return t, ok
+}
+
+// 收到的标签没有注册
+type UnknownTagError struct {
+	Tag string
+}
+
+func (e *UnknownTagError) Error() string {
+	return fmt.Sprintf("rpc codec: unknown type tag %q, register it with RegisterTag", e.Tag)
+}
+
+// 按标签创建一个可以解码的新实例，返回指向它的指针
+func newTagged(tag string) (reflect.Value, error) {
+	t, ok := TagType(tag)
+	if !ok {
+		return reflect.Value{}, &UnknownTagError{Tag: tag}
+	}
+	return reflect.New(t), nil
+}
+
+// 带类型标签的任意值，用作结构体中接口类型的字段
+type Any struct {
+	Value interface{}
+}
+
+// 编码时的结构，Value 为nil时 Type 为空
+type anyJSON struct {
+	Type  string          `json:"@type,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type anyCBOR struct {
+	Type  string          `cbor:"@type,omitempty"`
+	Value cbor.RawMessage `cbor:"value,omitempty"`
+}
+
+func (a Any) tag() (string, error) {
+	tag, ok := TagOf(a.Value)
+	if !ok {
+		return "", fmt.Errorf("rpc codec: type %T has no type tag, register it with RegisterTag", a.Value)
+	}
+	return tag, nil
+}
+
+func (a Any) MarshalJSON() ([]byte, error) {
+	if a.Value == nil {
+		return []byte("null"), nil
+	}
+	tag, err := a.tag()
+	if err != nil {
+		return nil, err
+	}
+	v, err := json.Marshal(a.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(anyJSON{Type: tag, Value: v})
+}
+
+func (a *Any) UnmarshalJSON(data []byte) error {
+	var raw anyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Type == "" {
+		a.Value = nil
+		return nil
+	}
+	v, err := newTagged(raw.Type)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(raw.Value, v.Interface()); err != nil {
+		return err
+	}
+	a.Value = v.Elem().Interface()
+	return nil
+}
+
+func (a Any) MarshalCBOR() ([]byte, error) {
+	if a.Value == nil {
+		return cbor.Marshal(nil)
+	}
+	tag, err := a.tag()
+	if err != nil {
+		return nil, err
+	}
+	v, err := cbor.Marshal(a.Value)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(anyCBOR{Type: tag, Value: v})
+}
+
+func (a *Any) UnmarshalCBOR(data []byte) error {
+	var raw anyCBOR
+	if err := cbor.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Type == "" {
+		a.Value = nil
+		return nil
+	}
+	v, err := newTagged(raw.Type)
+	if err != nil {
+		return err
+	}
+	if err = cbor.Unmarshal(raw.Value, v.Interface()); err != nil {
+		return err
+	}
+	a.Value = v.Elem().Interface()
+	return nil
+}
@@ -0,0 +1,306 @@
+package geerpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"geerpc/codec"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/**
+ * 配置文件
+ *
+ * 从 YAML 或 JSON 文件（按扩展名区分）读取服务端、客户端和负载均衡客户端的设置，部署时调整不需要重新编译：
+ *   server:
+ *     listen: ["tcp@:9999", "unix@/tmp/rpc.sock"]
+ *     handleTimeout: 5s
+ *     clientLimit: 100
+ *     tls: {certFile: server.pem, keyFile: server.key}
+ *   client:
+ *     codec: application/json
+ *     connectTimeout: 1s
+ *   xclient:
+ *     registry: http://localhost:9999/_geerpc_/registry
+ *     select: roundrobin
+ *     failMode: failover
+ *     retries: 2
+ * 使用：
+ *   cfg, _ := geerpc.LoadConfig("rpc.yaml")
+ *   server, _ := cfg.Server.NewServer()
+ *   _ = cfg.Server.AddListeners(server)
+ *   go server.Serve()
+ *   opts, _ := cfg.Client.DialOptions()
+ *   client, _ := geerpc.Dial("tcp", addr, opts...)
+ *   xc, _ := xclient.NewXClientFromConfig(cfg)
+ * 时间使用 time.ParseDuration 的格式，如 "500ms"、"2s"；没有设置的字段使用默认值
+ */
+
+type Config struct {
+	Server  ServerConfig  `json:"server" yaml:"server"`
+	Client  ClientConfig  `json:"client" yaml:"client"`
+	XClient XClientConfig `json:"xclient" yaml:"xclient"`
+}
+
+// 配置文件中的时间
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type TLSConfig struct {
+	CertFile string `json:"certFile" yaml:"certFile"` //本端证书，服务端必须设置
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+	//校验对端证书的 CA，客户端为空时使用系统的 CA；服务端设置时要求客户端提供证书
+	CAFile             string `json:"caFile" yaml:"caFile"`
+	ServerName         string `json:"serverName" yaml:"serverName"` //客户端校验的服务端名字，为空时使用连接的地址
+	InsecureSkipVerify bool   `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+}
+
+type ServerConfig struct {
+	Listen        []string   `json:"listen" yaml:"listen"` //protocol@addr，如 tcp@:9999、unix@/tmp/rpc.sock
+	TLS           *TLSConfig `json:"tls" yaml:"tls"`       //不为nil时 tcp 监听器使用 TLS
+	HandleTimeout Duration   `json:"handleTimeout" yaml:"handleTimeout"`
+	DrainTimeout  Duration   `json:"drainTimeout" yaml:"drainTimeout"`
+	SlowThreshold Duration   `json:"slowThreshold" yaml:"slowThreshold"`
+	ClientLimit   int        `json:"clientLimit" yaml:"clientLimit"` //每个客户端的在途请求数上限
+	MaxInflight   int        `json:"maxInflight" yaml:"maxInflight"` //整个服务器的在途请求数上限，超过时拒绝请求
+	Reflection    bool       `json:"reflection" yaml:"reflection"`   //注册 Reflection 服务
+	AllowCIDRs    []string   `json:"allowCIDRs" yaml:"allowCIDRs"`   //允许连接的来源，CIDR 或 IP，为空时不限制
+	DenyCIDRs     []string   `json:"denyCIDRs" yaml:"denyCIDRs"`     //拒绝连接的来源，优先于 AllowCIDRs
+	//握手限制，为nil时不限制
+	Handshake *HandshakeConfig `json:"handshake" yaml:"handshake"`
+}
+
+type HandshakeConfig struct {
+	Timeout    Duration `json:"timeout" yaml:"timeout"`       //读完 Option 的超时时间
+	MaxPending int      `json:"maxPending" yaml:"maxPending"` //同时还没有完成握手的连接数上限
+	PerIPRate  float64  `json:"perIPRate" yaml:"perIPRate"`   //每个来源 IP 每秒允许的新连接数
+	PerIPBurst int      `json:"perIPBurst" yaml:"perIPBurst"`
+}
+
+type ClientConfig struct {
+	Codec          codec.Type `json:"codec" yaml:"codec"`
+	ConnectTimeout Duration   `json:"connectTimeout" yaml:"connectTimeout"`
+	ClientID       string     `json:"clientID" yaml:"clientID"`
+	TLS            *TLSConfig `json:"tls" yaml:"tls"`     //不为nil时建立 TLS 连接
+	Proxy          string     `json:"proxy" yaml:"proxy"` //代理地址，如 socks5://host:1080，为 env 时读取环境变量
+}
+
+type XClientConfig struct {
+	Servers  []string `json:"servers" yaml:"servers"`   //静态的实例列表，protocol@addr
+	Registry string   `json:"registry" yaml:"registry"` //注册中心的地址，设置时忽略 Servers
+	Select   string   `json:"select" yaml:"select"`     //random、roundrobin、consistenthash、weighted、leastloaded
+	FailMode string   `json:"failMode" yaml:"failMode"` //failfast、failover、failtry
+	Retries  int      `json:"retries" yaml:"retries"`
+}
+
+// 读取配置文件，.yaml/.yml 按 YAML 解析，其他按 JSON 解析，未知的字段报错
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(Config)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rpc config: %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// 按配置创建服务器，extra 在配置之后生效
+func (c *ServerConfig) NewServer(extra ...ServerOption) (*Server, error) {
+	opts := []ServerOption{
+		WithHandleTimeout(time.Duration(c.HandleTimeout)),
+		WithDrainTimeout(time.Duration(c.DrainTimeout)),
+		WithSlowThreshold(time.Duration(c.SlowThreshold)),
+	}
+	if len(c.AllowCIDRs) > 0 || len(c.DenyCIDRs) > 0 {
+		f, err := NewIPFilter(c.AllowCIDRs, c.DenyCIDRs)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithIPFilter(f))
+	}
+	if h := c.Handshake; h != nil {
+		opts = append(opts, WithHandshakeLimits(HandshakeLimits{
+			Timeout:    time.Duration(h.Timeout),
+			MaxPending: h.MaxPending,
+			PerIPRate:  h.PerIPRate,
+			PerIPBurst: h.PerIPBurst,
+		}))
+	}
+	server := NewServer(append(opts, extra...)...)
+	if c.ClientLimit > 0 {
+		server.SetClientLimit(c.ClientLimit)
+	}
+	if c.MaxInflight > 0 {
+		server.SetLoadShedding(LoadShedOption{MaxInflight: c.MaxInflight})
+	}
+	if c.Reflection {
+		if err := server.EnableReflection(); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// 按配置监听所有地址并添加到 server，之后调用 server.Serve
+func (c *ServerConfig) AddListeners(server *Server) error {
+	if len(c.Listen) == 0 {
+		return ErrNoListeners
+	}
+	var tlsConfig *tls.Config
+	if c.TLS != nil {
+		var err error
+		if tlsConfig, err = c.TLS.serverConfig(); err != nil {
+			return err
+		}
+	}
+	var listeners []net.Listener
+	fail := func(err error) error {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+		return err
+	}
+	for _, addr := range c.Listen {
+		protocol, address, ok := strings.Cut(addr, "@")
+		if !ok {
+			return fail(fmt.Errorf("rpc config: wrong listen address '%s', expect protocol@addr", addr))
+		}
+		var l net.Listener
+		var err error
+		if protocol == "unix" {
+			l, err = ListenUnix(address)
+		} else {
+			l, err = net.Listen(protocol, address)
+			if err == nil && tlsConfig != nil {
+				l = tls.NewListener(l, tlsConfig)
+			}
+		}
+		if err != nil {
+			return fail(err)
+		}
+		listeners = append(listeners, l)
+	}
+	for _, l := range listeners {
+		if err := server.AddListener(l); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+// 配置对应的客户端选项，TLS 证书读取失败时返回错误
+func (c *ClientConfig) DialOptions() ([]DialOption, error) {
+	opts := []DialOption{
+		WithCodec(c.Codec),
+		WithConnectTimeout(time.Duration(c.ConnectTimeout)),
+		WithClientID(c.ClientID),
+	}
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.clientConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLS(tlsConfig))
+	}
+	switch c.Proxy {
+	case "":
+	case "env":
+		opts = append(opts, WithProxyFromEnvironment())
+	default:
+		if _, err := proxyDialerFromString(c.Proxy); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithProxy(c.Proxy))
+	}
+	return opts, nil
+}
+
+// 配置对应的 Option，供只接受 *Option 的接口使用（如 xclient）
+func (c *ClientConfig) Option() (*Option, error) {
+	opts, err := c.DialOptions()
+	if err != nil {
+		return nil, err
+	}
+	return parseOptions(opts...), nil
+}
+
+func (c *TLSConfig) serverConfig() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("rpc config: server tls requires certFile and keyFile")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if c.CAFile != "" {
+		if config.ClientCAs, err = loadCertPool(c.CAFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+func (c *TLSConfig) clientConfig() (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		var err error
+		if config.RootCAs, err = loadCertPool(c.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("rpc config: no certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,227 @@
+package geerpc
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/**
+ * 环境变量和命令行参数覆盖配置
+ *
+ * 同一个二进制在不同环境中只通过环境变量调整（12-factor），优先级从低到高：
+ *   1.字段的默认值
+ *   2.配置文件，见 LoadConfig
+ *   3.环境变量：前缀加字段路径，驼峰转为大写下划线，如 GEERPC_SERVER_HANDLE_TIMEOUT=2s、GEERPC_CLIENT_TLS_CA_FILE=ca.pem
+ *   4.命令行参数：字段路径用 "." 连接，如 -server.handleTimeout=2s、-xclient.retries=3
+ * 列表（如 server.listen）用逗号分隔；设置了 TLS 下的任意字段时才会创建 TLS 配置
+ * 一般用法：
+ *   cfg, err := geerpc.LoadConfigWithOverrides("GEERPC", os.Args[1:])
+ * 配置文件的路径由 -config 参数或 GEERPC_CONFIG 环境变量指定，都没有时只使用环境变量和参数
+ * 已经有自己的 FlagSet 时用 ApplyEnv 和 RegisterFlags 组合
+ */
+
+// 配置中的一个字段
+type configField struct {
+	path []string           //YAML 中的字段名，如 ["server", "handleTimeout"]
+	set  func(string) error //解析字符串并设置字段
+	get  func() string
+}
+
+// 遍历配置的所有字段
+func (cfg *Config) fields() []configField {
+	var fields []configField
+	//v 返回字段所在的结构体，alloc 为 false 时不创建指针字段，返回无效的 Value
+	var walk func(path []string, v func(alloc bool) reflect.Value, t reflect.Type)
+	walk = func(path []string, v func(alloc bool) reflect.Value, t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			p := append(append([]string(nil), path...), name)
+			i := i
+			field := func(alloc bool) reflect.Value {
+				if sv := v(alloc); sv.IsValid() {
+					return sv.Field(i)
+				}
+				return reflect.Value{}
+			}
+			switch {
+			case f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct:
+				//指针字段在第一次设置时创建
+				elem := func(alloc bool) reflect.Value {
+					fv := field(alloc)
+					if !fv.IsValid() || (fv.IsNil() && !alloc) {
+						return reflect.Value{}
+					}
+					if fv.IsNil() {
+						fv.Set(reflect.New(f.Type.Elem()))
+					}
+					return fv.Elem()
+				}
+				walk(p, elem, f.Type.Elem())
+			case f.Type.Kind() == reflect.Struct:
+				walk(p, field, f.Type)
+			default:
+				fields = append(fields, configField{
+					path: p,
+					set:  func(s string) error { return setConfigValue(field(true), s) },
+					get: func() string {
+						if fv := field(false); fv.IsValid() {
+							return formatConfigValue(fv)
+						}
+						return ""
+					},
+				})
+			}
+		}
+	}
+	root := reflect.ValueOf(cfg).Elem()
+	walk(nil, func(bool) reflect.Value { return root }, root.Type())
+	return fields
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func setConfigValue(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func formatConfigValue(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// 环境变量名：handleTimeout -> HANDLE_TIMEOUT，clientID -> CLIENT_ID
+func envName(prefix string, path []string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, p := range path {
+		b.WriteByte('_')
+		for i, r := range p {
+			if unicode.IsUpper(r) && i > 0 && !unicode.IsUpper(rune(p[i-1])) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// 用环境变量覆盖配置，prefix 如 "GEERPC"
+func (cfg *Config) ApplyEnv(prefix string) error {
+	for _, f := range cfg.fields() {
+		name := envName(prefix, f.path)
+		if s, ok := os.LookupEnv(name); ok {
+			if err := f.set(s); err != nil {
+				return fmt.Errorf("rpc config: %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 配置字段对应的命令行参数
+type configFlag configField
+
+func (f configFlag) String() string {
+	if f.get == nil {
+		return ""
+	}
+	return f.get()
+}
+
+func (f configFlag) Set(s string) error {
+	return f.set(s)
+}
+
+// 在 fs 上注册所有字段对应的参数，fs.Parse 时直接修改 cfg，所以要在读取文件和 ApplyEnv 之后解析
+func (cfg *Config) RegisterFlags(fs *flag.FlagSet) {
+	for _, f := range cfg.fields() {
+		fs.Var(configFlag(f), strings.Join(f.path, "."), "overrides "+strings.Join(f.path, ".")+" in the config file")
+	}
+}
+
+/**
+ * 按优先级读取配置：配置文件、环境变量、命令行参数
+ * args 中只能包含配置相关的参数（-config 和各字段），返回前检查参数没有多余的位置参数
+ */
+func LoadConfigWithOverrides(envPrefix string, args []string) (*Config, error) {
+	//先找到配置文件的路径，参数优先于环境变量
+	path := os.Getenv(envPrefix + "_CONFIG")
+	pre := flag.NewFlagSet("config", flag.ContinueOnError)
+	pre.SetOutput(io.Discard)
+	pre.StringVar(&path, "config", path, "config file")
+	new(Config).RegisterFlags(pre)
+	if err := pre.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := new(Config)
+	if path != "" {
+		var err error
+		if cfg, err = LoadConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(envPrefix); err != nil {
+		return nil, err
+	}
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.String("config", path, "config file")
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("rpc config: unexpected arguments %v", fs.Args())
+	}
+	return cfg, nil
+}
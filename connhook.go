@@ -0,0 +1,73 @@
+package geerpc
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+/**
+ * 连接事件
+ *
+ * 服务端：
+ *   OnConnect     新连接建立，Option 握手之前调用，返回 false 时关闭连接（如按 IP 白名单拒绝）；
+ *                 返回的 ctx 是这个连接上所有请求的 context 的基础，可以通过 context.WithValue 附加连接的状态，
+ *                 服务方法从自己的 ctx 中读取；ctx 为nil时使用 context.Background()
+ *   OnDisconnect  连接关闭后调用，err 为导致关闭的错误，对端正常关闭时为nil
+ *   server.OnConnect(func(conn io.ReadWriteCloser) (context.Context, bool) {
+ *       nc, ok := conn.(net.Conn)
+ *       if !ok || !allowed(nc.RemoteAddr()) {
+ *           return nil, false
+ *       }
+ *       return context.WithValue(context.Background(), sessionKey{}, newSession(nc)), true
+ *   })
+ * 与插件的 OnConnect/OnDisconnect 相比，可以为连接附加状态并得到关闭的原因
+ *
+ * 客户端：
+ *   WithOnConnect     建立连接（包括 TLS 握手）后、发送 Option 之前调用，返回错误时放弃这个连接
+ *   WithOnDisconnect  连接出错或调用 Close 后调用，err 为nil表示调用了 Close
+ *   ReconnectOption.OnReconnect  自动重连成功后调用
+ * 客户端的回调在单独的 goroutine 中调用
+ */
+
+// 设置连接建立时的回调，需要在 Accept 之前调用
+func (server *Server) OnConnect(fn func(conn io.ReadWriteCloser) (context.Context, bool)) {
+	server.onConnect = fn
+}
+
+// 设置连接关闭后的回调，需要在 Accept 之前调用
+func (server *Server) OnDisconnect(fn func(conn io.ReadWriteCloser, err error)) {
+	server.onDisconnect = fn
+}
+
+// 调用 OnConnect，返回连接上请求的基础 context
+func (server *Server) connected(conn io.ReadWriteCloser) (context.Context, bool) {
+	if server.onConnect == nil {
+		return context.Background(), true
+	}
+	ctx, ok := server.onConnect(conn)
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return ctx, ok
+}
+
+func (server *Server) disconnected(conn io.ReadWriteCloser, err error) {
+	if server.onDisconnect != nil {
+		server.onDisconnect(conn, err)
+	}
+}
+
+// 客户端建立连接后、发送 Option 之前调用 fn，返回错误时关闭连接，Dial 返回这个错误
+func WithOnConnect(fn func(conn net.Conn) error) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.OnConnect = fn
+	})
+}
+
+// 客户端连接出错或关闭后调用 fn，err 为nil表示调用了 Close
+func WithOnDisconnect(fn func(err error)) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.OnDisconnect = fn
+	})
+}
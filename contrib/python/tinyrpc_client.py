@@ -0,0 +1,104 @@
+"""
+tiny-rpc 的 Python 参考客户端
+
+只依赖标准库，使用 JSON 编解码器，协议见仓库根目录的 wire.go：
+
+    from tinyrpc_client import Client
+    with Client("127.0.0.1", 9999) as c:
+        print(c.call("Foo.Sum", {"Num1": 1, "Num2": 2}))
+
+一个连接上的调用是串行的，需要并发时为每个线程建立一个 Client
+"""
+
+import json
+import socket
+import time
+
+MAGIC_NUMBER = 0x34252
+JSON_TYPE = "application/json"
+CANCEL_SERVICE_METHOD = "geerpc.Cancel"
+
+
+class RPCError(Exception):
+    """服务端返回的错误，message 与 Go 客户端的 ServerError 相同"""
+
+
+class Client:
+    def __init__(self, host, port, timeout=None, client_id=""):
+        self._sock = socket.create_connection((host, port), timeout=timeout)
+        self._rfile = self._sock.makefile("rb")
+        self._decoder = json.JSONDecoder()
+        self._buf = ""
+        self._seq = 0
+        # 握手：Option 以换行符结尾，服务端不回复
+        opt = {"MagicNumber": MAGIC_NUMBER, "CodecType": JSON_TYPE}
+        if client_id:
+            opt["ClientID"] = client_id
+        self._send(opt)
+
+    def close(self):
+        self._rfile.close()
+        self._sock.close()
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
+
+    def call(self, service_method, args, deadline=None, version="", priority=0, meta=None):
+        """调用并返回解码后的响应，deadline 为相对的秒数"""
+        self._seq += 1
+        header = {"ServiceMethod": service_method, "Seq": self._seq}
+        if deadline is not None:
+            header["Deadline"] = int((time.time() + deadline) * 1e9)
+        if version:
+            header["Version"] = version
+        if priority:
+            header["Priority"] = priority
+        if meta:
+            header["Meta"] = meta
+        self._send(header, args)
+        while True:
+            h = self._read()
+            body = self._read()
+            if h.get("Callback"):
+                # 没有在握手时打开回调，正常情况下不会收到
+                continue
+            if h.get("Seq") != self._seq:
+                # 之前超时放弃的调用的响应
+                continue
+            if h.get("Error"):
+                raise RPCError(h["Error"])
+            return body
+
+    def _send(self, *values):
+        data = "".join(json.dumps(v, separators=(",", ":")) + "\n" for v in values)
+        self._sock.sendall(data.encode("utf-8"))
+
+    def _read(self):
+        """读取一个 JSON 值，值之间以空白分隔"""
+        while True:
+            s = self._buf.lstrip()
+            if s:
+                try:
+                    value, end = self._decoder.raw_decode(s)
+                    self._buf = s[end:]
+                    return value
+                except ValueError:
+                    pass
+            line = self._rfile.readline()
+            if not line:
+                raise ConnectionError("rpc client: connection closed")
+            self._buf = s + line.decode("utf-8")
+
+
+if __name__ == "__main__":
+    import sys
+
+    if len(sys.argv) != 4:
+        print("usage: tinyrpc_client.py host:port Service.Method '<json args>'")
+        sys.exit(2)
+    host, _, port = sys.argv[1].rpartition(":")
+    with Client(host, int(port)) as c:
+        print(json.dumps(c.call(sys.argv[2], json.loads(sys.argv[3]))))
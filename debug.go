@@ -0,0 +1,87 @@
+package geerpc
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+/**
+ * 调试页面
+ *
+ * 以 HTML 列出服务器的统计、当前连接和每个方法的调用数、失败数和耗时，
+ * 不需要其他工具就能在浏览器中查看服务器的状态：
+ *   server.HandleDebug()
+ *   go http.ListenAndServe(":8080", nil)   //访问 http://localhost:8080/debug/geerpc
+ * 需要同时查看 expvar 和 pprof 时使用 geerpc/rpcdebug 挂载
+ */
+
+const DefaultDebugPath = "/debug/geerpc"
+
+const debugText = `<html>
+<head><title>GeeRPC Services</title></head>
+<body>
+<h2>Server</h2>
+<table border="1" cellpadding="4">
+<tr><th>Connections</th><th>Requests</th><th>Errors</th><th>Inflight</th><th>SlowCalls</th><th>RejectedConns</th><th>HandshakeTimeouts</th><th>BytesSent</th><th>BytesReceived</th></tr>
+{{with .Stats}}<tr><td>{{.Connections}}</td><td>{{.Requests}}</td><td>{{.Errors}}</td><td>{{.Inflight}}</td><td>{{.SlowCalls}}</td><td>{{.RejectedConns}}</td><td>{{.HandshakeTimeouts}}</td><td>{{.BytesSent}}</td><td>{{.BytesReceived}}</td></tr>{{end}}
+</table>
+<h2>Methods</h2>
+<table border="1" cellpadding="4">
+<tr><th>Method</th><th>Type</th><th>Calls</th><th>Errors</th><th>Mean</th><th>P50</th><th>P90</th><th>P99</th><th>Max</th></tr>
+{{range .Methods}}<tr><td>{{.Name}}</td><td>({{.Desc.ArgType}}, {{.Desc.ReplyType}})</td>{{with .Stats}}<td>{{.Count}}</td><td>{{.Errors}}</td><td>{{.Mean}}</td><td>{{.P50}}</td><td>{{.P90}}</td><td>{{.P99}}</td><td>{{.Max}}</td>{{end}}</tr>
+{{end}}
+</table>
+<h2>Connections</h2>
+<table border="1" cellpadding="4">
+<tr><th>ID</th><th>RemoteAddr</th><th>ClientID</th><th>OpenTime</th><th>Inflight</th><th>Requests</th><th>BytesSent</th><th>BytesReceived</th></tr>
+{{range .Conns}}<tr><td>{{.ID}}</td><td>{{.RemoteAddr}}</td><td>{{.ClientID}}</td><td>{{.OpenTime.Format "2006-01-02 15:04:05"}}</td><td>{{.Inflight}}</td><td>{{.Requests}}</td><td>{{.BytesSent}}</td><td>{{.BytesReceived}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>`
+
+var debugTemplate = template.Must(template.New("RPC debug").Parse(debugText))
+
+type debugMethod struct {
+	Name  string
+	Desc  MethodDesc
+	Stats MethodStats
+}
+
+// 调试页面，实现 http.Handler
+type debugHTTP struct {
+	*Server
+}
+
+func (server debugHTTP) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var methods []debugMethod
+	for _, m := range server.Methods() {
+		name := m.Service + "." + m.Method
+		st, _ := server.MethodStats(name)
+		methods = append(methods, debugMethod{Name: name, Desc: m, Stats: st})
+	}
+	data := struct {
+		Stats   ServerStats
+		Methods []debugMethod
+		Conns   []ConnInfo
+	}{server.Stats(), methods, server.Connections()}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := debugTemplate.Execute(w, data); err != nil {
+		_, _ = fmt.Fprintln(w, "rpc: error executing template:", err.Error())
+	}
+}
+
+// 调试页面的 http.Handler，可以挂载到任意路径
+func (server *Server) DebugHandler() http.Handler {
+	return debugHTTP{server}
+}
+
+// 在 http.DefaultServeMux 上注册调试页面
+func (server *Server) HandleDebug() {
+	http.Handle(DefaultDebugPath, server.DebugHandler())
+}
+
+func HandleDebug() {
+	DefaultServer.HandleDebug()
+}
@@ -0,0 +1,121 @@
+package geerpc
+
+import (
+	"container/list"
+	"geerpc/codec"
+	"sync"
+	"time"
+)
+
+/**
+ * 请求去重
+ *
+ * 客户端重试时，有副作用的方法可能被执行多次。开启去重后，服务端按幂等键缓存响应，
+ * 相同幂等键的请求不再执行，直接返回缓存的响应；第一次的请求还在处理时，重复的请求等待它完成
+ * 方法因为过载等原因没有被执行时不缓存，重试会再次执行
+ */
+
+type DedupOption struct {
+	TTL        time.Duration //响应缓存的时间，0表示默认的1分钟
+	MaxEntries int           //最多缓存的响应数，0表示默认的10000
+}
+
+// 开启去重，需要在 Accept 之前调用
+func (server *Server) SetDedup(opt DedupOption) {
+	if opt.TTL <= 0 {
+		opt.TTL = time.Minute
+	}
+	if opt.MaxEntries <= 0 {
+		opt.MaxEntries = 10000
+	}
+	server.dedup = &dedupCache{
+		opt:     opt,
+		entries: make(map[string]*dedupEntry),
+		order:   list.New(),
+	}
+}
+
+// 去重使用的键，按客户端隔离，为空时不去重
+func dedupKey(h *codec.Header, clientID string) string {
+	if key := h.Meta[IdempotencyKeyMeta]; key != "" {
+		return clientID + "/" + h.ServiceMethod + "/" + key
+	}
+	return ""
+}
+
+type dedupEntry struct {
+	key    string
+	done   chan struct{} //第一次的请求处理完成后关闭
+	reply  interface{}
+	err    string
+	expire time.Time
+	elem   *list.Element
+}
+
+type dedupCache struct {
+	opt     DedupOption
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+	order   *list.List //按加入顺序，用于淘汰
+}
+
+// 第一次出现时返回 true，调用方需要在处理完后调用 finish 或 abort
+func (c *dedupCache) begin(key string) (*dedupEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+	if e, ok := c.entries[key]; ok {
+		return e, false
+	}
+	e := &dedupEntry{key: key, done: make(chan struct{})}
+	e.elem = c.order.PushBack(e)
+	c.entries[key] = e
+	return e, true
+}
+
+// 方法已经执行，缓存结果
+func (c *dedupCache) finish(e *dedupEntry, reply interface{}, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.reply = reply
+	if err != nil {
+		e.err = err.Error()
+	}
+	e.expire = time.Now().Add(c.opt.TTL)
+	close(e.done)
+}
+
+// 方法没有执行，删除记录，等待中的请求收到同样的错误
+func (c *dedupCache) abort(e *dedupEntry, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e.err = err.Error()
+	if c.entries[e.key] == e {
+		delete(c.entries, e.key)
+		c.order.Remove(e.elem)
+	}
+	close(e.done)
+}
+
+// 淘汰过期的和超出数量的记录，还在处理中的记录不淘汰
+func (c *dedupCache) evict() {
+	now := time.Now()
+	for elem := c.order.Front(); elem != nil; {
+		e := elem.Value.(*dedupEntry)
+		next := elem.Next()
+		select {
+		case <-e.done:
+			if now.After(e.expire) || c.order.Len() >= c.opt.MaxEntries {
+				delete(c.entries, e.key)
+				c.order.Remove(elem)
+				elem = next
+				continue
+			}
+		default:
+		}
+		if c.order.Len() < c.opt.MaxEntries {
+			return
+		}
+		elem = next
+	}
+}
@@ -0,0 +1,146 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+/**
+ * 多地址并行建立连接（Happy Eyeballs，RFC 8305）
+ *
+ * 主机名解析出多个 IP（IPv4/IPv6 或多条 A 记录）时，按 IPv6、IPv4 交替排列，
+ * 每隔 DialStagger 发起下一个连接，前一个连接失败时立即发起下一个，使用最先建立的连接，
+ * 其余的取消；第一个 IP 不通时不需要等它超时才尝试下一个
+ * 只对 tcp 网络生效，地址是 IP 字面量或只解析出一个 IP 时与普通的 Dial 相同
+ *   client, _ := geerpc.Dial("tcp", "rpc.example.com:9999", geerpc.WithDialStagger(100*time.Millisecond))
+ */
+
+// 默认的并行建立连接的间隔，与 RFC 8305 推荐的值相同
+const DefaultDialStagger = 250 * time.Millisecond
+
+// 建立连接，ctx 的截止时间是整个过程的超时时间
+func dialRace(ctx context.Context, network, address string, stagger time.Duration) (net.Conn, error) {
+	var d net.Dialer
+	if stagger < 0 || (network != "tcp" && network != "tcp4" && network != "tcp6") {
+		return d.DialContext(ctx, network, address)
+	}
+	if stagger == 0 {
+		stagger = DefaultDialStagger
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.DialContext(ctx, network, address)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	targets := interleaveFamilies(network, addrs)
+	if len(targets) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	if len(targets) == 1 {
+		return d.DialContext(ctx, network, net.JoinHostPort(targets[0].String(), port))
+	}
+	addresses := make([]string, len(targets))
+	for i, ip := range targets {
+		addresses[i] = net.JoinHostPort(ip.String(), port)
+	}
+	return dialStaggered(ctx, network, addresses, stagger)
+}
+
+// 每隔 stagger 或前一个失败时发起下一个连接，返回最先建立的连接
+func dialStaggered(ctx context.Context, network string, targets []string, stagger time.Duration) (net.Conn, error) {
+	var d net.Dialer
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(targets))
+	next, pending := 0, 0
+	launch := func() {
+		target := targets[next]
+		next++
+		pending++
+		go func() {
+			conn, err := d.DialContext(ctx, network, target)
+			results <- result{conn, err}
+		}()
+	}
+	launch()
+	timer := time.NewTimer(stagger)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < len(targets) {
+				launch()
+				timer.Reset(stagger)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				//已经发起的连接可能也会成功，关闭它们
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.conn != nil {
+							_ = r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			//失败时立即尝试下一个地址
+			if next < len(targets) {
+				launch()
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(stagger)
+			}
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("rpc client: dial failed")
+	}
+	return nil, firstErr
+}
+
+// 按网络筛选地址，IPv6 和 IPv4 交替排列，以解析结果中的第一个地址族开头
+func interleaveFamilies(network string, addrs []net.IPAddr) []net.IPAddr {
+	var first, second []net.IPAddr
+	firstIs4 := len(addrs) > 0 && addrs[0].IP.To4() != nil
+	for _, a := range addrs {
+		is4 := a.IP.To4() != nil
+		if (network == "tcp4" && !is4) || (network == "tcp6" && is4) {
+			continue
+		}
+		if is4 == firstIs4 {
+			first = append(first, a)
+		} else {
+			second = append(second, a)
+		}
+	}
+	out := make([]net.IPAddr, 0, len(first)+len(second))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			out = append(out, first[i])
+		}
+		if i < len(second) {
+			out = append(out, second[i])
+		}
+	}
+	return out
+}
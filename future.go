@@ -0,0 +1,65 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+)
+
+/**
+ * 异步调用的回调和 Future
+ *
+ * Go 需要调用方自己管理 Done 通道，GoFunc 在调用完成后执行回调，
+ * GoFuture 返回一个 Future，可以在任意多个地方 Await 或者 select Done()
+ */
+
+// 异步调用，完成后在一个新的 goroutine 中执行 fn
+func (client *Client) GoFunc(serviceMethod string, args, reply interface{}, fn func(*Call), opts ...CallOption) *Call {
+	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1), opts...)
+	go func() {
+		fn(<-call.Done)
+	}()
+	return call
+}
+
+type Future struct {
+	client *Client
+	call   *Call
+	done   chan struct{} //调用完成后关闭
+}
+
+// 异步调用，返回 Future
+func (client *Client) GoFuture(serviceMethod string, args, reply interface{}, opts ...CallOption) *Future {
+	f := &Future{client: client, done: make(chan struct{})}
+	f.call = client.GoFunc(serviceMethod, args, reply, func(*Call) {
+		close(f.done)
+	}, opts...)
+	return f
+}
+
+// 调用完成后关闭
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *Future) Call() *Call {
+	return f.call
+}
+
+/**
+ * 等待调用完成并返回调用的错误，结果在 reply 中
+ * ctx 先结束时放弃这次调用（同 Client.Cancel），返回 ctx 的错误
+ */
+func (f *Future) Await(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.call.Error
+	case <-ctx.Done():
+		if f.client.Cancel(f.call) {
+			<-f.done
+			return fmt.Errorf("rpc client: call failed: %w", ctx.Err())
+		}
+		//取消前调用已经完成
+		<-f.done
+		return f.call.Error
+	}
+}
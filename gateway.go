@@ -0,0 +1,104 @@
+package geerpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+/**
+ * HTTP/JSON 网关
+ *
+ * 把注册的服务暴露为 HTTP 接口，方便 curl、浏览器、webhook 直接调用，不需要专门的客户端：
+ *   POST /rpc/{Service}/{Method}   请求体为 JSON 编码的参数，响应体为 JSON 编码的 reply
+ * 调用时和 TCP 连接一样走 lookupService 和 service.call，即同一张服务表
+ */
+
+const DefaultGatewayPath = "/rpc/"
+
+// 通过 HTTP 请求头固定服务版本，与 Option.Version 作用相同
+const GatewayVersionHeader = "X-Rpc-Version"
+
+// 网关出错时返回的 JSON 结构
+type gatewayError struct {
+	Error string `json:"error"`
+}
+
+// 网关，实现 http.Handler
+type Gateway struct {
+	server *Server
+	prefix string //路由前缀，如 /rpc/
+}
+
+// 创建网关，prefix 为空时使用 DefaultGatewayPath
+func NewGateway(server *Server, prefix string) *Gateway {
+	if prefix == "" {
+		prefix = DefaultGatewayPath
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Gateway{server: server, prefix: prefix}
+}
+
+func (gw *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGatewayError(w, http.StatusMethodNotAllowed, "405 must POST")
+		return
+	}
+	//路径 /rpc/Service/Method 转成 Service.Method
+	path := strings.TrimPrefix(req.URL.Path, gw.prefix)
+	slash := strings.LastIndex(path, "/")
+	if slash <= 0 || slash == len(path)-1 {
+		writeGatewayError(w, http.StatusNotFound, "rpc gateway: ill-formed path "+req.URL.Path)
+		return
+	}
+	serviceMethod := path[:slash] + "." + path[slash+1:]
+	svc, mtype, err := gw.server.lookupService(serviceMethod, req.Header.Get(GatewayVersionHeader), "")
+	if err != nil {
+		writeGatewayError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	argv := mtype.newArgv()
+	replyv := mtype.newReplyv()
+	argvi := argv.Interface()
+	if argv.Type().Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
+	}
+	//请求体为空时使用参数的零值
+	if err = json.NewDecoder(req.Body).Decode(argvi); err != nil && err != io.EOF {
+		writeGatewayError(w, http.StatusBadRequest, "rpc gateway: decode argv error: "+err.Error())
+		return
+	}
+	if err = gw.server.validate(serviceMethod, argv); err != nil {
+		writeGatewayError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := context.WithValue(req.Context(), peerKey{}, &Peer{Addr: httpAddr(req.RemoteAddr), TLS: req.TLS})
+	if err = gw.server.call(ctx, svc, mtype, argv, replyv); err != nil {
+		writeGatewayError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(replyv.Interface())
+}
+
+func writeGatewayError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(gatewayError{Error: msg})
+}
+
+// 在 http.DefaultServeMux 上注册网关
+func (server *Server) HandleGateway() {
+	http.Handle(DefaultGatewayPath, NewGateway(server, DefaultGatewayPath))
+}
+
+func HandleGateway() {
+	DefaultServer.HandleGateway()
+}
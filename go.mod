@@ -1,3 +1,15 @@
 module geerpc
 
 go 1.20
+
+require (
+	github.com/fxamacker/cbor/v2 v2.7.0
+	github.com/go-zookeeper/zk v1.0.4
+	golang.org/x/crypto v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
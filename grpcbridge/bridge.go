@@ -0,0 +1,101 @@
+package grpcbridge
+
+import (
+	"context"
+	"errors"
+	"geerpc"
+	"log"
+	"reflect"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+/**
+ * gRPC 桥接
+ *
+ * 把 geerpc 服务端上注册的服务暴露为 gRPC 的一元方法，服务实现不用修改，
+ * 客户端可以逐步迁移到 gRPC，迁移期间两种客户端访问的是同一个服务实例：
+ *   gs := grpc.NewServer()
+ *   _ = grpcbridge.Register(gs, server, "example")
+ * 参数和响应类型都是 protobuf 消息（protoc 生成的类型）的方法才会被暴露，其他方法会被跳过，
+ * gRPC 的方法名为 /包名.服务名/方法名，与 .proto 文件中的定义一致即可用生成的 gRPC 客户端调用
+ * 单独作为一个模块，不使用桥接时 geerpc 不依赖 gRPC
+ */
+
+var protoMessage = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// 把 server 上已注册的服务注册到 gs，pkg 为 .proto 文件的包名，为空时不加前缀
+// 之后在 server 上注册的服务不会被暴露，需要先注册服务再桥接
+func Register(gs grpc.ServiceRegistrar, server *geerpc.Server, pkg string) error {
+	descs := make(map[string]*grpc.ServiceDesc)
+	var names []string
+	for _, m := range server.Methods() {
+		if m.ArgType.Kind() != reflect.Ptr || !m.ArgType.Implements(protoMessage) || !m.ReplyType.Implements(protoMessage) {
+			log.Printf("rpc grpcbridge: skip %s.%s: args and reply must be protobuf messages", m.Service, m.Method)
+			continue
+		}
+		name := m.Service
+		if pkg != "" {
+			name = pkg + "." + name
+		}
+		sd, ok := descs[name]
+		if !ok {
+			sd = &grpc.ServiceDesc{ServiceName: name, HandlerType: (*interface{})(nil)}
+			descs[name] = sd
+			names = append(names, name)
+		}
+		sd.Methods = append(sd.Methods, grpc.MethodDesc{
+			MethodName: m.Method,
+			Handler:    newHandler(server, m, "/"+name+"/"+m.Method),
+		})
+	}
+	if len(names) == 0 {
+		return errors.New("rpc grpcbridge: no method with protobuf args and reply")
+	}
+	for _, name := range names {
+		gs.RegisterService(descs[name], server)
+	}
+	return nil
+}
+
+// 一个方法的 gRPC 处理函数：由 gRPC 的编解码器解码参数，再通过 Invoke 调用服务
+func newHandler(server *geerpc.Server, m geerpc.MethodDesc, fullMethod string) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	serviceMethod := m.Service + "." + m.Method
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		args := reflect.New(m.ArgType.Elem()).Interface()
+		if err := dec(args); err != nil {
+			return nil, err
+		}
+		invoke := func(ctx context.Context, req interface{}) (interface{}, error) {
+			reply := reflect.New(m.ReplyType.Elem()).Interface()
+			if err := server.Invoke(ctx, serviceMethod, req, reply); err != nil {
+				return nil, toStatus(ctx, err)
+			}
+			return reply, nil
+		}
+		if interceptor == nil {
+			return invoke(ctx, args)
+		}
+		return interceptor(ctx, args, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, invoke)
+	}
+}
+
+// 把服务返回的错误转换为 gRPC 状态码
+func toStatus(ctx context.Context, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var invalid *geerpc.InvalidArgumentError
+	switch {
+	case errors.As(err, &invalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
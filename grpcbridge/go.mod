@@ -0,0 +1,22 @@
+module geerpc/grpcbridge
+
+go 1.23
+
+require (
+	geerpc v0.0.0
+	google.golang.org/grpc v1.72.1
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	github.com/fxamacker/cbor/v2 v2.7.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace geerpc => ../
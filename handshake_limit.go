@@ -0,0 +1,177 @@
+package geerpc
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 握手限制（防 slowloris）
+ *
+ * 连接建立后到读完 Option 之前，服务端的 goroutine 只能等待对端发送数据，
+ * 对端每隔一段时间发一个字节就能一直占住它。以下限制可以分别设置：
+ *   Timeout     Option 必须在这个时间内读完，超时关闭连接（包括 TLS 握手）
+ *   MaxPending  同时还没有完成握手的连接数上限，超过时新连接直接关闭
+ *   PerIPRate   每个来源 IP 每秒允许建立的连接数，PerIPBurst 为允许的突发数
+ *   server := geerpc.NewServer(geerpc.WithHandshakeLimits(geerpc.HandshakeLimits{
+ *       Timeout: 5 * time.Second, MaxPending: 1000, PerIPRate: 20, PerIPBurst: 50,
+ *   }))
+ * 被拒绝的连接与来源 IP 过滤一样计入 ServerStats.RejectedConns，握手超时计入 HandshakeTimeouts
+ * 超时只对 net.Conn 生效；按 IP 限速对 net/rpc 的连接同样生效
+ */
+
+type HandshakeLimits struct {
+	Timeout    time.Duration //读完 Option 的超时时间，0表示不限制
+	MaxPending int           //同时还没有完成握手的连接数上限，0表示不限制
+	PerIPRate  float64       //每个来源 IP 每秒允许的新连接数，0表示不限制
+	PerIPBurst int           //每个来源 IP 允许的突发连接数，0表示与 PerIPRate 相同（至少为1）
+}
+
+// 记录的来源 IP 数的上限，超过时清理已经恢复满额的 IP
+const maxIPBuckets = 1 << 16
+
+// 同 SetHandshakeLimits
+func WithHandshakeLimits(limits HandshakeLimits) ServerOption {
+	return func(server *Server) {
+		server.SetHandshakeLimits(limits)
+	}
+}
+
+// 设置握手限制，之后的新连接生效
+func (server *Server) SetHandshakeLimits(limits HandshakeLimits) {
+	hl := &handshakeLimiter{limits: limits}
+	if limits.PerIPRate > 0 {
+		burst := float64(limits.PerIPBurst)
+		if burst <= 0 {
+			burst = limits.PerIPRate
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		hl.perIP = &ipRateLimiter{rate: limits.PerIPRate, burst: burst, buckets: make(map[netip.Addr]*ipBucket)}
+	}
+	server.hsLimit.Store(hl)
+}
+
+type handshakeLimiter struct {
+	limits  HandshakeLimits
+	perIP   *ipRateLimiter //为nil时不限速
+	pending int64          //还没有完成握手的连接数
+}
+
+// 按来源 IP 限速的令牌桶
+type ipRateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[netip.Addr]*ipBucket
+}
+
+type ipBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (l *ipRateLimiter) allow(ip netip.Addr, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[ip]
+	if !ok {
+		if len(l.buckets) >= maxIPBuckets {
+			l.sweep(now)
+		}
+		b = &ipBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// 删除已经恢复满额的 IP，它们和没有记录时一样；仍然太多时全部清空
+func (l *ipRateLimiter) sweep(now time.Time) {
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+	if len(l.buckets) >= maxIPBuckets {
+		l.buckets = make(map[netip.Addr]*ipBucket)
+	}
+}
+
+// 按来源 IP 限速，没有设置或者对端地址不是 IP 时允许
+func (server *Server) allowRate(conn io.ReadWriteCloser) bool {
+	hl := server.hsLimit.Load()
+	if hl == nil || hl.perIP == nil {
+		return true
+	}
+	ip, ok := remoteIP(conn)
+	return !ok || hl.perIP.allow(ip, time.Now())
+}
+
+// 一个正在握手的连接，握手结束或者连接关闭时调用 end
+type handshaking struct {
+	hl    *handshakeLimiter
+	conn  net.Conn //设置了超时时间的连接，为nil时没有设置
+	ended bool
+}
+
+// 开始握手：检查未完成握手的连接数并设置超时时间，超过上限时返回 false
+func (server *Server) beginHandshake(conn io.ReadWriteCloser) (*handshaking, bool) {
+	hs := &handshaking{hl: server.hsLimit.Load()}
+	if hs.hl == nil {
+		return hs, true
+	}
+	if max := hs.hl.limits.MaxPending; max > 0 && atomic.AddInt64(&hs.hl.pending, 1) > int64(max) {
+		atomic.AddInt64(&hs.hl.pending, -1)
+		atomic.AddUint64(&server.rejectedConns, 1)
+		hs.hl = nil
+		return hs, false
+	}
+	if nc, ok := conn.(net.Conn); ok && hs.hl.limits.Timeout > 0 {
+		_ = nc.SetReadDeadline(time.Now().Add(hs.hl.limits.Timeout))
+		hs.conn = nc
+	}
+	return hs, true
+}
+
+func (hs *handshaking) end() {
+	if hs.ended || hs.hl == nil {
+		return
+	}
+	hs.ended = true
+	if hs.hl.limits.MaxPending > 0 {
+		atomic.AddInt64(&hs.hl.pending, -1)
+	}
+	if hs.conn != nil {
+		_ = hs.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// 连接的对端 IP，对端地址不是 IP（如 unix socket、io.Pipe）时返回 false
+func remoteIP(conn io.ReadWriteCloser) (netip.Addr, bool) {
+	nc, ok := conn.(net.Conn)
+	if !ok || nc.RemoteAddr() == nil {
+		return netip.Addr{}, false
+	}
+	if ta, ok := nc.RemoteAddr().(*net.TCPAddr); ok {
+		return ta.AddrPort().Addr().Unmap(), true
+	}
+	ap, err := netip.ParseAddrPort(nc.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap(), true
+}
@@ -0,0 +1,141 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ * 客户端标识和会话
+ *
+ * 握手时 Option 中带有 ClientID 和 SessionID：
+ *   ClientID  标识一个客户端（进程或者用户指定的名字），服务端据此关联日志、做按客户端的限流，去重也按客户端隔离
+ *   SessionID 标识一个 Client，断线后通过 Resume 用同一个会话重新连接，请求编号接着之前的继续，
+ *             这样 (SessionID, Seq) 在重连前后都唯一标识一次调用
+ * 服务方法通过 ClientInfoFromContext 读取
+ */
+
+// 没有指定 ClientID 时使用的默认值，每个进程随机生成
+var DefaultClientID = randomID()
+
+func randomID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 补全客户端标识，不修改传入的 Option
+func withIdentity(opt *Option) *Option {
+	o := *opt
+	if o.ClientID == "" {
+		o.ClientID = DefaultClientID
+	}
+	if o.SessionID == "" {
+		o.SessionID = randomID()
+	}
+	return &o
+}
+
+func (client *Client) ClientID() string {
+	return client.opt.ClientID
+}
+
+func (client *Client) SessionID() string {
+	return client.opt.SessionID
+}
+
+/**
+ * 在新的连接上恢复 prev 的会话：使用相同的 ClientID 和 SessionID，请求编号接着 prev 的继续
+ */
+func Resume(conn net.Conn, prev *Client) (*Client, error) {
+	notifyDialState(prev.opt, ClientIdle, ClientConnecting, nil)
+	return resume(conn, prev)
+}
+
+func resume(conn net.Conn, prev *Client) (*Client, error) {
+	seq := atomic.LoadUint64(&prev.seq)
+	client, err := connectClient(conn, prev.opt)
+	if err != nil {
+		return nil, err
+	}
+	atomic.StoreUint64(&client.seq, seq)
+	atomic.StoreUint64(&client.stats.reconnects, atomic.LoadUint64(&prev.stats.reconnects)+1)
+	return client, nil
+}
+
+// 建立连接并恢复 prev 的会话
+func DialResume(network, address string, prev *Client) (*Client, error) {
+	notifyDialState(prev.opt, ClientIdle, ClientConnecting, nil)
+	conn, err := dialConn(network, address, prev.opt)
+	if err != nil {
+		notifyDialState(prev.opt, ClientConnecting, ClientClosed, err)
+		return nil, err
+	}
+	client, err := resume(conn, prev)
+	if err != nil {
+		_ = conn.Close()
+	}
+	return client, err
+}
+
+// 服务端看到的客户端信息
+type ClientInfo struct {
+	ClientID  string
+	SessionID string
+}
+
+type clientInfoKey struct{}
+
+// 服务方法读取调用方的标识
+func ClientInfoFromContext(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info, ok
+}
+
+// 同一个客户端的在途请求超过上限时返回
+var ErrClientLimitExceeded = errors.New("rpc server: too many in-flight requests from client")
+
+/**
+ * 限制每个客户端（按 ClientID，跨连接）同时在途的请求数，需要在 Accept 之前调用
+ */
+func (server *Server) SetClientLimit(maxInflight int) {
+	server.clientLimit = &clientLimiter{max: maxInflight, inflight: make(map[string]int)}
+}
+
+type clientLimiter struct {
+	max      int
+	mu       sync.Mutex
+	inflight map[string]int
+}
+
+// 调整上限，返回之前的上限
+func (l *clientLimiter) setMax(max int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.max
+	l.max = max
+	return old
+}
+
+func (l *clientLimiter) admit(clientID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[clientID] >= l.max {
+		return ErrClientLimitExceeded
+	}
+	l.inflight[clientID]++
+	return nil
+}
+
+func (l *clientLimiter) done(clientID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[clientID]--; l.inflight[clientID] <= 0 {
+		delete(l.inflight, clientID)
+	}
+}
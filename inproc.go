@@ -0,0 +1,27 @@
+package geerpc
+
+import "net"
+
+/**
+ * 进程内传输
+ *
+ * 通过 net.Pipe 把客户端直接连到服务端，不需要监听端口，
+ * 方便应用在单元测试里快速、隔离地测试服务方法和客户端代码
+ */
+
+// 创建一个与 server 直连的客户端，握手和编解码与网络连接完全一致
+func (server *Server) NewLocalClient(opts ...DialOption) (*Client, error) {
+	opt := parseOptions(opts...)
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+	client, err := NewClient(clientConn, opt)
+	if err != nil {
+		_ = serverConn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func NewLocalClient(opts ...DialOption) (*Client, error) {
+	return DefaultServer.NewLocalClient(opts...)
+}
@@ -0,0 +1,67 @@
+package geerpc
+
+import (
+	"context"
+	"reflect"
+)
+
+/**
+ * 拦截器
+ *
+ * 在服务方法前后执行的逻辑（鉴权、审计、日志等），可以作用于整个服务器、一个服务或一个方法：
+ *   server.Use(logging)                                                //所有服务
+ *   server.Register(&internal, geerpc.WithInterceptors(auth, audit))   //只有这个服务
+ *   server.Register(&foo, geerpc.WithMethodInterceptors("Delete", auth)) //只有这个方法
+ * 执行顺序为 全局 -> 服务 -> 方法 -> 服务方法，拦截器不调用 next 时服务方法不会执行
+ * args 和 reply 的类型与服务方法的参数和响应相同，拦截器可以替换 args，但要保持类型不变
+ * 通过 TCP、HTTP 网关、Invoke 和回调的调用都会经过拦截器
+ */
+
+// 调用链的下一环
+type HandlerFunc func(ctx context.Context, args, reply interface{}) error
+
+type Interceptor func(ctx context.Context, serviceMethod string, args, reply interface{}, next HandlerFunc) error
+
+// 添加全局拦截器，需要在开始服务之前调用
+func (server *Server) Use(interceptors ...Interceptor) {
+	server.interceptors = append(server.interceptors, interceptors...)
+}
+
+// 注册选项：服务的所有方法都使用这些拦截器
+func WithInterceptors(interceptors ...Interceptor) RegisterOption {
+	return func(o *registerOptions) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// 注册选项：名为 method 的方法使用这些拦截器，在服务的拦截器之后执行
+func WithMethodInterceptors(method string, interceptors ...Interceptor) RegisterOption {
+	return func(o *registerOptions) {
+		if o.methodInterceptors == nil {
+			o.methodInterceptors = make(map[string][]Interceptor)
+		}
+		o.methodInterceptors[method] = append(o.methodInterceptors[method], interceptors...)
+	}
+}
+
+// 经过拦截器调用服务方法
+func (server *Server) call(ctx context.Context, svc *service, m *methodType, argv, replyv reflect.Value) error {
+	if len(server.interceptors) == 0 && len(m.interceptors) == 0 {
+		return svc.call(ctx, m, argv, replyv)
+	}
+	chain := make([]Interceptor, 0, len(server.interceptors)+len(m.interceptors))
+	chain = append(append(chain, server.interceptors...), m.interceptors...)
+	serviceMethod := svc.name + "." + m.method.Name
+	var next func(i int) HandlerFunc
+	next = func(i int) HandlerFunc {
+		if i == len(chain) {
+			return func(ctx context.Context, args, reply interface{}) error {
+				return svc.call(ctx, m, reflect.ValueOf(args), reflect.ValueOf(reply))
+			}
+		}
+		return func(ctx context.Context, args, reply interface{}) error {
+			return chain[i](ctx, serviceMethod, args, reply, next(i+1))
+		}
+	}
+	return next(0)(ctx, argv.Interface(), replyv.Interface())
+}
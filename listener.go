@@ -0,0 +1,240 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 监听器的生命周期
+ *
+ * Accept 遇到临时错误（如文件描述符耗尽）时按指数退避重试，遇到永久错误时返回该错误，
+ * 服务器 Close 后返回 ErrServerClosed
+ * 一个服务器可以同时服务多个监听器（tcp、unix、tls 等），AddListener 添加后由 Serve 一起管理：
+ *   l1, _ := net.Listen("tcp", ":9999")
+ *   l2, _ := ListenUnix("/tmp/rpc.sock")
+ *   l3 := tls.NewListener(l, tlsConfig)
+ *   server.AddListener(l1); server.AddListener(l2); server.AddListener(l3)
+ *   go server.Serve()
+ *   ...
+ *   server.Shutdown(ctx) //所有监听器一起停止，等待正在处理的请求完成
+ * Close 关闭所有正在 Accept 的监听器和已经建立的连接
+ */
+
+var ErrServerClosed = errors.New("rpc server: server closed")
+
+var ErrNoListeners = errors.New("rpc server: no listeners, use AddListener")
+
+const (
+	minAcceptDelay       = 5 * time.Millisecond
+	maxAcceptDelay       = time.Second
+	shutdownPollInterval = 10 * time.Millisecond
+)
+
+// 通过 AddListener 添加的监听器
+type listenerEntry struct {
+	listener net.Listener
+	serve    func(conn net.Conn)
+}
+
+// 添加一个按 geerpc 协议服务的监听器，Serve 已经在运行时立即开始接受连接
+func (server *Server) AddListener(listener net.Listener) error {
+	return server.addListener(listener, func(conn net.Conn) { server.ServeConn(conn) })
+}
+
+// 添加一个按 net/rpc 协议服务的监听器
+func (server *Server) AddNetRPCListener(listener net.Listener) error {
+	return server.addListener(listener, func(conn net.Conn) { server.ServeNetRPCConn(conn) })
+}
+
+func (server *Server) addListener(listener net.Listener, serve func(conn net.Conn)) error {
+	server.lmu.Lock()
+	defer server.lmu.Unlock()
+	if server.isClosed() {
+		return ErrServerClosed
+	}
+	e := listenerEntry{listener: listener, serve: serve}
+	server.added = append(server.added, e)
+	if server.serving {
+		server.startListener(e)
+	}
+	return nil
+}
+
+/**
+ * 服务所有通过 AddListener 添加的监听器，阻塞直到服务器关闭
+ * 任意一个监听器出现永久错误时关闭整个服务器并返回该错误，正常关闭时返回 ErrServerClosed
+ */
+func (server *Server) Serve() error {
+	server.lmu.Lock()
+	if server.serving {
+		server.lmu.Unlock()
+		return errors.New("rpc server: already serving")
+	}
+	if len(server.added) == 0 {
+		server.lmu.Unlock()
+		return ErrNoListeners
+	}
+	server.serving = true
+	for _, e := range server.added {
+		server.startListener(e)
+	}
+	server.lmu.Unlock()
+
+	server.serveWg.Wait()
+	server.lmu.Lock()
+	defer server.lmu.Unlock()
+	if server.serveErr != nil {
+		return server.serveErr
+	}
+	return ErrServerClosed
+}
+
+// 在新的 goroutine 中服务一个监听器，调用时需要持有 lmu
+func (server *Server) startListener(e listenerEntry) {
+	server.serveWg.Add(1)
+	go func() {
+		defer server.serveWg.Done()
+		if err := server.serveListener(e.listener, e.serve); err != ErrServerClosed {
+			server.lmu.Lock()
+			if server.serveErr == nil {
+				server.serveErr = err
+			}
+			server.lmu.Unlock()
+			_ = server.Close()
+		}
+	}()
+}
+
+// 接受连接直到监听器出错或服务器关闭，每个连接交给 serve 处理
+func (server *Server) serveListener(listener net.Listener, serve func(conn net.Conn)) error {
+	if !server.trackListener(listener) {
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	defer server.untrackListener(listener)
+
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if server.isClosed() {
+				return ErrServerClosed
+			}
+			if isTemporary(err) {
+				if delay == 0 {
+					delay = minAcceptDelay
+				} else if delay *= 2; delay > maxAcceptDelay {
+					delay = maxAcceptDelay
+				}
+				server.logf("rpc server: accept error: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			server.logf("rpc server: accept error: %v", err)
+			return err
+		}
+		delay = 0
+		if err := server.tcpOption.Load().apply(conn); err != nil {
+			server.logf("rpc server: tcp option error: %v", err)
+		}
+		go serve(conn)
+	}
+}
+
+// 临时错误，稍后重试可能成功
+func isTemporary(err error) bool {
+	var te interface{ Temporary() bool }
+	return errors.As(err, &te) && te.Temporary()
+}
+
+// 记录监听器，服务器已经关闭时返回 false
+func (server *Server) trackListener(listener net.Listener) bool {
+	server.lmu.Lock()
+	defer server.lmu.Unlock()
+	if server.isClosed() {
+		return false
+	}
+	if server.listeners == nil {
+		server.listeners = make(map[net.Listener]struct{})
+	}
+	server.listeners[listener] = struct{}{}
+	return true
+}
+
+func (server *Server) untrackListener(listener net.Listener) {
+	server.lmu.Lock()
+	defer server.lmu.Unlock()
+	delete(server.listeners, listener)
+}
+
+func (server *Server) isClosed() bool {
+	return atomic.LoadInt32(&server.closed) == 1
+}
+
+/**
+ * 关闭服务器：关闭所有监听器，Accept 返回 ErrServerClosed，再关闭所有连接，
+ * 连接上正在处理的请求会被取消，需要等待它们完成时使用 Shutdown
+ * 开启了优先级调度时同时停止 worker
+ */
+func (server *Server) Close() error {
+	err := server.closeListeners()
+	if err == ErrServerClosed {
+		return err
+	}
+	server.closeConns()
+	server.sched.Load().stop()
+	return err
+}
+
+/**
+ * 优雅关闭：停止接受新连接和新请求，等待正在处理的请求完成后关闭所有连接
+ * ctx 结束时还有请求没有完成，则直接关闭连接并返回 ctx 的错误
+ */
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.setDraining(true)
+	err := server.closeListeners()
+	if err == ErrServerClosed {
+		return err
+	}
+	defer server.sched.Load().stop()
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for server.Stats().Inflight > 0 {
+		select {
+		case <-ctx.Done():
+			server.closeConns()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	server.closeConns()
+	return err
+}
+
+// 标记服务器已经关闭并关闭所有监听器，重复关闭时返回 ErrServerClosed
+func (server *Server) closeListeners() error {
+	server.lmu.Lock()
+	defer server.lmu.Unlock()
+	if !atomic.CompareAndSwapInt32(&server.closed, 0, 1) {
+		return ErrServerClosed
+	}
+	var err error
+	for l := range server.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	server.listeners = nil
+	return err
+}
+
+func (server *Server) closeConns() {
+	server.conns.Range(func(_, v interface{}) bool {
+		_ = v.(*connState).conn.Close()
+		return true
+	})
+}
@@ -0,0 +1,153 @@
+package geerpc
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 过载保护（load shedding）
+ *
+ * 服务端统计正在处理和排队的请求数以及处理延迟的平均值，任何一个超过阈值就认为过载，
+ * 过载时直接拒绝低优先级的请求，返回 OverloadedError 并带上建议的重试间隔，
+ * 而不是让所有请求都排队直到超时；过载越严重，建议的重试间隔越长
+ * 默认所有请求（包括没有设置优先级、优先级为0的请求）过载时都可能被拒绝；
+ * 设置 ProtectPriority 后，优先级不低于它的请求不会被拒绝：
+ *   protect := 10
+ *   server.SetLoadShedding(geerpc.LoadShedOption{MaxInflight: 1000, ProtectPriority: &protect})
+ */
+
+type LoadShedOption struct {
+	MaxInflight     int           //正在处理和排队的请求数上限，0表示不限制
+	TargetLatency   time.Duration //处理延迟的平均值超过该值认为过载，0表示不限制
+	ProtectPriority *int          //优先级不低于该值的请求不会被拒绝，为nil时所有请求都可能被拒绝
+	RetryAfter      time.Duration //建议的最短重试间隔，0表示默认的100ms
+}
+
+const overloadedPrefix = "rpc server: overloaded, retry after "
+
+// 服务端过载，请求没有被处理，可以在 RetryAfter 之后重试
+type OverloadedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return overloadedPrefix + e.RetryAfter.String()
+}
+
+// 客户端把服务端返回的错误信息还原为对应的错误类型
+func parseServerError(msg string) error {
+	if strings.HasPrefix(msg, overloadedPrefix) {
+		if d, err := time.ParseDuration(strings.TrimPrefix(msg, overloadedPrefix)); err == nil {
+			return &OverloadedError{RetryAfter: d}
+		}
+	}
+	if err, ok := parseInvalidArgument(msg); ok {
+		return err
+	}
+	if err, ok := parseNotFound(msg); ok {
+		return err
+	}
+	if err, ok := parseInternal(msg); ok {
+		return err
+	}
+	return ServerError(msg)
+}
+
+// 开启过载保护，需要在 Accept 之前调用
+func (server *Server) SetLoadShedding(opt LoadShedOption) {
+	if opt.RetryAfter <= 0 {
+		opt.RetryAfter = 100 * time.Millisecond
+	}
+	if p := opt.ProtectPriority; p != nil {
+		v := *p
+		opt.ProtectPriority = &v
+	}
+	server.shed = &loadShedder{opt: opt}
+}
+
+// 延迟平均值的平滑系数
+const shedLatencyDecay = 0.9
+
+// 没有新的请求完成时，延迟平均值按这个时间常数衰减，否则拒绝请求后延迟不再更新，会一直拒绝
+const shedLatencyWindow = time.Second
+
+// 建议的重试间隔最多为 RetryAfter 的倍数
+const maxRetryAfterFactor = 10
+
+type loadShedder struct {
+	opt      LoadShedOption
+	mu       sync.Mutex
+	inflight int
+	latency  float64   //处理延迟的指数加权平均，单位纳秒
+	last     time.Time //上次更新延迟的时间
+}
+
+// 调整在途请求上限，返回之前的上限
+func (l *loadShedder) setMaxInflight(max int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.opt.MaxInflight
+	l.opt.MaxInflight = max
+	return old
+}
+
+// 请求到达时调用，过载时返回 OverloadedError，否则计入在途请求
+func (l *loadShedder) admit(priority int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.protected(priority) {
+		if load := l.load(); load > 1 {
+			factor := load
+			if factor > maxRetryAfterFactor {
+				factor = maxRetryAfterFactor
+			}
+			retry := time.Duration(float64(l.opt.RetryAfter) * factor).Round(time.Millisecond)
+			return &OverloadedError{RetryAfter: retry}
+		}
+	}
+	l.inflight++
+	return nil
+}
+
+// 不会被拒绝的请求
+func (l *loadShedder) protected(priority int) bool {
+	p := l.opt.ProtectPriority
+	return p != nil && priority >= *p
+}
+
+// 请求处理完成，记录从到达到处理完成的延迟（包括排队时间）
+func (l *loadShedder) done(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if l.last.IsZero() {
+		l.latency = float64(latency)
+	} else {
+		l.latency = l.currentLatency()*shedLatencyDecay + float64(latency)*(1-shedLatencyDecay)
+	}
+	l.last = time.Now()
+}
+
+func (l *loadShedder) currentLatency() float64 {
+	if l.last.IsZero() {
+		return 0
+	}
+	return l.latency * math.Exp(-float64(time.Since(l.last))/float64(shedLatencyWindow))
+}
+
+// 负载系数，大于1表示过载
+func (l *loadShedder) load() float64 {
+	var load float64
+	if l.opt.MaxInflight > 0 {
+		load = float64(l.inflight+1) / float64(l.opt.MaxInflight)
+	}
+	if l.opt.TargetLatency > 0 {
+		if lat := l.currentLatency() / float64(l.opt.TargetLatency); lat > load {
+			load = lat
+		}
+	}
+	return load
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"geerpc"
 	"log"
 	"net"
@@ -9,7 +8,22 @@ import (
 	"time"
 )
 
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+// 符合注册条件的方法：func (t *T) MethodName(argType T1, replyType *T2) error
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
 func startService(addr chan string) {
+	//注册Foo服务
+	var foo Foo
+	if err := geerpc.Register(&foo); err != nil {
+		log.Fatal("register error:", err)
+	}
 	//pick一个空闲的接口
 	l, err := net.Listen("tcp", ":10010")
 	if err != nil {
@@ -50,13 +64,13 @@ func main() {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			args := fmt.Sprintf("req go协程编号(0-4)%d", i)
-			var reply string
+			args := &Args{Num1: i, Num2: i * i}
+			var reply int
 			//调用封装Go的Call
-			if err := client.Call("User.Sum", args, &reply); err != nil {
-				log.Fatal("call request ", i, " User.Sum error:", err)
+			if err := client.Call("Foo.Sum", args, &reply); err != nil {
+				log.Fatal("call Foo.Sum error:", err)
 			}
-			log.Println("reply : ", reply)
+			log.Printf("%d + %d = %d", args.Num1, args.Num2, reply)
 		}(i)
 
 	}
@@ -0,0 +1,190 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+	"geerpc/codec"
+	"strconv"
+	"strings"
+)
+
+/**
+ * 请求元数据
+ *
+ * 调用方通过 WithMetadata 调用选项附加键值对，放在请求头中发给服务端，
+ * 服务方法（第一个参数为 context.Context 时）通过 MetadataFromContext 读取
+ * 键不区分大小写，发送和接收时都转换为小写（见 CanonicalMetaKey）
+ *
+ * 以 "rpc-" 开头的键保留给框架使用：
+ *   rpc-traceparent  链路追踪上下文（W3C traceparent），WithTraceParent 设置，在服务方法中发起的调用沿用
+ *   rpc-auth         认证信息，WithAuthToken 设置，AuthTokenFromContext 读取
+ *   rpc-deadline     截止时间（UnixNano），服务端按请求头填入
+ *   rpc-priority     优先级，服务端按请求头填入，PriorityFromContext 读取
+ * 服务端默认信任客户端设置的保留键；面向不可信的客户端时通过 SetReservedMetaPolicy 丢弃或拒绝，
+ * 代理默认丢弃客户端设置的保留键，防止冒充框架写入的值
+ */
+
+// 幂等键，服务端开启去重后，相同幂等键的请求只会执行一次
+const IdempotencyKeyMeta = "idempotency-key"
+
+// 框架保留的元数据键的前缀
+const ReservedMetaPrefix = "rpc-"
+
+const (
+	TraceParentMeta = "rpc-traceparent"
+	AuthMeta        = "rpc-auth"
+	DeadlineMeta    = "rpc-deadline"
+	PriorityMeta    = "rpc-priority"
+)
+
+// 元数据键的规范形式：去掉首尾空白并转换为小写
+func CanonicalMetaKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+// 判断是否是框架保留的键
+func IsReservedMeta(key string) bool {
+	return strings.HasPrefix(CanonicalMetaKey(key), ReservedMetaPrefix)
+}
+
+// 去掉 md 中的保留键，keep 中的键除外；没有需要去掉的键时返回 md 本身，否则返回新的 map
+func StripReservedMeta(md map[string]string, keep ...string) map[string]string {
+	drop := func(k string) bool {
+		if !IsReservedMeta(k) {
+			return false
+		}
+		for _, kk := range keep {
+			if CanonicalMetaKey(kk) == CanonicalMetaKey(k) {
+				return false
+			}
+		}
+		return true
+	}
+	n := 0
+	for k := range md {
+		if drop(k) {
+			n++
+		}
+	}
+	if n == 0 {
+		return md
+	}
+	out := make(map[string]string, len(md)-n)
+	for k, v := range md {
+		if !drop(k) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type incomingMetadataKey struct{}
+
+// 服务端读取请求携带的元数据，不要修改返回的 map
+func MetadataFromContext(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(incomingMetadataKey{}).(map[string]string)
+	return md
+}
+
+// 设置链路追踪上下文，格式为 W3C traceparent
+func WithTraceParent(traceparent string) CallOption {
+	return WithMetadata(TraceParentMeta, traceparent)
+}
+
+// 服务方法读取当前请求的链路追踪上下文
+func TraceParentFromContext(ctx context.Context) string {
+	return MetadataFromContext(ctx)[TraceParentMeta]
+}
+
+// 设置认证信息，如 "Bearer <token>"
+func WithAuthToken(token string) CallOption {
+	return WithMetadata(AuthMeta, token)
+}
+
+// 服务方法读取当前请求的认证信息
+func AuthTokenFromContext(ctx context.Context) string {
+	return MetadataFromContext(ctx)[AuthMeta]
+}
+
+// 服务方法读取当前请求的优先级
+func PriorityFromContext(ctx context.Context) int {
+	p, _ := strconv.Atoi(MetadataFromContext(ctx)[PriorityMeta])
+	return p
+}
+
+// 服务端如何处理客户端设置的保留键
+type ReservedMetaPolicy int
+
+const (
+	ReservedMetaAccept ReservedMetaPolicy = iota //接受（默认），客户端是可信的
+	ReservedMetaStrip                            //丢弃，请求照常处理
+	ReservedMetaReject                           //拒绝这个请求，返回 InvalidArgumentError
+)
+
+type reservedMeta struct {
+	policy ReservedMetaPolicy
+	allow  []string //不受 policy 限制的保留键
+}
+
+// 同 SetReservedMetaPolicy
+func WithReservedMetaPolicy(policy ReservedMetaPolicy, allow ...string) ServerOption {
+	return func(server *Server) {
+		server.SetReservedMetaPolicy(policy, allow...)
+	}
+}
+
+/**
+ * 设置客户端设置的保留键的处理方式，allow 中的保留键照常接受（如接受 AuthMeta、丢弃其他保留键），
+ * 需要在 Accept 之前调用
+ */
+func (server *Server) SetReservedMetaPolicy(policy ReservedMetaPolicy, allow ...string) {
+	server.reservedMeta = &reservedMeta{policy: policy, allow: allow}
+}
+
+// 服务端收到请求后规范化元数据的键，按设置处理客户端设置的保留键，再按请求头填入框架的保留键
+func (server *Server) checkMetadata(h *codec.Header) error {
+	canonicalizeMeta(h)
+	if rm := server.reservedMeta; rm != nil && rm.policy != ReservedMetaAccept {
+		md := StripReservedMeta(h.Meta, rm.allow...)
+		if len(md) != len(h.Meta) {
+			if rm.policy == ReservedMetaReject {
+				for k := range h.Meta {
+					if _, ok := md[k]; !ok {
+						return &InvalidArgumentError{Msg: fmt.Sprintf("reserved metadata key %q is not allowed", k)}
+					}
+				}
+			}
+			h.Meta = md
+		}
+	}
+	setMeta(h, DeadlineMeta, h.Deadline)
+	setMeta(h, PriorityMeta, int64(h.Priority))
+	return nil
+}
+
+// 把元数据的键转换为规范形式，已经是规范形式时不分配
+func canonicalizeMeta(h *codec.Header) {
+	for k := range h.Meta {
+		if k == CanonicalMetaKey(k) {
+			continue
+		}
+		md := make(map[string]string, len(h.Meta))
+		for k, v := range h.Meta {
+			md[CanonicalMetaKey(k)] = v
+		}
+		h.Meta = md
+		return
+	}
+}
+
+// 按请求头设置框架的保留键，v 为0时删除
+func setMeta(h *codec.Header, key string, v int64) {
+	if v == 0 {
+		delete(h.Meta, key)
+		return
+	}
+	if h.Meta == nil {
+		h.Meta = make(map[string]string, 2)
+	}
+	h.Meta[key] = strconv.FormatInt(v, 10)
+}
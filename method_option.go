@@ -0,0 +1,88 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 方法级别的处理选项
+ *
+ * 注册服务时可以为单个方法设置超时、最大并发和排队长度，
+ * 这样一个开销大的方法可以单独限流，不需要限制整个服务器：
+ *   server.Register(&foo, geerpc.WithMethodOption("Sum", geerpc.MethodOption{Timeout: time.Second, MaxConcurrency: 4}))
+ * Priority 加在请求头的优先级上，用于优先级调度和过载保护（见 priority.go 和 loadshed.go），
+ * 如批量导出的方法设置为 -10，不管客户端怎么设置，过载时都先被拒绝、排在其他请求后面
+ */
+
+type MethodOption struct {
+	Timeout        time.Duration //单次处理的超时时间，0表示不限制
+	MaxConcurrency int           //同时处理的最大请求数，0表示不限制
+	MaxQueue       int           //达到并发上限后允许排队的请求数，0表示不限制，小于0表示不排队直接拒绝
+	Priority       int           //加在请求优先级上的值，0表示按请求的优先级
+}
+
+// 达到并发上限且排队已满时返回
+var ErrMethodOverloaded = errors.New("rpc server: method overloaded")
+
+// 注册选项
+type RegisterOption func(*registerOptions)
+
+type registerOptions struct {
+	methods            map[string]MethodOption
+	interceptors       []Interceptor            //整个服务的拦截器
+	methodInterceptors map[string][]Interceptor //方法的拦截器
+}
+
+// 为名为 method 的方法设置处理选项
+func WithMethodOption(method string, opt MethodOption) RegisterOption {
+	return func(o *registerOptions) {
+		if o.methods == nil {
+			o.methods = make(map[string]MethodOption)
+		}
+		o.methods[method] = opt
+	}
+}
+
+// 把选项应用到方法上
+func (m *methodType) setOption(opt MethodOption) {
+	m.opt = opt
+	if opt.MaxConcurrency > 0 {
+		m.sem = make(chan struct{}, opt.MaxConcurrency)
+	}
+}
+
+// 获取一个处理名额，没有并发限制时直接返回
+func (m *methodType) acquire(ctx context.Context) error {
+	if m.sem == nil {
+		return nil
+	}
+	select {
+	case m.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	//需要排队
+	if m.opt.MaxQueue < 0 {
+		return ErrMethodOverloaded
+	}
+	queued := atomic.AddInt64(&m.queued, 1)
+	defer atomic.AddInt64(&m.queued, -1)
+	if m.opt.MaxQueue > 0 && queued > int64(m.opt.MaxQueue) {
+		return ErrMethodOverloaded
+	}
+	select {
+	case m.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *methodType) release() {
+	if m.sem != nil {
+		<-m.sem
+	}
+}
@@ -0,0 +1,146 @@
+package geerpc
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 每个方法的调用统计
+ *
+ * 服务端为每个方法记录调用数、失败数和耗时的指数分桶直方图，应用可以直接读取，
+ * 据此做路由、扩缩容等决策，不需要额外的监控系统：
+ *   st, err := server.MethodStats("Foo.Sum")
+ *   if err == nil && st.P99 > 200*time.Millisecond { ... }
+ *   p999 := st.Percentile(0.999)
+ * 耗时与慢调用相同，只包括服务方法本身（超时的调用按超时时间计），不包括排队和编解码
+ * 直方图以微秒为单位，每个 2 的幂次区间分为 4 个桶，百分位的误差不超过 25%；
+ * 记录只有几次原子操作，不加锁
+ */
+
+// 每个 2 的幂次区间分的桶数为 1<<histSubBits
+const (
+	histSubBits = 2
+	histSub     = 1 << histSubBits
+	histBuckets = (64-histSubBits)*histSub + histSub
+)
+
+// 一个方法的统计数据快照
+type MethodStats struct {
+	Count  uint64        //调用数
+	Errors uint64        //返回错误的调用数
+	Mean   time.Duration //平均耗时
+	Max    time.Duration //最大耗时
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	sum    time.Duration
+	hist   [histBuckets]uint64
+}
+
+// 耗时的 q 分位数，q 在 0 到 1 之间，没有调用时为0
+func (s *MethodStats) Percentile(q float64) time.Duration {
+	var total uint64
+	for _, n := range s.hist {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range s.hist {
+		seen += n
+		if seen >= rank {
+			//取桶的上界，但不超过最大耗时
+			if d := histUpper(i); d < s.Max {
+				return d
+			}
+			return s.Max
+		}
+	}
+	return s.Max
+}
+
+// 方法的统计，记录时只用原子操作
+type methodStats struct {
+	count  uint64
+	errors uint64
+	sum    int64 //耗时总和，单位纳秒
+	max    int64
+	hist   [histBuckets]uint64
+}
+
+func (m *methodStats) record(d time.Duration, err error) {
+	atomic.AddUint64(&m.count, 1)
+	if err != nil {
+		atomic.AddUint64(&m.errors, 1)
+	}
+	atomic.AddInt64(&m.sum, int64(d))
+	for {
+		max := atomic.LoadInt64(&m.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&m.max, max, int64(d)) {
+			break
+		}
+	}
+	atomic.AddUint64(&m.hist[histIndex(d)], 1)
+}
+
+func (m *methodStats) snapshot() MethodStats {
+	s := MethodStats{
+		Count:  atomic.LoadUint64(&m.count),
+		Errors: atomic.LoadUint64(&m.errors),
+		Max:    time.Duration(atomic.LoadInt64(&m.max)),
+	}
+	s.sum = time.Duration(atomic.LoadInt64(&m.sum))
+	if s.Count > 0 {
+		s.Mean = s.sum / time.Duration(s.Count)
+	}
+	for i := range m.hist {
+		s.hist[i] = atomic.LoadUint64(&m.hist[i])
+	}
+	s.P50, s.P90, s.P99 = s.Percentile(0.5), s.Percentile(0.9), s.Percentile(0.99)
+	return s
+}
+
+// 耗时所在的桶：小于 histSub 微秒时每微秒一个桶，之后每个 2 的幂次区间分 histSub 个桶
+func histIndex(d time.Duration) int {
+	us := uint64(0)
+	if d > 0 {
+		us = uint64(d / time.Microsecond)
+	}
+	if us < histSub {
+		return int(us)
+	}
+	e := bits.Len64(us) - 1 //最高位
+	sub := (us >> (e - histSubBits)) & (histSub - 1)
+	return (e-histSubBits+1)*histSub + int(sub)
+}
+
+// 桶的上界（不含）
+func histUpper(i int) time.Duration {
+	if i < histSub {
+		return time.Duration(i+1) * time.Microsecond
+	}
+	e := i/histSub + histSubBits - 1
+	sub := uint64(i % histSub)
+	upper := (histSub + sub + 1) << (e - histSubBits)
+	if upper > uint64(math.MaxInt64/int64(time.Microsecond)) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(upper) * time.Microsecond
+}
+
+// 返回方法的统计数据，serviceMethod 如 "Foo.Sum"，方法不存在时返回 NotFoundError
+func (server *Server) MethodStats(serviceMethod string) (MethodStats, error) {
+	_, mtype, err := server.findService(serviceMethod)
+	if err != nil {
+		return MethodStats{}, err
+	}
+	return mtype.stats.snapshot(), nil
+}
@@ -0,0 +1,75 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+/**
+ * 已注册方法的描述和直接调用
+ *
+ * 供其他协议的适配层使用（如 grpcbridge），它们自己负责编解码，
+ * 通过 Methods 得到方法和参数类型，通过 Invoke 调用，与网关一样走同一张服务表和参数校验
+ */
+
+type MethodDesc struct {
+	Service   string       //服务名，如 "Foo" 或 "User.v2"
+	Method    string       //方法名
+	ArgType   reflect.Type //参数类型，可能是值类型也可能是指针类型
+	ReplyType reflect.Type //响应类型，一定是指针类型
+}
+
+// 已注册的所有方法，按服务名和方法名排序
+func (server *Server) Methods() []MethodDesc {
+	var methods []MethodDesc
+	server.serviceMap.Range(func(_, svci interface{}) bool {
+		svc := svci.(*service)
+		for name, mtype := range svc.method {
+			methods = append(methods, MethodDesc{Service: svc.name, Method: name, ArgType: mtype.ArgType, ReplyType: mtype.ReplyType})
+		}
+		return true
+	})
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].Service != methods[j].Service {
+			return methods[i].Service < methods[j].Service
+		}
+		return methods[i].Method < methods[j].Method
+	})
+	return methods
+}
+
+/**
+ * 不经过连接直接调用一个方法
+ * args 的类型为方法的参数类型，参数是值类型时也可以传指针；reply 的类型为方法的响应类型
+ * 不经过限流和过载保护，这些由调用方所在的协议层负责
+ */
+func (server *Server) Invoke(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	svc, mtype, err := server.lookupService(serviceMethod, "", "")
+	if err != nil {
+		return err
+	}
+	if args == nil || reply == nil {
+		return fmt.Errorf("rpc server: %s args and reply must not be nil", serviceMethod)
+	}
+	argv := reflect.ValueOf(args)
+	if mtype.ArgType.Kind() != reflect.Ptr && argv.Kind() == reflect.Ptr && argv.Type().Elem() == mtype.ArgType {
+		argv = argv.Elem()
+	}
+	if argv.Type() != mtype.ArgType {
+		return fmt.Errorf("rpc server: %s expects args of type %s, got %s", serviceMethod, mtype.ArgType, argv.Type())
+	}
+	replyv := reflect.ValueOf(reply)
+	if replyv.Type() != mtype.ReplyType {
+		return fmt.Errorf("rpc server: %s expects reply of type %s, got %s", serviceMethod, mtype.ReplyType, replyv.Type())
+	}
+	if err = server.validate(serviceMethod, argv); err != nil {
+		return err
+	}
+	start := time.Now()
+	err = server.call(ctx, svc, mtype, argv, replyv)
+	mtype.stats.record(time.Since(start), err)
+	return err
+}
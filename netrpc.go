@@ -0,0 +1,69 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"io"
+	"net"
+)
+
+/**
+ * 与标准库 net/rpc 的线路兼容
+ *
+ * net/rpc 的 gob 协议没有 Option 协商，连接建立后直接是 | Header1 | Body1 | Header2 | Body2 | ...
+ * net/rpc 的 Request{ServiceMethod, Seq} 与 Response{ServiceMethod, Seq, Error} 字段名和 codec.Header 一致，
+ * gob 按字段名编解码，所以 GobCodec 本身就能和 net/rpc 互通，只需要跳过 Option 的握手即可
+ * 用于渐进迁移：tiny-rpc 客户端调用老的 net/rpc 服务端，或者 net/rpc 客户端调用 tiny-rpc 服务端
+ */
+
+// 兼容 net/rpc 时使用的 Option，只用于记录，不会发送给对端
+var netRPCOption = &Option{
+	MagicNumber: MagicNumber,
+	CodecType:   codec.GobType,
+}
+
+// 在已有连接上创建一个与 net/rpc 服务端通信的客户端，不发送 Option
+func NewNetRPCClient(conn io.ReadWriteCloser) *Client {
+	stats := new(clientStats)
+	return newClientCodec(codec.NewGobCodec(&countingConn{ReadWriteCloser: conn, stats: stats}), netRPCOption, stats)
+}
+
+// 连接 net/rpc 服务端，对应 rpc.Dial
+func DialNetRPC(network, address string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewNetRPCClient(conn), nil
+}
+
+/**
+ * 以 net/rpc 的方式处理连接：不读取 Option，直接用 gob 编解码后续的 Header 和 Body
+ * 供 net/rpc 的客户端（rpc.Dial / rpc.NewClient）调用
+ */
+func (server *Server) ServeNetRPCConn(conn io.ReadWriteCloser) {
+	defer func() { _ = conn.Close() }()
+	if !server.acceptConn(conn) || !server.plugins.doConnect(conn) {
+		return
+	}
+	defer server.plugins.doDisconnect(conn)
+	ctx, ok := server.connected(conn)
+	if !ok {
+		return
+	}
+	var err error
+	defer func(conn io.ReadWriteCloser) { server.disconnected(conn, err) }(conn)
+	cs, conn := server.trackConn(conn)
+	defer server.untrackConn(cs)
+	err = server.serveCodec(ctx, codec.NewGobCodec(conn), netRPCOption, cs)
+}
+
+// 接受连接并按 net/rpc 协议处理，返回值同 Accept
+func (server *Server) AcceptNetRPC(listener net.Listener) error {
+	return server.serveListener(listener, func(conn net.Conn) {
+		server.ServeNetRPCConn(conn)
+	})
+}
+
+func AcceptNetRPC(listener net.Listener) error {
+	return DefaultServer.AcceptNetRPC(listener)
+}
@@ -0,0 +1,329 @@
+package geerpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * OpenAPI 文档生成
+ *
+ * 根据已注册的服务，为 HTTP/JSON 网关的每个方法生成 OpenAPI 3.0 描述：
+ * 参数类型作为 requestBody，响应类型作为 200 响应，命名的结构体放在 components.schemas 中通过 $ref 引用，
+ * 名字为类型名中 $ref 允许的字符，不同包的同名类型依次加上 _2、_3 后缀
+ * 字段与 encoding/json 的编码结果一致：匿名结构体的字段展开到外层，[]byte 为 base64 字符串，[N]byte 为数组
+ * 下游可以用 openapi-generator 等工具生成客户端
+ */
+
+const DefaultOpenAPIPath = "/openapi.json"
+
+type openAPIBuilder struct {
+	schemas map[string]interface{}  //components.schemas
+	names   map[reflect.Type]string //命名结构体在 components.schemas 中的名字
+}
+
+// 生成 OpenAPI 文档，prefix 为网关的路由前缀
+func (server *Server) OpenAPI(prefix string) map[string]interface{} {
+	if prefix == "" {
+		prefix = DefaultGatewayPath
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	b := &openAPIBuilder{schemas: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+	paths := make(map[string]interface{})
+
+	//按服务名排序，保证输出稳定
+	var services []*service
+	server.serviceMap.Range(func(_, svci interface{}) bool {
+		services = append(services, svci.(*service))
+		return true
+	})
+	sort.Slice(services, func(i, j int) bool { return services[i].name < services[j].name })
+
+	for _, svc := range services {
+		names := make([]string, 0, len(svc.method))
+		for name := range svc.method {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			mtype := svc.method[name]
+			paths[prefix+svc.name+"/"+name] = map[string]interface{}{
+				"post": b.operation(svc.name, name, mtype),
+			}
+		}
+	}
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "geerpc gateway",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+	}
+	if len(b.schemas) > 0 {
+		doc["components"] = map[string]interface{}{"schemas": b.schemas}
+	}
+	return doc
+}
+
+func (b *openAPIBuilder) operation(serviceName, methodName string, mtype *methodType) map[string]interface{} {
+	errSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"error": map[string]interface{}{"type": "string"}},
+	}
+	errResp := func(desc string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": desc,
+			"content":     jsonContent(errSchema),
+		}
+	}
+	return map[string]interface{}{
+		"operationId": serviceName + "_" + methodName,
+		"tags":        []string{serviceName},
+		"requestBody": map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(b.schema(mtype.ArgType)),
+		},
+		"responses": map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "OK",
+				"content":     jsonContent(b.schema(mtype.ReplyType)),
+			},
+			"400": errResp("invalid argument"),
+			"404": errResp("service or method not found"),
+			"500": errResp("handler error"),
+		},
+	}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// 根据反射类型生成 JSON Schema
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		//[]byte 在 JSON 中编码为 base64 字符串
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Array:
+		//数组（包括 [N]byte）编码为固定长度的 JSON 数组
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		//命名结构体放到 components 中，先占位防止递归类型死循环
+		name, ok := b.names[t]
+		if !ok {
+			name = b.componentName(t)
+			b.names[t] = name
+			b.schemas[name] = map[string]interface{}{}
+			b.schemas[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	//interface{} 等无法描述的类型
+	return map[string]interface{}{}
+}
+
+/*
+命名结构体在 components.schemas 中的名字
+$ref 只允许字母、数字和 .-_，泛型实例化的类型名如 Page[example.com/x.User] 中的其他字符替换为 _，
+被其他包的同名类型占用时加上数字后缀
+*/
+func (b *openAPIBuilder) componentName(t reflect.Type) string {
+	base := strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, t.Name()), "_")
+	if base == "" {
+		base = "Object"
+	}
+	name := base
+	for i := 2; ; i++ {
+		if _, taken := b.schemas[name]; !taken {
+			return name
+		}
+		name = base + "_" + strconv.Itoa(i)
+	}
+}
+
+func (b *openAPIBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	props := make(map[string]interface{})
+	var required []string
+	for _, f := range jsonFields(t) {
+		props[f.name] = b.schema(f.typ)
+		if !f.omitempty && !f.optional && f.typ.Kind() != reflect.Ptr {
+			required = append(required, f.name)
+		}
+	}
+	s := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// 结构体编码为 JSON 时的一个字段
+type jsonField struct {
+	name      string
+	typ       reflect.Type
+	omitempty bool
+	optional  bool //通过匿名的结构体指针展开，指针为nil时不会出现
+	depth     int  //匿名结构体展开的层数，外层为0
+	tagged    bool //名字由 json 标签指定
+}
+
+/**
+ * 按 encoding/json 的规则列出结构体的字段：
+ * 没有在 json 标签中指定名字的匿名结构体（或结构体指针）字段，它的字段展开到外层；
+ * 同名的字段取层数最少的，同一层有多个时取有标签的，仍然不唯一时都忽略
+ */
+func jsonFields(t reflect.Type) []jsonField {
+	var all []jsonField
+	visited := make(map[reflect.Type]bool)
+	var walk func(t reflect.Type, depth int, optional bool)
+	walk = func(t reflect.Type, depth int, optional bool) {
+		if visited[t] {
+			return //递归嵌入自己，encoding/json 同样忽略
+		}
+		visited[t] = true
+		defer delete(visited, t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			ft := f.Type
+			if f.Anonymous {
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				//未导出的匿名结构体，它的导出字段仍然展开到外层
+				if f.PkgPath != "" && ft.Kind() != reflect.Struct {
+					continue
+				}
+			} else if f.PkgPath != "" {
+				continue //未导出字段不参与 JSON 编码
+			}
+			tag, hasTag := f.Tag.Lookup("json")
+			parts := strings.Split(tag, ",")
+			if hasTag && parts[0] == "-" && len(parts) == 1 {
+				continue
+			}
+			name := parts[0]
+			if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, depth+1, optional || f.Type.Kind() == reflect.Ptr)
+				continue
+			}
+			field := jsonField{name: name, typ: f.Type, optional: optional, depth: depth, tagged: name != ""}
+			if name == "" {
+				field.name = f.Name
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					field.omitempty = true
+				}
+			}
+			all = append(all, field)
+		}
+	}
+	walk(t, 0, false)
+
+	//同名字段按层数和标签选出唯一的一个，保持字段的顺序
+	byName := make(map[string][]jsonField)
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	var fields []jsonField
+	for _, f := range all {
+		if dominant, ok := dominantField(byName[f.name]); ok && dominant == f {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func dominantField(fields []jsonField) (jsonField, bool) {
+	if len(fields) == 1 {
+		return fields[0], true
+	}
+	minDepth := fields[0].depth
+	for _, f := range fields[1:] {
+		if f.depth < minDepth {
+			minDepth = f.depth
+		}
+	}
+	var shallow, tagged []jsonField
+	for _, f := range fields {
+		if f.depth == minDepth {
+			shallow = append(shallow, f)
+			if f.tagged {
+				tagged = append(tagged, f)
+			}
+		}
+	}
+	switch {
+	case len(shallow) == 1:
+		return shallow[0], true
+	case len(tagged) == 1:
+		return tagged[0], true
+	}
+	return jsonField{}, false
+}
+
+// 以 JSON 输出 OpenAPI 文档
+type openAPIHandler struct {
+	server *Server
+	prefix string
+}
+
+func (h openAPIHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(h.server.OpenAPI(h.prefix))
+}
+
+// 在 http.DefaultServeMux 上注册 OpenAPI 文档，描述 HandleGateway 注册的网关
+func (server *Server) HandleOpenAPI() {
+	http.Handle(DefaultOpenAPIPath, openAPIHandler{server: server, prefix: DefaultGatewayPath})
+}
+
+func HandleOpenAPI() {
+	DefaultServer.HandleOpenAPI()
+}
@@ -0,0 +1,209 @@
+package geerpc
+
+import (
+	"crypto/tls"
+	"geerpc/codec"
+	"log"
+	"time"
+)
+
+/**
+ * 函数式选项
+ *
+ * 客户端和服务端的设置都可以通过函数式选项传入，增加新的设置不会影响已有的调用：
+ *   server := geerpc.NewServer(geerpc.WithHandleTimeout(time.Second), geerpc.WithLogger(logger))
+ *   client, _ := geerpc.Dial("tcp", addr, geerpc.WithCodec(codec.JsonType), geerpc.WithConnectTimeout(time.Second))
+ * *Option 本身也是一个 DialOption，原来的 Dial("tcp", addr, &geerpc.Option{...}) 仍然可用，
+ * 它会整体替换之前的设置，所以和函数式选项一起使用时要放在最前面；多个选项按顺序生效
+ */
+
+type DialOption interface {
+	applyDial(opt *Option)
+}
+
+// 整体替换
+func (o *Option) applyDial(opt *Option) {
+	if o != nil {
+		*opt = *o
+	}
+}
+
+type dialOptionFunc func(opt *Option)
+
+func (f dialOptionFunc) applyDial(opt *Option) {
+	f(opt)
+}
+
+// 编解码方式
+func WithCodec(t codec.Type) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.CodecType = t
+	})
+}
+
+// 建立连接的超时时间，包括 TCP 连接和握手，0表示不限制
+func WithConnectTimeout(d time.Duration) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.ConnectTimeout = d
+	})
+}
+
+// 主机名解析出多个地址时并行建立连接的间隔，见 dial.go
+func WithDialStagger(d time.Duration) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.DialStagger = d
+	})
+}
+
+// 建立 TLS 连接
+func WithTLS(config *tls.Config) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.TLSConfig = config
+	})
+}
+
+// 客户端标识
+func WithClientID(id string) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.ClientID = id
+	})
+}
+
+// 打开连接的可选功能，见 FlagChecksum 等，可以多次使用
+func WithFlags(flags uint32) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.Flags |= flags
+	})
+}
+
+// 提供给服务端回调的服务
+func WithCallbacks(callbacks *Server) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.Callbacks = callbacks
+	})
+}
+
+// 写合并，见 batch.go
+func WithBatching(delay time.Duration, size int) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.BatchDelay, opt.BatchSize = delay, size
+	})
+}
+
+// Go 创建的 done 通道的容量和通道满时的处理策略
+func WithDone(buffer int, policy DonePolicy) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.DoneBuffer, opt.DonePolicy = buffer, policy
+	})
+}
+
+// 等待响应的调用数上限，服务端不响应时调用不会无限堆积
+func WithMaxPending(n int) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.MaxPending = n
+	})
+}
+
+// 大消息分块传输，chunkSize 是每块的最大字节数，maxBodySize 是接收的消息的最大字节数，0表示默认值
+func WithChunking(chunkSize, maxBodySize int) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.Flags |= FlagChunked
+		opt.ChunkSize, opt.MaxBodySize = chunkSize, maxBodySize
+	})
+}
+
+// 编解码器的读写缓冲区大小，大消息、高吞吐时调大可以减少系统调用，连接很多时调小可以节省内存，0表示默认的 4KB
+func WithBufferSizes(read, write int) DialOption {
+	return dialOptionFunc(func(opt *Option) {
+		opt.ReadBufferSize, opt.WriteBufferSize = read, write
+	})
+}
+
+// 按顺序应用选项，返回新的 Option，不修改传入的 *Option
+func parseOptions(opts ...DialOption) *Option {
+	opt := *DefaultOption
+	for _, o := range opts {
+		if o != nil {
+			o.applyDial(&opt)
+		}
+	}
+	opt.MagicNumber = DefaultOption.MagicNumber //是否是RPC调用
+	if opt.CodecType == "" {
+		opt.CodecType = DefaultOption.CodecType //若类型为空则以默认调用
+	}
+	return &opt
+}
+
+// 服务端选项
+type ServerOption func(server *Server)
+
+// 方法没有通过 MethodOption 设置超时时间时使用的处理超时时间，0表示不限制
+func WithHandleTimeout(d time.Duration) ServerOption {
+	return func(server *Server) {
+		server.handleTimeout = d
+	}
+}
+
+// 服务端日志输出，为nil时使用 log 包的默认输出
+func WithLogger(logger *log.Logger) ServerOption {
+	return func(server *Server) {
+		server.logger = logger
+	}
+}
+
+// 同 SetCodecRegistry
+func WithCodecRegistry(r *codec.Registry) ServerOption {
+	return func(server *Server) {
+		server.codecs = r
+	}
+}
+
+// 同 SetDrainTimeout
+func WithDrainTimeout(d time.Duration) ServerOption {
+	return func(server *Server) {
+		server.SetDrainTimeout(d)
+	}
+}
+
+// 同 SetSlowThreshold
+func WithSlowThreshold(d time.Duration) ServerOption {
+	return func(server *Server) {
+		server.SetSlowThreshold(d)
+	}
+}
+
+// 同 SetValidator
+func WithValidator(v ValidatorFunc) ServerOption {
+	return func(server *Server) {
+		server.SetValidator(v)
+	}
+}
+
+// 客户端分块传输时，服务端接收的消息的最大字节数，0表示默认的 64MB
+func WithMaxBodySize(n int) ServerOption {
+	return func(server *Server) {
+		server.maxBodySize = n
+	}
+}
+
+// 服务端编解码器的读写缓冲区大小，对之后建立的连接生效，0表示默认的 4KB，见 codec/buffer.go
+func WithServerBufferSizes(read, write int) ServerOption {
+	return func(server *Server) {
+		server.bufferSizes = codec.BufferOptions{ReadSize: read, WriteSize: write}
+	}
+}
+
+// 同 AddPlugin，可以多次使用
+func WithPlugin(p Plugin) ServerOption {
+	return func(server *Server) {
+		server.AddPlugin(p)
+	}
+}
+
+func (server *Server) logf(format string, v ...interface{}) {
+	if server.logger != nil {
+		server.logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
@@ -0,0 +1,291 @@
+package geerpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+ * 通过 OTLP 推送指标
+ *
+ * 不使用拉取方式采集指标时，服务端定期把 ServerStats 和每个方法的 MethodStats
+ * 以 OTLP/HTTP（JSON 编码）推送到 OpenTelemetry Collector 或兼容的后端：
+ *   server := geerpc.NewServer(geerpc.WithOTLPMetrics(geerpc.OTLPOption{
+ *       Endpoint:    "http://otel-collector:4318/v1/metrics",
+ *       ServiceName: "user-service",
+ *   }))
+ * 推送的指标：
+ *   rpc.server.connections、rpc.server.inflight              当前值（gauge）
+ *   rpc.server.requests、rpc.server.errors、rpc.server.slow_calls、rpc.server.rejected_connections、
+ *   rpc.server.handshake_timeouts、
+ *   rpc.server.bytes_sent、rpc.server.bytes_received          累计值（sum）
+ *   rpc.server.calls、rpc.server.call_errors                 按 rpc.method 区分的累计值
+ *   rpc.server.duration                                      按 rpc.method 区分的耗时直方图，单位毫秒
+ * 累计值的起始时间是服务器创建的时间（统计从这时开始），与何时开始推送无关；服务器 Close 后推送最后一次并停止
+ * 不依赖 OpenTelemetry SDK，推送失败只记录日志，下一次推送的仍然是完整的累计值
+ */
+
+// 默认的推送间隔
+const DefaultOTLPInterval = 10 * time.Second
+
+type OTLPOption struct {
+	Endpoint    string            //接收地址，如 http://localhost:4318/v1/metrics
+	Interval    time.Duration     //推送间隔，0表示 DefaultOTLPInterval
+	Timeout     time.Duration     //每次推送的超时时间，0表示与推送间隔相同
+	Headers     map[string]string //附加的 HTTP 头，如认证信息
+	ServiceName string            //resource 中的 service.name，为空时不设置
+	Client      *http.Client      //为nil时使用 http.DefaultClient
+}
+
+// 同 SetOTLPMetrics
+func WithOTLPMetrics(opt OTLPOption) ServerOption {
+	return func(server *Server) {
+		server.SetOTLPMetrics(&opt)
+	}
+}
+
+// 开始定期推送指标，opt 为nil时停止；再次调用时替换之前的设置
+func (server *Server) SetOTLPMetrics(opt *OTLPOption) {
+	var e *otlpExporter
+	if opt != nil {
+		o := *opt
+		if o.Interval <= 0 {
+			o.Interval = DefaultOTLPInterval
+		}
+		if o.Timeout <= 0 {
+			o.Timeout = o.Interval
+		}
+		if o.Client == nil {
+			o.Client = http.DefaultClient
+		}
+		e = &otlpExporter{server: server, opt: o, stop: make(chan struct{})}
+	}
+	if old := server.otlp.Swap(e); old != nil {
+		old.close()
+	}
+	if e != nil {
+		go e.run()
+	}
+}
+
+type otlpExporter struct {
+	server *Server
+	opt    OTLPOption
+	once   sync.Once
+	stop   chan struct{}
+}
+
+func (e *otlpExporter) close() {
+	e.once.Do(func() { close(e.stop) })
+}
+
+func (e *otlpExporter) run() {
+	ticker := time.NewTicker(e.opt.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+		//关闭之后再推送一次，包含关闭前最后的数据
+		closed := e.server.isClosed()
+		if err := e.push(); err != nil {
+			e.server.logf("rpc server: otlp export: %v", err)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+func (e *otlpExporter) push() error {
+	body, err := json.Marshal(e.collect(time.Now()))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.opt.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opt.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.opt.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.opt.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON 编码的结构，只包含用到的字段；64 位整数按 protobuf 的 JSON 映射编码为字符串
+type (
+	otlpRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpMetric struct {
+		Name      string         `json:"name"`
+		Unit      string         `json:"unit,omitempty"`
+		Gauge     *otlpGauge     `json:"gauge,omitempty"`
+		Sum       *otlpSum       `json:"sum,omitempty"`
+		Histogram *otlpHistogram `json:"histogram,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpNumberPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpNumberPoint `json:"dataPoints"`
+		AggregationTemporality int               `json:"aggregationTemporality"`
+		IsMonotonic            bool              `json:"isMonotonic"`
+	}
+	otlpNumberPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsInt             string         `json:"asInt"`
+	}
+	otlpHistogram struct {
+		DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+		AggregationTemporality int                  `json:"aggregationTemporality"`
+	}
+	otlpHistogramPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		Count             string         `json:"count"`
+		Sum               float64        `json:"sum"`
+		BucketCounts      []string       `json:"bucketCounts"`
+		ExplicitBounds    []float64      `json:"explicitBounds"`
+		Max               float64        `json:"max"`
+	}
+)
+
+const otlpCumulative = 2 //AGGREGATION_TEMPORALITY_CUMULATIVE
+
+// 收集当前的指标
+func (e *otlpExporter) collect(now time.Time) otlpRequest {
+	start, ts := strconv.FormatInt(e.server.started.UnixNano(), 10), strconv.FormatInt(now.UnixNano(), 10)
+	gauge := func(name, unit string, v int64) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Gauge: &otlpGauge{DataPoints: []otlpNumberPoint{
+			{TimeUnixNano: ts, AsInt: strconv.FormatInt(v, 10)},
+		}}}
+	}
+	sum := func(name, unit string, points []otlpNumberPoint) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Sum: &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}}
+	}
+	point := func(attrs []otlpKeyValue, v uint64) otlpNumberPoint {
+		return otlpNumberPoint{Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: ts, AsInt: strconv.FormatUint(v, 10)}
+	}
+
+	st := e.server.Stats()
+	metrics := []otlpMetric{
+		gauge("rpc.server.connections", "{connection}", int64(st.Connections)),
+		gauge("rpc.server.inflight", "{request}", st.Inflight),
+		sum("rpc.server.requests", "{request}", []otlpNumberPoint{point(nil, st.Requests)}),
+		sum("rpc.server.errors", "{request}", []otlpNumberPoint{point(nil, st.Errors)}),
+		sum("rpc.server.slow_calls", "{request}", []otlpNumberPoint{point(nil, st.SlowCalls)}),
+		sum("rpc.server.rejected_connections", "{connection}", []otlpNumberPoint{point(nil, st.RejectedConns)}),
+		sum("rpc.server.handshake_timeouts", "{connection}", []otlpNumberPoint{point(nil, st.HandshakeTimeouts)}),
+		sum("rpc.server.bytes_sent", "By", []otlpNumberPoint{point(nil, st.BytesSent)}),
+		sum("rpc.server.bytes_received", "By", []otlpNumberPoint{point(nil, st.BytesReceived)}),
+	}
+
+	var calls, errs []otlpNumberPoint
+	var durations []otlpHistogramPoint
+	for _, m := range e.server.Methods() {
+		ms, err := e.server.MethodStats(m.Service + "." + m.Method)
+		if err != nil || ms.Count == 0 {
+			continue
+		}
+		attrs := []otlpKeyValue{
+			{Key: "rpc.service", Value: otlpValue{StringValue: m.Service}},
+			{Key: "rpc.method", Value: otlpValue{StringValue: m.Method}},
+		}
+		calls = append(calls, point(attrs, ms.Count))
+		errs = append(errs, point(attrs, ms.Errors))
+		durations = append(durations, histogramPoint(attrs, start, ts, &ms))
+	}
+	if len(calls) > 0 {
+		metrics = append(metrics,
+			sum("rpc.server.calls", "{call}", calls),
+			sum("rpc.server.call_errors", "{call}", errs),
+			otlpMetric{Name: "rpc.server.duration", Unit: "ms", Histogram: &otlpHistogram{DataPoints: durations, AggregationTemporality: otlpCumulative}},
+		)
+	}
+
+	res := otlpResource{}
+	if e.opt.ServiceName != "" {
+		res.Attributes = []otlpKeyValue{{Key: "service.name", Value: otlpValue{StringValue: e.opt.ServiceName}}}
+	}
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     res,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "geerpc"}, Metrics: metrics}},
+	}}}
+}
+
+// 把直方图转换为 OTLP 的显式分桶，只保留到最后一个非空的桶
+func histogramPoint(attrs []otlpKeyValue, start, ts string, ms *MethodStats) otlpHistogramPoint {
+	last := 0
+	for i, n := range ms.hist {
+		if n > 0 {
+			last = i
+		}
+	}
+	p := otlpHistogramPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		TimeUnixNano:      ts,
+		Count:             strconv.FormatUint(ms.Count, 10),
+		Sum:               durationMillis(ms.sum),
+		BucketCounts:      make([]string, last+1),
+		ExplicitBounds:    make([]float64, last),
+		Max:               durationMillis(ms.Max),
+	}
+	for i := 0; i <= last; i++ {
+		p.BucketCounts[i] = strconv.FormatUint(ms.hist[i], 10)
+		if i < last {
+			p.ExplicitBounds[i] = durationMillis(histUpper(i))
+		}
+	}
+	return p
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,57 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+)
+
+/**
+ * 对端信息
+ *
+ * 服务方法的第一个参数为 context.Context 时，可以从中读取这次调用的信息：
+ *   PeerFromContext        对端地址、本端地址、TLS 连接状态、unix socket 对端进程的凭证
+ *   ClientInfoFromContext  客户端标识
+ *   MetadataFromContext    请求元数据
+ *   CallbackFromContext    回调客户端的句柄
+ *   ctx.Deadline()/Done()  调用方的截止时间、取消和连接断开
+ */
+
+type Peer struct {
+	Addr      net.Addr             //对端地址，连接不是 net.Conn（如 io.Pipe）时为nil
+	LocalAddr net.Addr             //本端地址
+	TLS       *tls.ConnectionState //TLS 连接的状态，不是 TLS 连接时为nil
+	Cred      *PeerCred            //unix socket 对端进程的 uid/gid/pid，不是 unix socket 或者平台不支持时为nil
+}
+
+type peerKey struct{}
+
+// 服务方法读取对端信息
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+func newPeer(conn io.ReadWriteCloser) *Peer {
+	p := new(Peer)
+	if nc, ok := conn.(net.Conn); ok {
+		p.Addr, p.LocalAddr = nc.RemoteAddr(), nc.LocalAddr()
+	}
+	//连接建立时对端进程的凭证，之后不会变化
+	if uc, ok := conn.(*net.UnixConn); ok {
+		p.Cred, _ = GetPeerCred(uc)
+	}
+	//握手时已经读过 Option，TLS 握手已经完成
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		p.TLS = &state
+	}
+	return p
+}
+
+// HTTP 网关的对端地址
+type httpAddr string
+
+func (a httpAddr) Network() string { return "tcp" }
+func (a httpAddr) String() string  { return string(a) }
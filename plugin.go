@@ -0,0 +1,113 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"io"
+	"sync"
+)
+
+/**
+ * 插件
+ *
+ * 鉴权、指标、链路追踪等功能通过插件组合，而不是写死在服务器里
+ * 插件可以是任意类型，实现了下面哪个钩子接口，就会在对应的时机被调用，不需要实现全部钩子：
+ *   OnConnect         新连接建立，Option 握手之前，返回 false 则关闭连接
+ *   OnDisconnect      连接关闭
+ *   PreReadRequest    读到请求头之后、读取请求体之前，返回错误则不处理该请求并把错误回复给客户端
+ *   PostWriteResponse 响应写出之后
+ *   OnRegister        服务注册之前（参数和重名检查都已通过），返回错误则注册失败
+ * 多个插件按添加顺序调用
+ */
+type Plugin interface{}
+
+type OnConnectPlugin interface {
+	OnConnect(conn io.ReadWriteCloser) bool
+}
+
+type OnDisconnectPlugin interface {
+	OnDisconnect(conn io.ReadWriteCloser)
+}
+
+type PreReadRequestPlugin interface {
+	PreReadRequest(h *codec.Header) error
+}
+
+type PostWriteResponsePlugin interface {
+	PostWriteResponse(h *codec.Header, body interface{}, err error)
+}
+
+type OnRegisterPlugin interface {
+	OnRegister(name string, rcvr interface{}) error
+}
+
+// 插件列表，添加时复制，调用时不需要加锁遍历
+type pluginContainer struct {
+	mu      sync.RWMutex
+	plugins []Plugin
+}
+
+func (pc *pluginContainer) add(p Plugin) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	plugins := make([]Plugin, len(pc.plugins), len(pc.plugins)+1)
+	copy(plugins, pc.plugins)
+	pc.plugins = append(plugins, p)
+}
+
+func (pc *pluginContainer) all() []Plugin {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+	return pc.plugins
+}
+
+// 添加插件
+func (server *Server) AddPlugin(p Plugin) {
+	server.plugins.add(p)
+}
+
+func (pc *pluginContainer) doConnect(conn io.ReadWriteCloser) bool {
+	for _, p := range pc.all() {
+		if hook, ok := p.(OnConnectPlugin); ok && !hook.OnConnect(conn) {
+			return false
+		}
+	}
+	return true
+}
+
+func (pc *pluginContainer) doDisconnect(conn io.ReadWriteCloser) {
+	for _, p := range pc.all() {
+		if hook, ok := p.(OnDisconnectPlugin); ok {
+			hook.OnDisconnect(conn)
+		}
+	}
+}
+
+func (pc *pluginContainer) doPreReadRequest(h *codec.Header) error {
+	for _, p := range pc.all() {
+		if hook, ok := p.(PreReadRequestPlugin); ok {
+			if err := hook.PreReadRequest(h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (pc *pluginContainer) doPostWriteResponse(h *codec.Header, body interface{}, err error) {
+	for _, p := range pc.all() {
+		if hook, ok := p.(PostWriteResponsePlugin); ok {
+			hook.PostWriteResponse(h, body, err)
+		}
+	}
+}
+
+func (pc *pluginContainer) doRegister(name string, rcvr interface{}) error {
+	for _, p := range pc.all() {
+		if hook, ok := p.(OnRegisterPlugin); ok {
+			if err := hook.OnRegister(name, rcvr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
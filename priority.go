@@ -0,0 +1,173 @@
+package geerpc
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+/**
+ * 请求优先级
+ *
+ * 客户端通过 WithPriority 调用选项设置优先级，放在请求头中，数值越大越优先，默认为0
+ * 服务端默认每个请求一个 goroutine，不区分优先级；开启优先级调度后，请求先进入服务器的优先队列，
+ * 由固定数量的 worker 按优先级取出处理，这样过载时交互请求不会排在批量请求后面
+ * 为了防止低优先级请求饿死，排队时间每过 Aging 优先级加1
+ * 设置了 MaxConcurrency 的方法先在请求自己的 goroutine 中等待方法的名额，拿到后才进入优先队列，
+ * worker 不会阻塞在被限流的方法上，一个方法排队的请求不会占满所有 worker
+ * 再次调用 SetPriorityScheduling 或者服务器 Close/Shutdown 时停止原来的 worker，还在排队的请求各自开启 goroutine 处理
+ */
+
+type PriorityOption struct {
+	Workers int           //同时处理请求的 worker 数，必须大于0
+	Aging   time.Duration //排队时间每过 Aging 优先级加1，0表示默认的1秒
+}
+
+/**
+ * 开启优先级调度，需要在 Accept 之前调用
+ */
+func (server *Server) SetPriorityScheduling(opt PriorityOption) {
+	if opt.Workers <= 0 {
+		panic("rpc server: priority scheduling requires at least one worker")
+	}
+	if opt.Aging <= 0 {
+		opt.Aging = time.Second
+	}
+	s := &scheduler{aging: opt.Aging}
+	s.cond = sync.NewCond(&s.mu)
+	for i := 0; i < opt.Workers; i++ {
+		go s.work()
+	}
+	server.sched.Swap(s).stop()
+}
+
+// 调度：有优先队列时排队，否则直接开启 goroutine
+func (server *Server) schedule(priority int, req *request, task func()) {
+	s := server.sched.Load()
+	if s == nil {
+		go task()
+		return
+	}
+	m := req.mtype
+	if m.sem == nil {
+		s.submit(priority, task)
+		return
+	}
+	//方法有并发限制：有空闲名额时直接排队，否则在自己的 goroutine 中等待，不占用 worker
+	select {
+	case m.sem <- struct{}{}:
+		req.acquired = true
+		s.submit(priority, task)
+		return
+	default:
+	}
+	go func() {
+		ctx := req.ctx
+		if timeout := server.methodTimeout(m); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = WithClockTimeout(ctx, server.clock, timeout)
+			defer cancel()
+		}
+		//等待失败时也要排队，由 handleRequest 回复错误
+		if req.acquireErr = m.acquire(ctx); req.acquireErr == nil {
+			req.acquired = true
+		}
+		s.submit(priority, task)
+	}()
+}
+
+type scheduler struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	aging   time.Duration
+	queue   taskQueue
+	seq     uint64 //入队顺序，保证相同优先级先进先出
+	stopped bool   //worker 已经退出，之后提交的任务各自开启 goroutine
+}
+
+type task struct {
+	run      func()
+	key      int64 //见 submit
+	seq      uint64
+	enqueued time.Time
+}
+
+/**
+ * 有效优先级 = priority + 排队时间/aging，所有请求随时间以相同的速度增长，
+ * 所以两个请求的先后只取决于 priority*aging - 入队时间，入队时计算一次即可用堆排序
+ */
+func (s *scheduler) submit(priority int, run func()) {
+	now := time.Now()
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		go run()
+		return
+	}
+	s.seq++
+	heap.Push(&s.queue, &task{
+		run:      run,
+		key:      int64(priority)*int64(s.aging) - now.UnixNano(),
+		seq:      s.seq,
+		enqueued: now,
+	})
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+func (s *scheduler) work() {
+	for {
+		s.mu.Lock()
+		for s.queue.Len() == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+		t := heap.Pop(&s.queue).(*task)
+		s.mu.Unlock()
+		t.run()
+	}
+}
+
+// 停止所有 worker，还在排队的任务各自开启 goroutine 处理，s 为nil时不做任何事
+func (s *scheduler) stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	queue := s.queue
+	s.queue = nil
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	for _, t := range queue {
+		go t.run()
+	}
+}
+
+// 按 key 从大到小的堆
+type taskQueue []*task
+
+func (q taskQueue) Len() int { return len(q) }
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].key != q[j].key {
+		return q[i].key > q[j].key
+	}
+	return q[i].seq < q[j].seq
+}
+func (q taskQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *taskQueue) Push(x interface{}) { *q = append(*q, x.(*task)) }
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return t
+}
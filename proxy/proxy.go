@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geerpc"
+	"geerpc/codec"
+	"geerpc/xclient"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+/**
+ * RPC 反向代理
+ *
+ * Proxy 接受客户端的连接，按 ServiceMethod 的前缀把请求路由到不同的上游服务，
+ * 每个路由有自己的服务发现和负载均衡（XClient）：
+ *   p := proxy.New()
+ *   p.Route("Order.", xclient.NewMultiServerDiscovery([]string{"tcp@10.0.0.1:9999"}), xclient.RoundRobinSelect, nil)
+ *   p.Route("User.", userDiscovery, xclient.ConsistentHashSelect, nil)
+ *   p.Accept(l)
+ *
+ * 代理不解码请求体，只按原始字节转发，所以不需要知道参数和返回值的类型，
+ * 这要求编解码方式是自描述的，目前只支持 CBOR（可以同时使用校验和、压缩）；
+ * gob 的类型信息是按连接发送的，无法在不同连接之间转发原始数据
+ * 请求头中的截止时间、优先级、元数据和版本会一起转发，调用方取消时上游的调用也会被取消
+ * 代理是信任边界，客户端设置的保留元数据键（"rpc-" 开头）默认不转发，需要转发的通过 PassReservedMeta 指定：
+ *   p.PassReservedMeta(geerpc.TraceParentMeta)
+ */
+
+var ErrNoRoute = errors.New("rpc proxy: no route")
+
+type route struct {
+	prefix string
+	xc     *xclient.XClient
+}
+
+type Proxy struct {
+	mu     sync.RWMutex
+	routes []*route //按前缀长度从长到短排列，最长的前缀优先匹配
+	pass   []string //转发给上游的保留元数据键
+}
+
+func New() *Proxy {
+	return &Proxy{}
+}
+
+/**
+ * 添加路由：ServiceMethod 以 prefix 开头的请求转发给 d 发现的上游实例
+ * opt 为上游连接使用的 Option，为nil时使用 CBOR 编解码
+ */
+func (p *Proxy) Route(prefix string, d xclient.Discovery, mode xclient.SelectMode, opt *geerpc.Option) error {
+	if opt == nil {
+		opt = &geerpc.Option{MagicNumber: geerpc.MagicNumber, CodecType: codec.CborType}
+	}
+	if opt.CodecType != codec.CborType {
+		return fmt.Errorf("rpc proxy: codec type %s can't be forwarded, use %s", opt.CodecType, codec.CborType)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.routes {
+		if r.prefix == prefix {
+			return errors.New("rpc proxy: route already defined: " + prefix)
+		}
+	}
+	p.routes = append(p.routes, &route{prefix: prefix, xc: xclient.NewXClient(d, mode, opt)})
+	sort.SliceStable(p.routes, func(i, j int) bool { return len(p.routes[i].prefix) > len(p.routes[j].prefix) })
+	return nil
+}
+
+func (p *Proxy) match(serviceMethod string) *xclient.XClient {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, r := range p.routes {
+		if strings.HasPrefix(serviceMethod, r.prefix) {
+			return r.xc
+		}
+	}
+	return nil
+}
+
+// 转发客户端设置的这些保留元数据键，其他保留键丢弃，需要在 Accept 之前调用
+func (p *Proxy) PassReservedMeta(keys ...string) {
+	p.pass = keys
+}
+
+// 关闭所有上游连接
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.routes {
+		_ = r.xc.Close()
+	}
+	p.routes = nil
+	return nil
+}
+
+// 接受连接并代理，监听器出错时返回
+func (p *Proxy) Accept(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Println("rpc proxy: accept error:", err)
+			return err
+		}
+		go p.ServeConn(conn)
+	}
+}
+
+// 代理一个客户端连接
+func (p *Proxy) ServeConn(conn io.ReadWriteCloser) {
+	defer func() { _ = conn.Close() }()
+	opt, cc, err := geerpc.Handshake(conn, nil)
+	if err != nil {
+		log.Println("rpc proxy:", err)
+		return
+	}
+	if opt.CodecType != codec.CborType {
+		log.Printf("rpc proxy: codec type %s can't be forwarded", opt.CodecType)
+		return
+	}
+
+	sending := new(sync.Mutex)
+	var wg sync.WaitGroup
+	connCtx, cancelConn := context.WithCancel(context.Background())
+	defer cancelConn()
+	var mu sync.Mutex
+	cancels := make(map[uint64]context.CancelFunc) //正在转发的请求，Seq -> 取消函数
+
+	for {
+		var h codec.Header
+		if err := cc.ReadHeader(&h); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				log.Println("rpc proxy: read header error:", err)
+			}
+			break
+		}
+		var body cbor.RawMessage
+		if err := cc.ReadBody(&body); err != nil {
+			log.Println("rpc proxy: read body error:", err)
+			break
+		}
+		if h.ServiceMethod == geerpc.CancelServiceMethod {
+			mu.Lock()
+			if cancel := cancels[h.Seq]; cancel != nil {
+				cancel()
+			}
+			mu.Unlock()
+			continue
+		}
+		xc := p.match(h.ServiceMethod)
+		if xc == nil {
+			h.Error = fmt.Sprintf("%s for %s", ErrNoRoute, h.ServiceMethod)
+			p.reply(cc, &h, nil, sending)
+			continue
+		}
+
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if h.Deadline != 0 {
+			ctx, cancel = context.WithDeadline(connCtx, time.Unix(0, h.Deadline))
+		} else {
+			ctx, cancel = context.WithCancel(connCtx)
+		}
+		mu.Lock()
+		cancels[h.Seq] = cancel
+		mu.Unlock()
+		wg.Add(1)
+		go func(h codec.Header, body cbor.RawMessage) {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(cancels, h.Seq)
+				mu.Unlock()
+				cancel()
+			}()
+			opts := []geerpc.CallOption{geerpc.WithPriority(h.Priority), geerpc.WithVersion(h.Version)}
+			for k, v := range geerpc.StripReservedMeta(h.Meta, p.pass...) {
+				opts = append(opts, geerpc.WithMetadata(k, v))
+			}
+			var reply cbor.RawMessage
+			err := xc.Call(ctx, h.ServiceMethod, body, &reply, opts...)
+			//调用方已经取消，不再回复
+			if ctx.Err() == context.Canceled && connCtx.Err() == nil {
+				return
+			}
+			if err != nil {
+				h.Error = err.Error()
+			}
+			p.reply(cc, &h, reply, sending)
+		}(h, body)
+	}
+	cancelConn()
+	wg.Wait()
+}
+
+// 回复客户端，只保留请求头中客户端需要的字段
+func (p *Proxy) reply(cc codec.Codec, h *codec.Header, body cbor.RawMessage, sending *sync.Mutex) {
+	resp := codec.Header{ServiceMethod: h.ServiceMethod, Seq: h.Seq, Error: h.Error}
+	var v interface{} = struct{}{}
+	if h.Error == "" && body != nil {
+		v = body
+	}
+	sending.Lock()
+	defer sending.Unlock()
+	if err := cc.Write(&resp, v); err != nil {
+		log.Println("rpc proxy: write response error:", err)
+	}
+}
@@ -0,0 +1,191 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"geerpc/codec"
+	"log"
+	"sync"
+)
+
+/**
+ * 发布/订阅
+ *
+ * 建立在双向 RPC 上：客户端订阅主题后，服务端通过同一个连接把消息推送给它，
+ * 不需要额外的消息总线：
+ *   server.EnablePubSub()
+ *
+ *   client.Subscribe("news", func(m geerpc.Message) { ... })
+ *   client.Publish("news", []byte("hello")) //任何客户端都可以发布
+ *   server.Publish("news", []byte("hello")) //服务端也可以直接发布
+ *
+ * 消息内容是字节，由使用方自己编码；推送是尽力而为的，连接断开的订阅者会被移除，
+ * 同一个订阅者收到的消息与发布的顺序一致
+ */
+
+const PubSubServiceName = "PubSub"
+
+// 服务端推送消息时回调的方法，服务名 geerpc 不是导出的名字，不会与注册的服务冲突
+const deliverServiceMethod = "geerpc.Deliver"
+
+type Message struct {
+	Topic string
+	Data  []byte
+}
+
+var ErrPubSubDisabled = errors.New("rpc pubsub: callbacks are not supported by this connection")
+
+type pubSub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Callback]struct{}
+}
+
+// 注册内置的 PubSub 服务
+func (server *Server) EnablePubSub() error {
+	ps := &pubSub{topics: make(map[string]map[*Callback]struct{})}
+	if err := server.RegisterName(PubSubServiceName, &pubSubService{ps: ps}); err != nil {
+		return err
+	}
+	server.pubsub = ps
+	return nil
+}
+
+// 在服务端发布消息，返回推送的订阅者数量，没有开启发布/订阅时返回0
+func (server *Server) Publish(topic string, data []byte) int {
+	if server.pubsub == nil {
+		return 0
+	}
+	return server.pubsub.publish(Message{Topic: topic, Data: data})
+}
+
+func (ps *pubSub) subscribe(topic string, cb *Callback) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	subs := ps.topics[topic]
+	if subs == nil {
+		subs = make(map[*Callback]struct{})
+		ps.topics[topic] = subs
+	}
+	subs[cb] = struct{}{}
+}
+
+func (ps *pubSub) unsubscribe(topic string, cb *Callback) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.topics[topic], cb)
+	if len(ps.topics[topic]) == 0 {
+		delete(ps.topics, topic)
+	}
+}
+
+// 依次发出推送保证顺序，不等待订阅者处理完，推送失败（连接已经断开）的订阅者被移除
+func (ps *pubSub) publish(m Message) int {
+	ps.mu.RLock()
+	subs := make([]*Callback, 0, len(ps.topics[m.Topic]))
+	for cb := range ps.topics[m.Topic] {
+		subs = append(subs, cb)
+	}
+	ps.mu.RUnlock()
+	if len(subs) == 0 {
+		return 0
+	}
+	done := make(chan *Call, len(subs))
+	owners := make(map[*Call]*Callback, len(subs))
+	for _, cb := range subs {
+		owners[cb.Go(deliverServiceMethod, m, new(bool), done)] = cb
+	}
+	go func() {
+		for range subs {
+			call := <-done
+			if call.Error == ErrShutdown {
+				ps.unsubscribe(m.Topic, owners[call])
+			}
+		}
+	}()
+	return len(subs)
+}
+
+// 内置的 PubSub 服务
+type pubSubService struct {
+	ps *pubSub
+}
+
+func (s *pubSubService) Subscribe(ctx context.Context, topic string, ok *bool) error {
+	cb := CallbackFromContext(ctx)
+	if cb == nil {
+		return ErrPubSubDisabled
+	}
+	s.ps.subscribe(topic, cb)
+	*ok = true
+	return nil
+}
+
+func (s *pubSubService) Unsubscribe(ctx context.Context, topic string, ok *bool) error {
+	cb := CallbackFromContext(ctx)
+	if cb == nil {
+		return ErrPubSubDisabled
+	}
+	s.ps.unsubscribe(topic, cb)
+	*ok = true
+	return nil
+}
+
+// 返回推送的订阅者数量
+func (s *pubSubService) Publish(m Message, n *int) error {
+	*n = s.ps.publish(m)
+	return nil
+}
+
+/**
+ * 订阅主题，服务端推送的消息交给 handler 处理
+ * handler 在接收响应的 goroutine 中调用，耗时的处理需要自己放到其他 goroutine，否则会阻塞这个连接
+ */
+func (client *Client) Subscribe(topic string, handler func(Message)) error {
+	client.subsMu.Lock()
+	if client.subs == nil {
+		client.subs = make(map[string]func(Message))
+	}
+	client.subs[topic] = handler
+	client.subsMu.Unlock()
+	var ok bool
+	if err := client.Call(PubSubServiceName+".Subscribe", topic, &ok); err != nil {
+		client.subsMu.Lock()
+		delete(client.subs, topic)
+		client.subsMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (client *Client) Unsubscribe(topic string) error {
+	client.subsMu.Lock()
+	delete(client.subs, topic)
+	client.subsMu.Unlock()
+	var ok bool
+	return client.Call(PubSubServiceName+".Unsubscribe", topic, &ok)
+}
+
+// 发布消息，返回推送的订阅者数量
+func (client *Client) Publish(topic string, data []byte) (int, error) {
+	var n int
+	err := client.Call(PubSubServiceName+".Publish", Message{Topic: topic, Data: data}, &n)
+	return n, err
+}
+
+// 处理服务端推送的消息
+func (client *Client) deliver(h *codec.Header) error {
+	var m Message
+	if err := client.cc.ReadBody(&m); err != nil {
+		return err
+	}
+	client.subsMu.Lock()
+	handler := client.subs[m.Topic]
+	client.subsMu.Unlock()
+	if handler != nil {
+		handler(m)
+	} else {
+		log.Println("rpc client: message for unsubscribed topic", m.Topic)
+	}
+	client.replyCallback(h, nil, true)
+	return nil
+}
@@ -0,0 +1,204 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+/**
+ * 自动重连的客户端
+ *
+ * 连接断开后在后台按指数退避重连，重连时通过 Resume 恢复原来的会话
+ * 断线期间发起的调用不会立即失败，而是排队等待重连成功后再发送，
+ * 排队的调用数和等待时间都有上限，ctx 被取消或截止时间到达时同样放弃等待：
+ *   rc, _ := geerpc.DialReconnect("tcp", addr, &geerpc.ReconnectOption{MaxQueue: 1000, MaxWait: 3 * time.Second})
+ *   err := rc.CallContext(ctx, "Foo.Sum", args, &reply)
+ * 已经发出的调用在连接断开时以连接错误结束，不会自动重发，是否重试由调用方决定
+ */
+
+type ReconnectOption struct {
+	MaxQueue int           //断线期间最多排队的调用数，默认 100
+	MaxWait  time.Duration //调用最多等待重连的时间，默认 5s
+	Backoff  time.Duration //重连的初始间隔，每次失败翻倍，最多 maxReconnectBackoff，默认 100ms
+	//重连成功后在单独的 goroutine 中调用，attempts 为这次重连尝试的次数
+	OnReconnect func(client *Client, attempts int)
+}
+
+const maxReconnectBackoff = 5 * time.Second
+
+var (
+	ErrReconnectQueueFull = errors.New("rpc client: too many calls waiting for reconnection")
+	ErrReconnectTimeout   = errors.New("rpc client: timeout waiting for reconnection")
+)
+
+type ReconnectClient struct {
+	network string
+	address string
+	opt     ReconnectOption
+	clock   Clock         //等待和退避的时间源，即 DialOption 中的 Clock
+	done    chan struct{} //Close 时关闭
+	mu      sync.Mutex    //保护以下字段
+	client  *Client
+	ready   chan struct{} //重连成功时关闭
+	retry   bool          //正在重连
+	queued  int
+	closed  bool
+}
+
+// 建立连接，第一次连接失败时直接返回错误
+func DialReconnect(network, address string, ropt *ReconnectOption, opts ...DialOption) (*ReconnectClient, error) {
+	client, err := Dial(network, address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	rc := &ReconnectClient{network: network, address: address, client: client, clock: clockOrReal(client.opt.Clock), done: make(chan struct{})}
+	if ropt != nil {
+		rc.opt = *ropt
+	}
+	if rc.opt.MaxQueue <= 0 {
+		rc.opt.MaxQueue = 100
+	}
+	if rc.opt.MaxWait <= 0 {
+		rc.opt.MaxWait = 5 * time.Second
+	}
+	if rc.opt.Backoff <= 0 {
+		rc.opt.Backoff = 100 * time.Millisecond
+	}
+	return rc, nil
+}
+
+func (rc *ReconnectClient) Call(serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	return rc.CallContext(context.Background(), serviceMethod, args, reply, opts...)
+}
+
+func (rc *ReconnectClient) CallContext(ctx context.Context, serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	client, err := rc.get(ctx)
+	if err != nil {
+		return err
+	}
+	return client.CallContext(ctx, serviceMethod, args, reply, opts...)
+}
+
+// 当前可用的连接，断线时开始重连并排队等待
+func (rc *ReconnectClient) get(ctx context.Context) (*Client, error) {
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return nil, ErrShutdown
+	}
+	if rc.client.IsAvailable() {
+		client := rc.client
+		rc.mu.Unlock()
+		return client, nil
+	}
+	if !rc.retry {
+		rc.retry = true
+		rc.ready = make(chan struct{})
+		go rc.reconnect(rc.client)
+	}
+	if rc.queued >= rc.opt.MaxQueue {
+		rc.mu.Unlock()
+		return nil, ErrReconnectQueueFull
+	}
+	rc.queued++
+	ready := rc.ready
+	rc.mu.Unlock()
+	defer func() {
+		rc.mu.Lock()
+		rc.queued--
+		rc.mu.Unlock()
+	}()
+
+	timer := rc.clock.NewTimer(rc.opt.MaxWait)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		return rc.client, nil
+	case <-timer.C():
+		return nil, ErrReconnectTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-rc.done:
+		return nil, ErrShutdown
+	}
+}
+
+// 后台重连，成功后唤醒所有排队的调用
+func (rc *ReconnectClient) reconnect(prev *Client) {
+	backoff := rc.opt.Backoff
+	for attempts := 1; ; attempts++ {
+		client, err := DialResume(rc.network, rc.address, prev)
+		if err == nil {
+			rc.mu.Lock()
+			if rc.closed {
+				rc.mu.Unlock()
+				_ = client.Close()
+				return
+			}
+			rc.client = client
+			rc.retry = false
+			close(rc.ready)
+			rc.mu.Unlock()
+			_ = prev.Close()
+			if rc.opt.OnReconnect != nil {
+				go rc.opt.OnReconnect(client, attempts)
+			}
+			return
+		}
+		log.Printf("rpc client: reconnect to %s failed: %v, retry in %s", rc.address, err, backoff)
+		t := rc.clock.NewTimer(backoff)
+		select {
+		case <-t.C():
+		case <-rc.done:
+			t.Stop()
+			return
+		}
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+/**
+ * 当前状态：正在重连时为 ClientConnecting，连接断开、还没有调用触发重连时为 ClientIdle，
+ * Close 之后为 ClientClosed，其他时候为当前连接的状态
+ */
+func (rc *ReconnectClient) State() ClientState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	switch {
+	case rc.closed:
+		return ClientClosed
+	case rc.retry:
+		return ClientConnecting
+	}
+	if s := rc.client.State(); s != ClientClosed {
+		return s
+	}
+	return ClientIdle
+}
+
+// 当前连接，可能已经断开
+func (rc *ReconnectClient) Client() *Client {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.client
+}
+
+func (rc *ReconnectClient) Close() error {
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return ErrShutdown
+	}
+	rc.closed = true
+	close(rc.done)
+	client := rc.client
+	rc.mu.Unlock()
+	return client.Close()
+}
@@ -0,0 +1,85 @@
+package geerpc
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+/**
+ * 反射服务
+ *
+ * 注册后客户端可以在运行时查询服务端有哪些服务、每个方法的参数和响应类型，
+ * 用于命令行工具（cmd/tinyrpc）等通用客户端，不需要事先知道服务的定义：
+ *   server.EnableReflection()
+ *   client.Call("Reflection.List", struct{}{}, &names)
+ *   client.Call("Reflection.Describe", "Foo", &info)
+ * 类型用 JSON Schema 描述，与 OpenAPI 文档的格式相同，命名的结构体在 Components 中
+ * Schema 以 JSON 字符串返回，任何编解码器都能传输
+ */
+
+const ReflectionServiceName = "Reflection"
+
+var ErrServiceNotFound = errors.New("rpc reflection: service not found")
+
+type MethodInfo struct {
+	Name        string
+	ArgType     string //Go 类型名，如 "main.Args"
+	ReplyType   string
+	ArgSchema   string //参数的 JSON Schema
+	ReplySchema string
+}
+
+type ServiceInfo struct {
+	Name       string
+	Methods    []MethodInfo
+	Components string //Schema 中 $ref 引用的命名结构体，JSON 对象，键为结构体名
+}
+
+type reflectionService struct {
+	server *Server
+}
+
+// 注册内置的 Reflection 服务
+func (server *Server) EnableReflection() error {
+	return server.RegisterName(ReflectionServiceName, &reflectionService{server: server})
+}
+
+// 所有服务名，按字母排序
+func (r *reflectionService) List(_ struct{}, reply *[]string) error {
+	*reply = (*reply)[:0]
+	for _, m := range r.server.Methods() {
+		if n := len(*reply); n == 0 || (*reply)[n-1] != m.Service {
+			*reply = append(*reply, m.Service)
+		}
+	}
+	return nil
+}
+
+// 一个服务的方法和类型
+func (r *reflectionService) Describe(name string, reply *ServiceInfo) error {
+	b := &openAPIBuilder{schemas: make(map[string]interface{})}
+	info := ServiceInfo{Name: name}
+	for _, m := range r.server.Methods() {
+		if m.Service != name {
+			continue
+		}
+		info.Methods = append(info.Methods, MethodInfo{
+			Name:        m.Method,
+			ArgType:     m.ArgType.String(),
+			ReplyType:   m.ReplyType.String(),
+			ArgSchema:   marshalSchema(b.schema(m.ArgType)),
+			ReplySchema: marshalSchema(b.schema(m.ReplyType)),
+		})
+	}
+	if len(info.Methods) == 0 {
+		return ErrServiceNotFound
+	}
+	info.Components = marshalSchema(b.schemas)
+	*reply = info
+	return nil
+}
+
+func marshalSchema(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
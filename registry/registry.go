@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"encoding/json"
+	"geerpc"
+	"geerpc/xclient"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 简单的 HTTP 注册中心
+ *
+ * 服务端定期发送心跳（POST）注册自己，超过 timeout 没有心跳的实例被认为已经下线
+ * 客户端通过 GET 获取所有可用实例，DELETE 用于服务端退出时主动注销
+ *   POST   X-Geerpc-Server: 实例地址，请求体为可选的 JSON 编码的 xclient.ServerInfo（权重、元数据）
+ *   GET    响应头 X-Geerpc-Servers: 逗号分隔的实例地址，响应体为 JSON 编码的 []xclient.ServerInfo
+ *   DELETE X-Geerpc-Server: 实例地址
+ */
+
+type GeeRegistry struct {
+	timeout time.Duration
+	mu      sync.Mutex //保护以下字段
+	clock   geerpc.Clock
+	servers map[string]*ServerItem
+}
+
+type ServerItem struct {
+	Info  xclient.ServerInfo
+	start time.Time //最近一次心跳的时间
+}
+
+const (
+	defaultPath    = "/_geerpc_/registry"
+	defaultTimeout = time.Minute * 5
+)
+
+// timeout 为 0 表示实例永不过期
+func New(timeout time.Duration) *GeeRegistry {
+	return &GeeRegistry{
+		servers: make(map[string]*ServerItem),
+		timeout: timeout,
+		clock:   geerpc.RealClock,
+	}
+}
+
+// 设置判断实例过期的时间源，为nil时使用真实时间，见 geerpc.Clock
+func (r *GeeRegistry) SetClock(c geerpc.Clock) {
+	if c == nil {
+		c = geerpc.RealClock
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clock = c
+}
+
+var DefaultGeeRegister = New(defaultTimeout)
+
+// 注册或续期，总是更新权重，info.Meta 为nil时保留之前的元数据
+func (r *GeeRegistry) putServer(info xclient.ServerInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info.Weight <= 0 {
+		info.Weight = 1
+	}
+	s := r.servers[info.Addr]
+	if s == nil {
+		r.servers[info.Addr] = &ServerItem{Info: info, start: r.clock.Now()}
+		return
+	}
+	if info.Meta == nil {
+		info.Meta = s.Info.Meta
+	}
+	s.Info = info
+	s.start = r.clock.Now()
+}
+
+func (r *GeeRegistry) removeServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.servers, addr)
+}
+
+// 返回可用的实例，顺带删除过期的实例
+func (r *GeeRegistry) aliveServers() []xclient.ServerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var alive []xclient.ServerInfo
+	now := r.clock.Now()
+	for addr, s := range r.servers {
+		if r.timeout == 0 || s.start.Add(r.timeout).After(now) {
+			alive = append(alive, s.Info)
+		} else {
+			delete(r.servers, addr)
+		}
+	}
+	sort.Slice(alive, func(i, j int) bool { return alive[i].Addr < alive[j].Addr })
+	return alive
+}
+
+func (r *GeeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		alive := r.aliveServers()
+		addrs := make([]string, len(alive))
+		for i, info := range alive {
+			addrs[i] = info.Addr
+		}
+		w.Header().Set("X-Geerpc-Servers", strings.Join(addrs, ","))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(alive)
+	case http.MethodPost:
+		addr := req.Header.Get("X-Geerpc-Server")
+		if addr == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		info := xclient.ServerInfo{Addr: addr}
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(req.Body).Decode(&info); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			info.Addr = addr
+		}
+		r.putServer(info)
+	case http.MethodDelete:
+		addr := req.Header.Get("X-Geerpc-Server")
+		if addr == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.removeServer(addr)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *GeeRegistry) HandleHTTP(registryPath string) {
+	http.Handle(registryPath, r)
+	log.Println("rpc registry path:", registryPath)
+}
+
+func HandleHTTP() {
+	DefaultGeeRegister.HandleHTTP(defaultPath)
+}
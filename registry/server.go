@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"geerpc"
+	"geerpc/xclient"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/**
+ * 服务端自注册
+ *
+ * 封装注册、定期心跳和退出时注销，应用不需要自己实现心跳循环：
+ *   rs, err := registry.NewRegisteredServer("http://localhost:9999/_geerpc_/registry", "tcp@10.0.0.1:8001",
+ *       map[string]string{"zone": "us-east-1a", "weight": "2", "version": "v2"})
+ *   defer rs.Close()
+ * meta 中的 weight 作为实例权重，其余字段原样作为元数据，供客户端按区域、版本等路由
+ */
+
+// 心跳间隔，比默认的过期时间少 1 分钟，保证实例不会在两次心跳之间过期
+const DefaultHeartbeatInterval = defaultTimeout - time.Minute
+
+type RegisteredServer struct {
+	registry string
+	info     xclient.ServerInfo
+	client   *http.Client
+	clock    geerpc.Clock //心跳计时的时间源
+	done     chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+// 注册失败时返回错误；之后心跳失败只记录日志，下一次心跳会重新注册
+func NewRegisteredServer(registryAddr, advertiseAddr string, meta map[string]string) (*RegisteredServer, error) {
+	return NewRegisteredServerWithInterval(registryAddr, advertiseAddr, meta, DefaultHeartbeatInterval)
+}
+
+// 指定心跳间隔，注册中心的过期时间不是默认值时使用
+func NewRegisteredServerWithInterval(registryAddr, advertiseAddr string, meta map[string]string, interval time.Duration) (*RegisteredServer, error) {
+	return NewRegisteredServerWithClock(registryAddr, advertiseAddr, meta, interval, geerpc.RealClock)
+}
+
+// 指定心跳的时间源，测试中使用假时钟推进时间触发心跳，见 geerpc.Clock
+func NewRegisteredServerWithClock(registryAddr, advertiseAddr string, meta map[string]string, interval time.Duration, clock geerpc.Clock) (*RegisteredServer, error) {
+	if clock == nil {
+		clock = geerpc.RealClock
+	}
+	info := xclient.ServerInfo{Addr: advertiseAddr, Weight: 1, Meta: make(map[string]string)}
+	for k, v := range meta {
+		if k == "weight" {
+			w, err := strconv.Atoi(v)
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("rpc registry: invalid weight %q", v)
+			}
+			info.Weight = w
+			continue
+		}
+		info.Meta[k] = v
+	}
+	rs := &RegisteredServer{
+		registry: registryAddr,
+		info:     info,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		clock:    clock,
+		done:     make(chan struct{}),
+	}
+	if err := rs.heartbeat(); err != nil {
+		return nil, err
+	}
+	rs.wg.Add(1)
+	go rs.heartbeatLoop(interval)
+	return rs, nil
+}
+
+func (rs *RegisteredServer) heartbeatLoop(interval time.Duration) {
+	defer rs.wg.Done()
+	t := rs.clock.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-rs.done:
+			return
+		case <-t.C():
+			if err := rs.heartbeat(); err != nil {
+				log.Println("rpc registry: heart beat err:", err)
+			}
+		}
+	}
+}
+
+func (rs *RegisteredServer) heartbeat() error {
+	body, err := json.Marshal(rs.info)
+	if err != nil {
+		return err
+	}
+	req, _ := http.NewRequest(http.MethodPost, rs.registry, bytes.NewReader(body))
+	return rs.do(req)
+}
+
+func (rs *RegisteredServer) do(req *http.Request) error {
+	req.Header.Set("X-Geerpc-Server", rs.info.Addr)
+	resp, err := rs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc registry: %s returned %s", req.Method, resp.Status)
+	}
+	return nil
+}
+
+// 停止心跳并从注册中心注销
+func (rs *RegisteredServer) Close() error {
+	var err error
+	rs.once.Do(func() {
+		close(rs.done)
+		rs.wg.Wait()
+		req, _ := http.NewRequest(http.MethodDelete, rs.registry, nil)
+		err = rs.do(req)
+	})
+	return err
+}
@@ -0,0 +1,286 @@
+package zookeeper
+
+import (
+	"encoding/json"
+	"errors"
+	"geerpc/xclient"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+/**
+ * ZooKeeper 注册中心
+ *
+ * 服务端在 basePath 下为自己创建一个临时节点（ephemeral znode），节点名为转义后的实例地址，
+ * 节点数据为 JSON 编码的 xclient.ServerInfo；会话失效时节点由 ZooKeeper 自动删除，重新建立会话后再次注册
+ * 客户端监听（watch）basePath 的子节点，实例变化时更新服务列表
+ */
+
+const DefaultBasePath = "/geerpc/registry"
+
+const defaultSessionTimeout = 10 * time.Second
+
+// 把实例地址转义为合法的节点名（节点名不能包含 "/"）
+func nodeName(addr string) string {
+	return url.QueryEscape(addr)
+}
+
+// 确保持久节点 p 以及它的父节点存在
+func ensurePath(conn *zk.Conn, p string) error {
+	cur := ""
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		cur += "/" + part
+		_, err := conn.Create(cur, nil, 0, zk.WorldACL(zk.PermAll))
+		if err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+/**
+ * 服务端注册
+ */
+type Registrar struct {
+	conn     *zk.Conn
+	basePath string
+	info     xclient.ServerInfo
+	done     chan struct{}
+	once     sync.Once
+}
+
+// 在 ZooKeeper 中注册实例 info，并在重新建立会话后自动重新注册，Close 时注销
+func Register(servers []string, basePath string, info xclient.ServerInfo) (*Registrar, error) {
+	if basePath == "" {
+		basePath = DefaultBasePath
+	}
+	conn, events, err := zk.Connect(servers, defaultSessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registrar{conn: conn, basePath: basePath, info: info, done: make(chan struct{})}
+	if err = r.register(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go r.watchSession(events)
+	return r, nil
+}
+
+func (r *Registrar) register() error {
+	if err := ensurePath(r.conn, r.basePath); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r.info)
+	if err != nil {
+		return err
+	}
+	p := path.Join(r.basePath, nodeName(r.info.Addr))
+	_, err = r.conn.Create(p, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+	if errors.Is(err, zk.ErrNodeExists) {
+		//旧会话的节点还没过期，删除后重新创建，归属到当前会话
+		if err = r.conn.Delete(p, -1); err == nil || errors.Is(err, zk.ErrNoNode) {
+			_, err = r.conn.Create(p, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+		}
+	}
+	return err
+}
+
+// 会话过期后临时节点会被删除，重新建立会话时重新注册
+func (r *Registrar) watchSession(events <-chan zk.Event) {
+	expired := false
+	for {
+		select {
+		case <-r.done:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch ev.State {
+			case zk.StateExpired:
+				expired = true
+			case zk.StateHasSession:
+				if expired {
+					expired = false
+					if err := r.register(); err != nil {
+						log.Println("rpc registry: zookeeper re-register error:", err)
+					}
+				}
+			}
+		}
+	}
+}
+
+// 注销并关闭连接
+func (r *Registrar) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+		_ = r.conn.Delete(path.Join(r.basePath, nodeName(r.info.Addr)), -1)
+		r.conn.Close()
+	})
+	return nil
+}
+
+/**
+ * 客户端服务发现
+ * 手动 Update 和 SetWeight 的结果会在节点下一次变化时被覆盖
+ */
+type Discovery struct {
+	*xclient.MultiServersDiscovery
+	conn     *zk.Conn
+	basePath string
+	mu       sync.RWMutex
+	infos    []xclient.ServerInfo
+	done     chan struct{}
+	once     sync.Once
+}
+
+var (
+	_ xclient.Discovery     = (*Discovery)(nil)
+	_ xclient.InfoDiscovery = (*Discovery)(nil)
+)
+
+// 连接 ZooKeeper 并监听 basePath 下的实例
+func NewDiscovery(servers []string, basePath string) (*Discovery, error) {
+	if basePath == "" {
+		basePath = DefaultBasePath
+	}
+	conn, _, err := zk.Connect(servers, defaultSessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	d := &Discovery{
+		MultiServersDiscovery: xclient.NewMultiServerDiscovery(make([]string, 0)),
+		conn:                  conn,
+		basePath:              basePath,
+		done:                  make(chan struct{}),
+	}
+	if err = ensurePath(conn, basePath); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	events, err := d.load()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go d.watch(events)
+	return d, nil
+}
+
+// 读取所有子节点并重新设置 watch
+func (d *Discovery) load() (<-chan zk.Event, error) {
+	children, _, events, err := d.conn.ChildrenW(d.basePath)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]xclient.ServerInfo, 0, len(children))
+	for _, child := range children {
+		data, _, err := d.conn.Get(path.Join(d.basePath, child))
+		if err != nil {
+			continue //节点可能刚被删除
+		}
+		var info xclient.ServerInfo
+		if err = json.Unmarshal(data, &info); err != nil || info.Addr == "" {
+			//没有数据时节点名即为地址
+			addr, _ := url.QueryUnescape(child)
+			info = xclient.ServerInfo{Addr: addr, Weight: 1}
+		}
+		infos = append(infos, info)
+	}
+	d.setInfos(infos)
+	return events, nil
+}
+
+// 服务列表和带权重的实例一起更新，GetAll 和 GetAllInfo 不会看到不一致的两份列表
+func (d *Discovery) setInfos(infos []xclient.ServerInfo) {
+	servers := make([]string, len(infos))
+	for i, info := range infos {
+		servers[i] = info.Addr
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_ = d.MultiServersDiscovery.Update(servers)
+	d.infos = infos
+}
+
+// 手动更新服务列表，权重为1，节点下一次变化时被覆盖
+func (d *Discovery) Update(servers []string) error {
+	infos := make([]xclient.ServerInfo, len(servers))
+	for i, s := range servers {
+		infos[i] = xclient.ServerInfo{Addr: s, Weight: 1}
+	}
+	d.setInfos(infos)
+	return nil
+}
+
+// 设置实例的权重，节点下一次变化时被覆盖
+func (d *Discovery) SetWeight(server string, weight int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	infos := make([]xclient.ServerInfo, len(d.infos))
+	copy(infos, d.infos)
+	for i := range infos {
+		if infos[i].Addr == server {
+			infos[i].Weight = weight
+		}
+	}
+	d.infos = infos
+}
+
+func (d *Discovery) watch(events <-chan zk.Event) {
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-events:
+		}
+		//watch 只触发一次，重新读取并设置
+		var err error
+		for {
+			if events, err = d.load(); err == nil {
+				break
+			}
+			log.Println("rpc registry: zookeeper watch error:", err)
+			select {
+			case <-d.done:
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// 服务列表由 watch 实时更新，不需要主动刷新
+func (d *Discovery) Refresh() error {
+	return nil
+}
+
+func (d *Discovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.MultiServersDiscovery.GetAll()
+}
+
+func (d *Discovery) GetAllInfo() ([]xclient.ServerInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	infos := make([]xclient.ServerInfo, len(d.infos))
+	copy(infos, d.infos)
+	return infos, nil
+}
+
+func (d *Discovery) Close() error {
+	d.once.Do(func() {
+		close(d.done)
+		d.conn.Close()
+	})
+	return nil
+}
@@ -0,0 +1,106 @@
+package geerpc
+
+import (
+	"fmt"
+	"geerpc/codec"
+	"strings"
+)
+
+/**
+ * 响应校验
+ *
+ * 服务方法的缺陷可能产生巨大的或者不合法的响应，直接发送会占满连接、让客户端解码失败甚至内存耗尽。
+ * 服务方法返回后、发送之前检查响应，不通过时改为回复 InternalError：
+ *   server := geerpc.NewServer(
+ *       geerpc.WithMaxReplySize(4<<20),
+ *       geerpc.WithReplyValidator(func(serviceMethod string, reply interface{}) error { ... }),
+ *   )
+ * 1.响应的类型实现了 ReplyValidator 时调用它的 ValidateReply
+ * 2.SetReplyValidator 设置的函数对所有方法生效
+ * 3.设置了最大响应大小时，按连接的编解码方式编码一次计算大小，超过时不发送；
+ *   这需要多编码一次，只在需要防护时开启；不认识的编解码方式不检查
+ * 失败的原因只记录在服务端的日志中，客户端收到的 InternalError 不包含响应的内容
+ */
+
+// 响应的类型实现这个接口时，发送之前调用 ValidateReply
+type ReplyValidator interface {
+	ValidateReply() error
+}
+
+// 对所有方法生效的响应校验函数，reply 为服务方法写好的响应
+type ReplyValidatorFunc func(serviceMethod string, reply interface{}) error
+
+const internalPrefix = "rpc server: internal error: "
+
+// 服务端内部错误：服务方法已经执行，但结果不能发送给调用方
+type InternalError struct {
+	Msg string
+}
+
+func (e *InternalError) Error() string {
+	return internalPrefix + e.Msg
+}
+
+func parseInternal(msg string) (error, bool) {
+	if !strings.HasPrefix(msg, internalPrefix) {
+		return nil, false
+	}
+	return &InternalError{Msg: strings.TrimPrefix(msg, internalPrefix)}, true
+}
+
+// 同 SetMaxReplySize
+func WithMaxReplySize(n int) ServerOption {
+	return func(server *Server) {
+		server.SetMaxReplySize(n)
+	}
+}
+
+// 设置编码后的响应的最大字节数，0表示不限制，需要在 Accept 之前调用
+func (server *Server) SetMaxReplySize(n int) {
+	server.maxReplySize = n
+}
+
+// 同 SetReplyValidator
+func WithReplyValidator(fn ReplyValidatorFunc) ServerOption {
+	return func(server *Server) {
+		server.SetReplyValidator(fn)
+	}
+}
+
+// 设置对所有方法生效的响应校验函数，在响应自己的 ValidateReply 之后调用，需要在 Accept 之前调用
+func (server *Server) SetReplyValidator(fn ReplyValidatorFunc) {
+	server.replyValidator = fn
+}
+
+// 检查服务方法写好的响应，ct 为连接的编解码方式
+func (server *Server) checkReply(req *request, ct codec.Type) error {
+	reply := req.replyv.Interface()
+	var err error
+	if v, ok := reply.(ReplyValidator); ok {
+		err = v.ValidateReply()
+	}
+	if err == nil && server.replyValidator != nil {
+		err = server.replyValidator(req.h.ServiceMethod, reply)
+	}
+	if err != nil {
+		server.logf("rpc server: %s returned an invalid reply: %v (request %s)", req.h.ServiceMethod, err, req.h.Meta[RequestIDMeta])
+		return &InternalError{Msg: "invalid reply"}
+	}
+	if server.maxReplySize <= 0 {
+		return nil
+	}
+	_, body := taggedBody(reply)
+	size, ok, err := codec.EncodedSize(ct, body)
+	if !ok {
+		return nil
+	}
+	if err != nil {
+		server.logf("rpc server: %s returned a reply that can't be encoded: %v (request %s)", req.h.ServiceMethod, err, req.h.Meta[RequestIDMeta])
+		return &InternalError{Msg: "reply can't be encoded"}
+	}
+	if size > server.maxReplySize {
+		server.logf("rpc server: %s returned a reply of %d bytes, limit is %d (request %s)", req.h.ServiceMethod, size, server.maxReplySize, req.h.Meta[RequestIDMeta])
+		return &InternalError{Msg: fmt.Sprintf("reply too large (%d bytes, limit %d)", size, server.maxReplySize)}
+	}
+	return nil
+}
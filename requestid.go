@@ -0,0 +1,64 @@
+package geerpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"geerpc/codec"
+)
+
+/**
+ * 请求 ID
+ *
+ * 每次调用都带有一个唯一的请求 ID，放在元数据 RequestIDMeta 中，用于在日志中关联一次调用经过的所有服务：
+ * 1.调用方可以通过 WithRequestID 指定，没有指定时客户端随机生成，记录在 Call.RequestID 中
+ * 2.服务方法通过 RequestIDFromContext 读取，服务端的日志都带有请求 ID
+ * 3.服务方法用自己的 ctx 调用其他服务（CallContext）时沿用同一个请求 ID
+ * 4.响应头的元数据中带有同样的请求 ID，包括错误响应；其他语言的客户端没有设置时由服务端生成
+ */
+
+const RequestIDMeta = "request-id"
+
+// 指定这次调用的请求 ID，覆盖从 ctx 继承的请求 ID
+func WithRequestID(id string) CallOption {
+	return WithMetadata(RequestIDMeta, id)
+}
+
+// 服务方法读取当前请求的 ID
+func RequestIDFromContext(ctx context.Context) string {
+	return MetadataFromContext(ctx)[RequestIDMeta]
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 客户端发送前确定请求 ID 并放入元数据
+func (call *Call) ensureRequestID() {
+	if id := call.meta[RequestIDMeta]; id != "" {
+		call.RequestID = id
+		return
+	}
+	if call.RequestID == "" {
+		call.RequestID = newRequestID()
+	}
+	if call.meta == nil {
+		call.meta = make(map[string]string, 1)
+	}
+	call.meta[RequestIDMeta] = call.RequestID
+}
+
+// 服务端收到的请求没有请求 ID 时生成一个，返回请求 ID
+func ensureRequestID(h *codec.Header) string {
+	if id := h.Meta[RequestIDMeta]; id != "" {
+		return id
+	}
+	if h.Meta == nil {
+		h.Meta = make(map[string]string, 1)
+	}
+	id := newRequestID()
+	h.Meta[RequestIDMeta] = id
+	return id
+}
@@ -0,0 +1,85 @@
+package rpcdebug
+
+import (
+	"expvar"
+	"geerpc"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+)
+
+/**
+ * 在调试页面旁边挂载 expvar 和 pprof
+ *
+ * 服务器出现异常（goroutine 泄漏、内存上涨）时，不需要重新部署就能取到 profile：
+ *   mux := http.NewServeMux()
+ *   rpcdebug.Mount(mux, server, rpcdebug.Options{Expvar: true, Pprof: true})
+ *   go http.ListenAndServe("127.0.0.1:6060", mux)
+ * 挂载的路径：
+ *   /debug/geerpc    调试页面，见 geerpc.DebugHandler
+ *   /debug/vars      expvar，其中 geerpc 一项为服务器和每个方法的统计
+ *   /debug/pprof/    pprof，如 go tool pprof http://127.0.0.1:6060/debug/pprof/heap
+ * 注意：标准库的 expvar 和 net/http/pprof 在导入时就会注册到 http.DefaultServeMux，
+ * 导入本包后 DefaultServeMux 上总是有这些路径，对外监听的端口应使用单独的 ServeMux，
+ * 调试端口只监听内网地址
+ */
+
+type Options struct {
+	Prefix     string //调试页面的路径，为空时使用 geerpc.DefaultDebugPath
+	Expvar     bool   //挂载 /debug/vars 并发布服务器的统计
+	ExpvarName string //发布到 expvar 的名字，为空时使用 "geerpc"，同名的变量已经存在时不再发布
+	Pprof      bool   //挂载 /debug/pprof/
+}
+
+// 在 mux 上挂载调试页面，以及按 opt 挂载 expvar 和 pprof，mux 为nil时使用 http.DefaultServeMux
+func Mount(mux *http.ServeMux, server *geerpc.Server, opt Options) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	prefix := opt.Prefix
+	if prefix == "" {
+		prefix = geerpc.DefaultDebugPath
+	}
+	mux.Handle(prefix, server.DebugHandler())
+	//DefaultServeMux 上已经由标准库注册过，重复注册会 panic
+	if opt.Expvar {
+		Publish(server, opt.ExpvarName)
+		if mux != http.DefaultServeMux {
+			mux.Handle("/debug/vars", expvar.Handler())
+		}
+	}
+	if opt.Pprof && mux != http.DefaultServeMux {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+}
+
+var publishMu sync.Mutex //expvar.Publish 遇到同名变量会 panic，检查和发布需要一起完成
+
+// 把服务器的统计发布到 expvar，name 为空时使用 "geerpc"，同名的变量已经存在时什么都不做
+func Publish(server *geerpc.Server, name string) {
+	if name == "" {
+		name = "geerpc"
+	}
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	if expvar.Get(name) != nil {
+		return
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		methods := make(map[string]geerpc.MethodStats)
+		for _, m := range server.Methods() {
+			sm := m.Service + "." + m.Method
+			if st, err := server.MethodStats(sm); err == nil {
+				methods[sm] = st
+			}
+		}
+		return struct {
+			Server  geerpc.ServerStats
+			Methods map[string]geerpc.MethodStats
+		}{server.Stats(), methods}
+	}))
+}
@@ -0,0 +1,171 @@
+package rpctest
+
+import (
+	"geerpc"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * 假时钟
+ *
+ * 实现 geerpc.Clock，时间只在调用 Advance 时前进，超时、退避和心跳的测试不需要真的等待：
+ *   clock := rpctest.NewFakeClock(time.Now())
+ *   rc, _ := geerpc.DialReconnect("tcp", addr, nil, geerpc.WithClock(clock))
+ *   ...                             //断开连接，发起调用
+ *   clock.BlockUntil(2)             //等重连的退避定时器和调用的等待定时器都创建好
+ *   clock.Advance(5 * time.Second)  //等待超时，调用返回 ErrReconnectTimeout
+ * Advance 按到期时间依次触发定时器，AfterFunc 的函数在 Advance 中同步调用；
+ * 被测代码在其他 goroutine 中创建定时器时，先用 BlockUntil 等定时器创建好再推进时间
+ */
+
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond //定时器增加时广播，用于 BlockUntil
+	now     time.Time
+	seq     uint64       //创建顺序，到期时间相同的定时器按创建顺序触发
+	waiters []*fakeTimer //还没有触发或停止的定时器
+}
+
+var _ geerpc.Clock = (*FakeClock)(nil)
+
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) geerpc.Timer {
+	return c.add(d, 0, make(chan time.Time, 1), nil)
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) geerpc.Timer {
+	return c.add(d, 0, nil, f)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) geerpc.Ticker {
+	if d <= 0 {
+		panic("rpctest: non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.add(d, d, make(chan time.Time, 1), nil)}
+}
+
+func (c *FakeClock) add(d, period time.Duration, ch chan time.Time, f func()) *fakeTimer {
+	c.mu.Lock()
+	c.seq++
+	t := &fakeTimer{clock: c, when: c.now.Add(d), seq: c.seq, period: period, c: ch, f: f}
+	c.waiters = append(c.waiters, t)
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	//与真实的定时器一样，d 不大于0时立即触发
+	if d <= 0 {
+		c.Advance(0)
+	}
+	return t
+}
+
+// 推进时间，依次触发到期的定时器
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		t := c.next(end)
+		if t == nil {
+			break
+		}
+		c.now = t.when
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.remove(t)
+		}
+		if t.f != nil {
+			c.mu.Unlock()
+			t.f()
+			c.mu.Lock()
+			continue
+		}
+		//与真实的定时器一样，接收方没有取走上一次的时间时丢弃这一次
+		select {
+		case t.c <- c.now:
+		default:
+		}
+	}
+	if end.After(c.now) {
+		c.now = end
+	}
+	c.mu.Unlock()
+}
+
+// 到期时间不晚于 end 的最早的定时器
+func (c *FakeClock) next(end time.Time) *fakeTimer {
+	if len(c.waiters) == 0 {
+		return nil
+	}
+	sort.Slice(c.waiters, func(i, j int) bool {
+		a, b := c.waiters[i], c.waiters[j]
+		if !a.when.Equal(b.when) {
+			return a.when.Before(b.when)
+		}
+		return a.seq < b.seq
+	})
+	if t := c.waiters[0]; !t.when.After(end) {
+		return t
+	}
+	return nil
+}
+
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// 还没有触发或停止的定时器数
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// 等到至少有 n 个还没有触发或停止的定时器
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	when   time.Time
+	seq    uint64
+	period time.Duration //大于0时为 Ticker
+	c      chan time.Time
+	f      func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.c }
+func (t fakeTicker) Stop()               { t.t.Stop() }
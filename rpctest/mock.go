@@ -0,0 +1,253 @@
+package rpctest
+
+import (
+	"errors"
+	"fmt"
+	"geerpc"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/**
+ * 客户端测试替身
+ *
+ * MockClient 与 geerpc.Client 有相同的调用接口（Go/Call/Close/IsAvailable），
+ * 可以按 ServiceMethod 预设响应或错误，记录调用参数，模拟超时（迟迟不响应）和连接断开，不需要真实的服务端
+ */
+
+// geerpc.Client 和 MockClient 共同的调用接口，业务代码依赖它即可在测试中替换
+type Caller interface {
+	Go(serviceMethod string, args, reply interface{}, done chan *geerpc.Call, opts ...geerpc.CallOption) *geerpc.Call
+	Call(serviceMethod string, args, reply interface{}, opts ...geerpc.CallOption) error
+	Close() error
+	IsAvailable() bool
+}
+
+var (
+	_ Caller = (*geerpc.Client)(nil)
+	_ Caller = (*MockClient)(nil)
+)
+
+// 没有预设响应的方法被调用时返回的错误
+var ErrNoStub = errors.New("rpctest: no stub for method")
+
+// 一个方法的预设行为
+type Stub struct {
+	reply interface{}                         //预设的响应，复制到调用方的 reply 中
+	err   error                               //预设的错误
+	fn    func(args, reply interface{}) error //自定义处理函数，优先于 reply/err
+	delay time.Duration                       //响应前等待的时间
+	hang  bool                                //不响应，直到连接断开
+}
+
+// 设置响应，reply 可以是值也可以是指针
+func (s *Stub) Return(reply interface{}) *Stub {
+	s.reply, s.err = reply, nil
+	return s
+}
+
+// 设置返回的错误
+func (s *Stub) ReturnError(err error) *Stub {
+	s.err = err
+	return s
+}
+
+// 自定义处理函数，可以根据参数填充 reply
+func (s *Stub) Do(fn func(args, reply interface{}) error) *Stub {
+	s.fn = fn
+	return s
+}
+
+// 延迟 d 后再响应
+func (s *Stub) Delay(d time.Duration) *Stub {
+	s.delay = d
+	return s
+}
+
+// 一直不响应，用于模拟超时，直到调用 Drop 或 Close
+func (s *Stub) Hang() *Stub {
+	s.hang = true
+	return s
+}
+
+// 一次调用的记录
+type Record struct {
+	ServiceMethod string
+	Args          interface{}
+	Time          time.Time
+}
+
+type MockClient struct {
+	mu      sync.Mutex
+	stubs   map[string]*Stub
+	calls   []Record
+	closed  bool
+	dropErr error         //连接断开时返回给调用方的错误
+	dropped chan struct{} //关闭后唤醒所有 Hang 的调用
+}
+
+func NewMockClient() *MockClient {
+	return &MockClient{
+		stubs:   make(map[string]*Stub),
+		dropped: make(chan struct{}),
+	}
+}
+
+// 为 serviceMethod 设置预设行为，重复调用会覆盖之前的设置
+func (m *MockClient) On(serviceMethod string) *Stub {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &Stub{}
+	m.stubs[serviceMethod] = s
+	return s
+}
+
+// 模拟连接断开：正在等待的和之后的调用都返回 err（为空时为 geerpc.ErrShutdown）
+func (m *MockClient) Drop(err error) {
+	if err == nil {
+		err = geerpc.ErrShutdown
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	m.dropErr = err
+	close(m.dropped)
+}
+
+func (m *MockClient) Close() error {
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return geerpc.ErrShutdown
+	}
+	m.Drop(geerpc.ErrShutdown)
+	return nil
+}
+
+func (m *MockClient) IsAvailable() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.closed
+}
+
+// 所有调用记录，按调用顺序
+func (m *MockClient) Calls() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record(nil), m.calls...)
+}
+
+// serviceMethod 每次被调用时的参数
+func (m *MockClient) ArgsOf(serviceMethod string) []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var args []interface{}
+	for _, r := range m.calls {
+		if r.ServiceMethod == serviceMethod {
+			args = append(args, r.Args)
+		}
+	}
+	return args
+}
+
+// 断言 serviceMethod 第 i 次调用的参数等于 want，不相等时返回描述差异的错误
+func (m *MockClient) AssertArgs(serviceMethod string, i int, want interface{}) error {
+	args := m.ArgsOf(serviceMethod)
+	if i >= len(args) {
+		return fmt.Errorf("rpctest: %s called %d times, want call #%d", serviceMethod, len(args), i)
+	}
+	if !reflect.DeepEqual(args[i], want) {
+		return fmt.Errorf("rpctest: %s call #%d args = %#v, want %#v", serviceMethod, i, args[i], want)
+	}
+	return nil
+}
+
+func (m *MockClient) Go(serviceMethod string, args, reply interface{}, done chan *geerpc.Call, opts ...geerpc.CallOption) *geerpc.Call {
+	if done == nil {
+		done = make(chan *geerpc.Call, 10)
+	}
+	call := &geerpc.Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          done,
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		call.Error = m.dropErr
+		m.mu.Unlock()
+		done <- call
+		return call
+	}
+	m.calls = append(m.calls, Record{ServiceMethod: serviceMethod, Args: args, Time: time.Now()})
+	call.Seq = uint64(len(m.calls))
+	stub := m.stubs[serviceMethod]
+	m.mu.Unlock()
+
+	go m.respond(call, stub)
+	return call
+}
+
+func (m *MockClient) Call(serviceMethod string, args, reply interface{}, opts ...geerpc.CallOption) error {
+	call := <-m.Go(serviceMethod, args, reply, make(chan *geerpc.Call, 1), opts...).Done
+	return call.Error
+}
+
+// 按预设行为完成调用
+func (m *MockClient) respond(call *geerpc.Call, stub *Stub) {
+	defer func() { call.Done <- call }()
+	if stub == nil {
+		call.Error = fmt.Errorf("%w: %s", ErrNoStub, call.ServiceMethod)
+		return
+	}
+	if stub.hang {
+		<-m.dropped
+		call.Error = m.dropError()
+		return
+	}
+	if stub.delay > 0 {
+		select {
+		case <-time.After(stub.delay):
+		case <-m.dropped:
+			call.Error = m.dropError()
+			return
+		}
+	}
+	switch {
+	case stub.fn != nil:
+		call.Error = stub.fn(call.Args, call.Reply)
+	case stub.err != nil:
+		call.Error = stub.err
+	case stub.reply != nil:
+		call.Error = setReply(call.Reply, stub.reply)
+	}
+}
+
+func (m *MockClient) dropError() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dropErr
+}
+
+// 把预设的响应复制到调用方传入的 reply 指针中
+func setReply(reply, stub interface{}) error {
+	dst := reflect.ValueOf(reply)
+	if dst.Kind() != reflect.Ptr || dst.IsNil() {
+		return errors.New("rpctest: reply must be a non-nil pointer")
+	}
+	src := reflect.ValueOf(stub)
+	if src.Type() != dst.Elem().Type() && src.Kind() == reflect.Ptr {
+		src = src.Elem()
+	}
+	if !src.Type().AssignableTo(dst.Elem().Type()) {
+		return fmt.Errorf("rpctest: stub reply of type %s is not assignable to %s", src.Type(), dst.Elem().Type())
+	}
+	dst.Elem().Set(src)
+	return nil
+}
@@ -0,0 +1,283 @@
+package rpctest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"geerpc"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/**
+ * 流量录制与回放
+ *
+ * Recorder 包装一个 Caller，把每次调用的请求、响应、错误和耗时以 JSON Lines 写入 io.Writer
+ * Replayer 读取录制的内容，按 ServiceMethod 和参数匹配录制项并返回录制时的响应，不需要真实的服务端，
+ * 用于确定性的集成测试，以及离线排查线上抓取的流量
+ * 参数不同的调用默认返回 ErrNoRecording，SetLooseMatch(true) 后才使用同一方法最早的未使用项
+ * 被测的是客户端（或其他语言的客户端）时，可以用录制内容启动一个回放服务端：
+ *   recs, _ := rpctest.LoadRecordings(f)
+ *   server, _ := rpctest.NewReplayServer(rpctest.NewReplayer(recs, false), &Foo{})
+ *   go server.Accept(l)
+ * 注册的服务只用于得到参数和响应的类型，服务方法不会被调用
+ */
+
+// 一条录制记录，参数和响应以 JSON 保存
+type Recording struct {
+	ServiceMethod string          `json:"service_method"`
+	Args          json.RawMessage `json:"args"`
+	Reply         json.RawMessage `json:"reply,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Start         time.Time       `json:"start"`
+	Duration      time.Duration   `json:"duration"`
+}
+
+type Recorder struct {
+	inner Caller
+	mu    sync.Mutex //保证一条记录完整写入
+	enc   *json.Encoder
+}
+
+var _ Caller = (*Recorder)(nil)
+
+// 录制 inner 上的所有调用，写入 w
+func NewRecorder(inner Caller, w io.Writer) *Recorder {
+	return &Recorder{inner: inner, enc: json.NewEncoder(w)}
+}
+
+func (r *Recorder) Go(serviceMethod string, args, reply interface{}, done chan *geerpc.Call, opts ...geerpc.CallOption) *geerpc.Call {
+	if done == nil {
+		done = make(chan *geerpc.Call, 10)
+	}
+	call := &geerpc.Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          done,
+	}
+	start := time.Now()
+	//内部调用完成后先记录，再通知调用方
+	inner := r.inner.Go(serviceMethod, args, reply, make(chan *geerpc.Call, 1), opts...)
+	go func() {
+		c := <-inner.Done
+		call.Seq, call.Error = c.Seq, c.Error
+		r.record(call, start, time.Since(start))
+		done <- call
+	}()
+	return call
+}
+
+func (r *Recorder) Call(serviceMethod string, args, reply interface{}, opts ...geerpc.CallOption) error {
+	call := <-r.Go(serviceMethod, args, reply, make(chan *geerpc.Call, 1), opts...).Done
+	return call.Error
+}
+
+func (r *Recorder) Close() error {
+	return r.inner.Close()
+}
+
+func (r *Recorder) IsAvailable() bool {
+	return r.inner.IsAvailable()
+}
+
+func (r *Recorder) record(call *geerpc.Call, start time.Time, d time.Duration) {
+	rec := Recording{
+		ServiceMethod: call.ServiceMethod,
+		Start:         start,
+		Duration:      d,
+	}
+	rec.Args, _ = json.Marshal(call.Args)
+	if call.Error != nil {
+		rec.Error = call.Error.Error()
+	} else {
+		rec.Reply, _ = json.Marshal(call.Reply)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(&rec)
+}
+
+// 读取录制文件
+func LoadRecordings(rd io.Reader) ([]Recording, error) {
+	var recs []Recording
+	sc := bufio.NewScanner(rd)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec Recording
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("rpctest: bad recording line %d: %w", len(recs)+1, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, sc.Err()
+}
+
+// 回放时找不到匹配的录制项
+var ErrNoRecording = errors.New("rpctest: no recording matches call")
+
+type Replayer struct {
+	mu        sync.Mutex
+	recs      []Recording
+	used      []bool
+	withDelay bool //是否按录制的耗时延迟响应
+	loose     bool //参数不匹配时是否使用同一方法的其他录制项
+	closed    bool
+}
+
+var _ Caller = (*Replayer)(nil)
+
+// 根据录制内容创建回放客户端，withDelay 为 true 时按录制时的耗时延迟返回
+func NewReplayer(recs []Recording, withDelay bool) *Replayer {
+	return &Replayer{recs: recs, used: make([]bool, len(recs)), withDelay: withDelay}
+}
+
+// 参数不匹配时使用同一方法最早的未使用项，默认关闭，参数不同的调用返回 ErrNoRecording
+func (p *Replayer) SetLooseMatch(loose bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loose = loose
+}
+
+/**
+ * 查找录制项：找 ServiceMethod 和参数都相同且未使用过的，同一方法的多次调用按录制顺序回放
+ * 开启 SetLooseMatch 时，找不到再使用同一方法最早的未使用项
+ */
+func (p *Replayer) match(serviceMethod string, args json.RawMessage) (*Recording, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, geerpc.ErrShutdown
+	}
+	fallback := -1
+	for i := range p.recs {
+		if p.used[i] || p.recs[i].ServiceMethod != serviceMethod {
+			continue
+		}
+		if jsonEqual(p.recs[i].Args, args) {
+			p.used[i] = true
+			return &p.recs[i], nil
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+	}
+	if fallback < 0 || !p.loose {
+		return nil, fmt.Errorf("%w: %s", ErrNoRecording, serviceMethod)
+	}
+	p.used[fallback] = true
+	return &p.recs[fallback], nil
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func (p *Replayer) Go(serviceMethod string, args, reply interface{}, done chan *geerpc.Call, opts ...geerpc.CallOption) *geerpc.Call {
+	if done == nil {
+		done = make(chan *geerpc.Call, 10)
+	}
+	call := &geerpc.Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          done,
+	}
+	go func() {
+		call.Error = p.replay(context.Background(), serviceMethod, args, reply)
+		done <- call
+	}()
+	return call
+}
+
+// 按录制项填充 reply，返回录制的错误
+func (p *Replayer) replay(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	rec, err := p.match(serviceMethod, argsJSON)
+	if err != nil {
+		return err
+	}
+	if p.withDelay {
+		t := time.NewTimer(rec.Duration)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if rec.Error != "" {
+		return errors.New(rec.Error)
+	}
+	if len(rec.Reply) > 0 {
+		return json.Unmarshal(rec.Reply, reply)
+	}
+	return nil
+}
+
+func (p *Replayer) Call(serviceMethod string, args, reply interface{}, opts ...geerpc.CallOption) error {
+	call := <-p.Go(serviceMethod, args, reply, make(chan *geerpc.Call, 1), opts...).Done
+	return call.Error
+}
+
+func (p *Replayer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return geerpc.ErrShutdown
+	}
+	p.closed = true
+	return nil
+}
+
+func (p *Replayer) IsAvailable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.closed
+}
+
+// 服务端拦截器，用录制项响应调用，不调用服务方法
+func (p *Replayer) Interceptor() geerpc.Interceptor {
+	return func(ctx context.Context, serviceMethod string, args, reply interface{}, _ geerpc.HandlerFunc) error {
+		return p.replay(ctx, serviceMethod, args, reply)
+	}
+}
+
+// 创建回放服务端，rcvrs 为录制时的服务，只用于注册方法和参数类型，可以是零值
+func NewReplayServer(p *Replayer, rcvrs ...interface{}) (*geerpc.Server, error) {
+	server := geerpc.NewServer()
+	for _, rcvr := range rcvrs {
+		if err := server.Register(rcvr); err != nil {
+			return nil, err
+		}
+	}
+	server.Use(p.Interceptor())
+	return server, nil
+}
+
+// 尚未被回放的录制项，用于断言测试覆盖了所有录制的调用
+func (p *Replayer) Remaining() []Recording {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var rest []Recording
+	for i, rec := range p.recs {
+		if !p.used[i] {
+			rest = append(rest, rec)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,49 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ * 服务端合并写出响应
+ *
+ * 同一个连接上的响应和回调请求由 sendLock 保证逐个完整写出。还有其他响应在等待加锁时，
+ * 编解码器实现了 codec.Corker 就先 Cork，这个响应只编码到缓冲区，等待的最后一个响应写完后 Uncork，
+ * 并发完成的多个小响应合并为一次系统调用，尽量在同一个 TCP 包中发出
+ * 没有等待的响应时与原来一样，每个响应写完立即写出，不会增加延迟
+ */
+
+type sendLock struct {
+	mu      sync.Mutex
+	cc      codec.Codec
+	waiting int32 //等待加锁的发送数，原子操作
+	corked  bool  //已经 Cork，由 mu 保护
+}
+
+func newSendLock(cc codec.Codec) *sendLock {
+	return &sendLock{cc: cc}
+}
+
+// 加锁，后面还有发送在等待时 Cork
+func (l *sendLock) Lock() {
+	atomic.AddInt32(&l.waiting, 1)
+	l.mu.Lock()
+	atomic.AddInt32(&l.waiting, -1)
+	if !l.corked && atomic.LoadInt32(&l.waiting) > 0 {
+		if ck, ok := l.cc.(codec.Corker); ok {
+			ck.Cork()
+			l.corked = true
+		}
+	}
+}
+
+// 解锁，没有发送在等待时 Uncork，写出之前缓冲的响应；写连接的错误由之后的 Write 和读取发现
+func (l *sendLock) Unlock() {
+	if l.corked && atomic.LoadInt32(&l.waiting) == 0 {
+		l.corked = false
+		_ = l.cc.(codec.Corker).Uncork()
+	}
+	l.mu.Unlock()
+}
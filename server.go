@@ -1,14 +1,21 @@
 package geerpc
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"geerpc/codec"
 	"io"
 	"log"
 	"net"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /**
@@ -25,8 +32,85 @@ import (
 const MagicNumber = 0x34252 //魔数标识rpc请求
 
 type Option struct {
-	MagicNumber int        //这个值标识为rpc请求
-	CodecType   codec.Type //客户端会选择不同的Codec去编码body
+	MagicNumber       int                  //这个值标识为rpc请求
+	CodecType         codec.Type           //客户端会选择不同的Codec去编码body
+	Version           string               //客户端固定的服务版本，放在每个请求头中，为空表示不指定
+	ClientID          string               //客户端标识，为空时使用 DefaultClientID
+	SessionID         string               //会话标识，为空时每个 Client 随机生成
+	Flags             uint32               //连接的可选功能，见 FlagChecksum 等
+	CompressThreshold int                  //按消息压缩时只压缩不小于这个字节数的消息，0表示默认的 1KB
+	ChunkSize         int                  //分块传输时每块的最大字节数，0表示默认的 64KB，双方都按这个大小发送
+	MaxBodySize       int                  `json:"-"` //分块传输时接收的消息的最大字节数，0表示默认的 64MB，由各自设置
+	ReadBufferSize    int                  `json:"-"` //编解码器读缓冲区的字节数，0表示默认的 4KB，由各自设置，见 codec/buffer.go
+	WriteBufferSize   int                  `json:"-"` //编解码器写缓冲区的字节数，0表示默认的 4KB，由各自设置
+	Codecs            *codec.Registry      `json:"-"` //客户端自己的编解码器注册表，为nil时只使用默认注册表
+	DoneBuffer        int                  `json:"-"` //Go 没有传入 done 通道时创建的通道容量，0表示默认的10
+	DonePolicy        DonePolicy           `json:"-"` //done 通道满时的处理策略
+	MaxPending        int                  `json:"-"` //等待响应的调用数上限，达到后 Go/Call 立即返回 ErrTooManyPending，0表示不限制
+	BatchDelay        time.Duration        `json:"-"` //客户端写合并的最长等待时间，0表示不合并，见 batch.go
+	BatchSize         int                  `json:"-"` //缓冲达到这个字节数时立即写出，0表示默认的 64KB
+	ConnectTimeout    time.Duration        `json:"-"` //Dial 建立连接和握手的超时时间，0表示不限制
+	TLSConfig         *tls.Config          `json:"-"` //不为nil时 Dial 建立 TLS 连接
+	TCP               *TCPOption           `json:"-"` //TCP 连接的参数，为nil时使用 Go 的默认值，见 tcp.go
+	DialStagger       time.Duration        `json:"-"` //主机名解析出多个地址时并行建立连接的间隔，0表示默认的 250ms，小于0表示逐个尝试
+	Dialer            DialerFunc           `json:"-"` //建立连接的函数，为nil时直接连接，见 dialproxy.go
+	Callbacks         *Server              `json:"-"` //客户端提供给服务端回调的服务，为nil时回调返回错误
+	OnConnect         func(net.Conn) error `json:"-"` //客户端建立连接后、发送 Option 之前调用，见 connhook.go
+	OnDisconnect      func(error)          `json:"-"` //客户端连接出错或关闭后调用
+	OnStateChange     func(StateChange)    `json:"-"` //客户端状态变化时按顺序调用，从 Dial 开始，见 client_state.go
+	Clock             Clock                `json:"-"` //调用超时等计时的时间源，为nil时使用 RealClock，见 clock.go
+}
+
+// Option.Flags 的取值，客户端设置，服务端按照同样的方式处理这个连接
+const (
+	FlagChecksum        uint32 = 1 << iota //每个消息带 CRC32 校验和，校验失败只影响一个请求
+	FlagCompressStream                     //整个连接 gzip 压缩，适合大量相似的小消息
+	FlagCompressMessage                    //按消息 gzip 压缩，小于 CompressThreshold 的消息不压缩
+	FlagCallbacks                          //客户端接受服务端的回调，见 callback.go，geerpc 客户端总是设置
+	FlagChunked                            //大消息分块传输，多个消息的块交替发送，见 codec/chunk.go
+)
+
+// 根据 Option 找到编解码器的构造函数
+func codecFunc(r *codec.Registry, opt *Option) (codec.NewCodecFunc, error) {
+	if opt.Flags&FlagCompressStream != 0 && opt.Flags&FlagCompressMessage != 0 {
+		return nil, errors.New("stream and per-message compression can't be used together")
+	}
+	var f codec.NewCodecFunc
+	var err error
+	switch {
+	case opt.Flags&FlagChecksum != 0 && opt.Flags&FlagCompressMessage != 0:
+		return nil, errors.New("checksum and per-message compression can't be used together")
+	case opt.Flags&FlagChunked != 0 && opt.Flags&(FlagChecksum|FlagCompressMessage) != 0:
+		return nil, errors.New("chunking can't be used together with checksum or per-message compression")
+	case opt.Flags&FlagChunked != 0:
+		f, err = codec.NewChunkedCodecFunc(opt.CodecType, codec.ChunkOptions{ChunkSize: opt.ChunkSize, MaxBodySize: opt.MaxBodySize})
+	case opt.Flags&FlagChecksum != 0:
+		f, err = codec.NewChecksumCodecFunc(opt.CodecType)
+	case opt.Flags&FlagCompressMessage != 0:
+		f, err = codec.NewCompressedCodecFunc(opt.CodecType, opt.CompressThreshold)
+	default:
+		if f = codec.Lookup(r, opt.CodecType); f == nil {
+			err = fmt.Errorf("invalid codec type %s", opt.CodecType)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opt.ReadBufferSize > 0 || opt.WriteBufferSize > 0 {
+		bufs := codec.BufferOptions{ReadSize: opt.ReadBufferSize, WriteSize: opt.WriteBufferSize}
+		inner := f
+		f = func(conn io.ReadWriteCloser) codec.Codec {
+			return inner(codec.WithBufferSizes(conn, bufs))
+		}
+	}
+	if opt.Flags&FlagCompressStream != 0 {
+		//先包装连接，编解码器读写的都是解压后的数据
+		inner := f
+		f = func(conn io.ReadWriteCloser) codec.Codec {
+			return inner(codec.NewGzipConn(conn))
+		}
+	}
+	return f, nil
 }
 
 /**
@@ -48,11 +132,76 @@ var DefaultOption = &Option{
 
 // 一个RPC服务器结构体
 type Server struct {
+	serviceMap     sync.Map   //服务名 -> *service
+	registerMu     sync.Mutex //串行化注册和替换，重复检查、OnRegister 和写入 serviceMap 之间不会插入其他注册
+	aliases        sync.Map   //ServiceMethod 别名 -> 实际的 ServiceMethod
+	plugins        pluginContainer
+	sched          atomic.Pointer[scheduler]        //优先级调度，为nil时每个请求一个 goroutine
+	shed           *loadShedder                     //过载保护，为nil时不开启
+	dedup          *dedupCache                      //请求去重，为nil时不开启
+	clientLimit    *clientLimiter                   //按客户端限流，为nil时不限制
+	codecs         *codec.Registry                  //服务器自己的编解码器注册表，为nil时只使用默认注册表
+	pubsub         *pubSub                          //发布/订阅，为nil时不开启
+	validator      ValidatorFunc                    //对所有请求生效的参数校验，为nil时只使用参数自己的 Validate
+	chaos          atomic.Pointer[chaos]            //故障注入，为nil时不开启
+	otlp           atomic.Pointer[otlpExporter]     //OTLP 指标推送，为nil时不开启
+	ipFilter       atomic.Pointer[IPFilter]         //来源 IP 过滤，为nil时不过滤
+	hsLimit        atomic.Pointer[handshakeLimiter] //握手限制，为nil时不限制
+	reservedMeta   *reservedMeta                    //客户端设置的保留元数据键的处理方式，为nil时接受
+	graceful       *GracefulOption                  //收到信号后的关闭方式，见 ListenAndServeWithSignals
+	tenancy        atomic.Pointer[TenantOption]     //多租户路由，为nil时不开启
+	replyValidator ReplyValidatorFunc               //对所有方法生效的响应校验，为nil时只使用响应自己的 ValidateReply
+	maxReplySize   int                              //编码后的响应的最大字节数，0表示不限制
+	clock          Clock                            //超时计时的时间源，为nil时使用 RealClock
+	tcpOption      atomic.Pointer[TCPOption]        //接受的连接的 TCP 参数，为nil时使用 Go 的默认值
+	//方法没有设置超时时间时使用的处理超时时间，0表示不限制
+	handleTimeout time.Duration
+	logger        *log.Logger         //为nil时使用 log 包的默认输出
+	maxBodySize   int                 //分块传输时接收的消息的最大字节数，0表示默认值
+	bufferSizes   codec.BufferOptions //编解码器读写缓冲区的字节数，0表示默认值
+	interceptors  []Interceptor       //全局拦截器，见 Use
+	//连接事件，见 connhook.go
+	onConnect    func(conn io.ReadWriteCloser) (context.Context, bool)
+	onDisconnect func(conn io.ReadWriteCloser, err error)
+	//统计
+	started        time.Time //服务器创建的时间，累计的统计从这时开始
+	conns          sync.Map  //连接 ID -> *connState
+	nextConnID     uint64
+	requests       uint64
+	errors         uint64
+	closedSent     uint64 //已关闭连接的发送字节数
+	closedReceived uint64 //已关闭连接的接收字节数
+	slowCalls      uint64 //慢调用次数
+	rejectedConns  uint64 //被来源 IP 过滤、握手限制拒绝的连接数
+	hsTimeouts     uint64 //握手超时的连接数
+	//管理
+	draining int32 //为1时拒绝新连接和新请求
+	debug    int32 //为1时记录每个请求
+	drain    int64 //连接关闭时等待请求的时间，见 SetDrainTimeout
+	//慢调用阈值，见 SetSlowThreshold
+	slowThreshold int64
+	//监听器
+	lmu       sync.Mutex
+	listeners map[net.Listener]struct{} //正在 Accept 的监听器
+	closed    int32                     //为1时服务器已经关闭
+	added     []listenerEntry           //AddListener 添加的监听器
+	serving   bool                      //Serve 正在运行
+	serveWg   sync.WaitGroup
+	serveErr  error //第一个出现永久错误的监听器的错误
+}
+
+// 创建RPC服务器，选项见 options.go
+func NewServer(opts ...ServerOption) *Server {
+	server := &Server{started: time.Now()}
+	for _, opt := range opts {
+		opt(server)
+	}
+	return server
 }
 
-// 创建RPC服务器
-func NewServer() *Server {
-	return &Server{}
+// 使用自己的编解码器注册表，找不到的类型再查默认注册表，需要在 Accept 之前调用
+func (server *Server) SetCodecRegistry(r *codec.Registry) {
+	server.codecs = r
 }
 
 // rpc包下的全局公共变量：默认服务器实例
@@ -60,21 +209,17 @@ var DefaultServer = NewServer()
 
 /**
  * Accept功能：接受来自监听器的连接请求，并为这些新的连接处理相关的请求
+ * 临时错误时退避重试，监听器出现永久错误时返回该错误，服务器 Close 后返回 ErrServerClosed
  */
-func (server *Server) Accept(listener net.Listener) {
-	//死循环
-	for {
-		conn, err := listener.Accept() //等待下一个连接
-		if err != nil {
-			log.Println("rpc server:accept error:", err)
-		}
+func (server *Server) Accept(listener net.Listener) error {
+	return server.serveListener(listener, func(conn net.Conn) {
 		//与通信过程相关,conn连接是一个有可读可写可关闭的具体连接接口
-		go server.ServeConn(conn) //TODO 具体连接
-	}
+		server.ServeConn(conn)
+	})
 }
 
-func Accept(listener net.Listener) {
-	DefaultServer.Accept(listener) //调用连接
+func Accept(listener net.Listener) error {
+	return DefaultServer.Accept(listener) //调用连接
 }
 
 //若想启动服务，很简单，传入 listener 即可，listener通过net.Listen(协议，端口)，tcp 协议和 unix 协议都支持，然后传入Accept
@@ -87,128 +232,625 @@ func Accept(listener net.Listener) {
  */
 func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	defer func() { _ = conn.Close() }() //关闭连接
+	if server.isClosed() || server.isDraining() || !server.acceptConn(conn) || !server.plugins.doConnect(conn) {
+		return
+	}
+	defer server.plugins.doDisconnect(conn)
+	hs, ok := server.beginHandshake(conn)
+	if !ok {
+		return
+	}
+	defer hs.end()
+	ctx, ok := server.connected(conn)
+	if !ok {
+		return
+	}
+	var err error
+	defer func(conn io.ReadWriteCloser) { server.disconnected(conn, err) }(conn)
+	cs, conn := server.trackConn(conn)
+	defer server.untrackConn(cs)
+
+	var opt *Option
+	var cc codec.Codec
+	opt, cc, err = handshake(conn, server.codecs, server.maxBodySize, server.bufferSizes)
+	hs.end()
+	if err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			atomic.AddUint64(&server.hsTimeouts, 1)
+		}
+		server.logf("rpc server: %v", err)
+		return
+	}
+	err = server.serveCodec(ctx, cc, opt, cs)
+}
+
+/**
+ * 服务端握手：读取连接开头的 Option，检查魔数，创建对应的编解码器
+ * 代理等需要自己处理请求的组件也可以使用，r 为nil时只使用默认注册表
+ */
+func Handshake(conn io.ReadWriteCloser, r *codec.Registry) (*Option, codec.Codec, error) {
+	return handshake(conn, r, 0, codec.BufferOptions{})
+}
 
+// maxBodySize 是分块传输时本端接收的消息的最大字节数，bufs 是本端的读写缓冲区大小，都不由客户端决定
+func handshake(conn io.ReadWriteCloser, r *codec.Registry, maxBodySize int, bufs codec.BufferOptions) (*Option, codec.Codec, error) {
 	var opt Option //Option 协议协商结构体
 
 	//先使用 json.NewDecoder创建从连接读的解码器，，解码需要的参数（编码类型）到opt中
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("rpc server:options error:", err)
-		return
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
+		return nil, nil, fmt.Errorf("options error: %w", err)
 	}
 	//检查是否为rpc连接
 	if opt.MagicNumber != MagicNumber {
-		log.Printf("rpc server:invalid magic number %x", opt.MagicNumber)
-		return
+		return nil, nil, fmt.Errorf("invalid magic number %x", opt.MagicNumber)
 	}
+	opt.MaxBodySize = maxBodySize
+	opt.ReadBufferSize, opt.WriteBufferSize = bufs.ReadSize, bufs.WriteSize
 	//得到一个对应的反序列化函数，看是否存在这个编解码器类型的接口，即codec的具体实现
-	f := codec.NewCodecFuncMap[opt.CodecType]
-	if f == nil {
-		log.Printf("rpc server:invalid codec type %s", opt.CodecType)
-		return
+	f, err := codecFunc(r, &opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	//对后续数据进行解码，json解码器可能已经预读了后面的请求，需要先读它缓冲的部分
+	br := bufio.NewReaderSize(io.MultiReader(dec.Buffered(), conn), bufs.ReadSize)
+	//json.Encoder 会在 Option 后面追加一个换行符，需要跳过
+	if b, err := br.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = br.Discard(1)
 	}
-	//对后续数据进行解码
-	server.serveCodec(f(conn))
+	return &opt, f(&bufferedConn{ReadWriteCloser: conn, r: br}), nil
+}
+
+// Option 之后的数据可能一部分已经在 json 解码器的缓冲里，读的时候先读缓冲再读连接
+type bufferedConn struct {
+	io.ReadWriteCloser
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
 }
 
 /**
  * rpc连接后的请求结构体
  */
 type request struct {
-	h            *codec.Header //请求头
-	argv, replyv reflect.Value //请求的argvv 和 replyv
+	h            *codec.Header   //请求头
+	argv, replyv reflect.Value   //请求的argvv 和 replyv
+	mtype        *methodType     //请求的方法
+	svc          *service        //请求的服务
+	ctx          context.Context //调用方取消或者连接断开时被取消
+	desync       bool            //请求体没有完整读出，连接上后面的数据不可信，回复后关闭连接
+	codecType    codec.Type      //连接的编解码方式
+	acquired     bool            //优先级调度时已经拿到方法的并发名额，见 Server.schedule
+	acquireErr   error           //优先级调度时等待方法的名额失败的错误
+}
+
+/**
+ * request 和它的请求头在处理完后放回池中复用，减少小消息时每个请求的分配
+ * 参数和返回值不复用：返回值可能被去重缓存引用，参数可能被服务方法保存
+ */
+var requestPool = sync.Pool{New: func() interface{} { return &request{h: new(codec.Header)} }}
+
+func newRequest() *request {
+	return requestPool.Get().(*request)
+}
+
+// 响应发送完后调用，之后不能再使用 req
+// 所有字段都要清零：gob 不发送零值字段，复用的请求头里的旧值不会被覆盖
+func (req *request) release() {
+	h := req.h
+	*h = codec.Header{}
+	*req = request{h: h}
+	requestPool.Put(req)
 }
 
 /**
  * 读取请求头,根据具体实现解码读请求头
  */
-func (server *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
-	var h codec.Header
-	if err := cc.ReadHeader(&h); err != nil {
+func (server *Server) readRequestHeader(cc codec.Codec, h *codec.Header) error {
+	if err := cc.ReadHeader(h); err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("rpc server:read header error:", err)
+			server.logf("rpc server:read header error: %v", err)
 		}
-		//若是出现没有更多输入的错误，返回nil即可
-		return nil, err
+		return err
 	}
-	return &h, nil
+	return nil
 }
 
 /**
  * 读取请求 readRequest
  */
-func (server *Server) readRequest(cc codec.Codec) (*request, error) {
-	h, err := server.readRequestHeader(cc)
-	if err != nil {
+func (server *Server) readRequest(cc codec.Codec, callback *Callback, client ClientInfo) (*request, error) {
+	req := newRequest()
+	h := req.h
+	if err := server.readRequestHeader(cc, h); err != nil {
+		req.release()
 		return nil, err //读取头时候出现错误，均关闭连接
 	}
-	req := &request{h: h}
-	//TODO 不知道请求argv，先认为是string
-	req.argv = reflect.New(reflect.TypeOf(""))
-	//.Interface() 以interface{}方式返回参数当前值
-	if err = cc.ReadBody(req.argv.Interface()); err != nil {
-		log.Println("rpc server: read argv err: ", err)
+	//客户端对回调的响应，没有开启回调时丢弃
+	if h.Callback {
+		if callback == nil {
+			return req, cc.ReadBody(nil)
+		}
+		return req, callback.receive(cc, h)
+	}
+	//取消消息没有服务，请求体为空
+	if h.ServiceMethod == CancelServiceMethod {
+		return req, req.readBody(cc, nil)
+	}
+	err := server.checkMetadata(h)
+	ensureRequestID(h)
+	if err == nil {
+		err = server.plugins.doPreReadRequest(h)
+	}
+	if err == nil {
+		var tenant string
+		tenant, h.Meta = server.resolveTenant(h.Meta, client)
+		req.svc, req.mtype, err = server.lookupService(h.ServiceMethod, h.Version, tenant)
+	}
+	if err != nil {
+		//找不到服务也要把请求体读掉，否则后续的请求会错位；不解码，只跳过这一帧
+		_ = req.readBody(cc, nil)
+		return req, err
+	}
+	//根据注册的方法创建参数和响应实例
+	req.argv = req.mtype.newArgv()
+	req.replyv = req.mtype.newReplyv()
+
+	//ReadBody 需要传入指针，argv 为值类型时需要取地址
+	argvi := req.argv.Interface()
+	if req.argv.Type().Kind() != reflect.Ptr {
+		argvi = req.argv.Addr().Interface()
+	}
+	//参数声明为接口时按请求头的类型标签解码，见 typetag.go
+	target, assign, err := typedTarget(h.BodyType, argvi)
+	if err != nil {
+		_ = req.readBody(cc, nil)
+		return req, &InvalidArgumentError{Msg: fmt.Sprintf("%s: %v", h.ServiceMethod, err)}
+	}
+	//按方法声明的参数类型解码，请求体与之不符时拒绝这次调用，错误中带上期望的类型
+	if err = req.readBody(cc, target); err != nil {
+		server.logf("rpc server: read argv err: %v (request %s)", err, h.Meta[RequestIDMeta])
+		return req, &InvalidArgumentError{Msg: fmt.Sprintf("%s expects argument of type %s: %v", h.ServiceMethod, req.mtype.ArgType, err)}
+	}
+	if assign != nil {
+		assign()
+	}
+	if err = server.validate(h.ServiceMethod, req.argv); err != nil {
+		return req, err
 	}
 	return req, nil //返回请求信息（头和参数体应答体）
 }
 
+/*
+读请求体，出错时判断连接上的数据是否还是同步的：
+按帧读写的编解码器返回 codec.DecodeError，说明这一帧已经完整读出，只影响这个请求；
+其他错误（如 gob 流解码失败会留下没有读完的数据、连接出错）之后的数据不可信，回复这个请求后关闭连接
+*/
+func (req *request) readBody(cc codec.Codec, body interface{}) error {
+	err := cc.ReadBody(body)
+	var de *codec.DecodeError
+	if err != nil && !errors.As(err, &de) {
+		req.desync = true
+	}
+	return err
+}
+
 /**
  * 回复请求 sendResponse
  */
-func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sync.Mutex) {
+func (server *Server) sendResponse(cc codec.Codec, h *codec.Header, body interface{}, sending *sendLock) {
 	sending.Lock()
 	defer sending.Unlock()
 	//写入，进行响应信息编码
-	if err := cc.Write(h, body); err != nil {
-		log.Println("rpc server: write response error: ", err)
+	if h.Error != "" {
+		atomic.AddUint64(&server.errors, 1)
+	}
+	//响应声明为接口时带上具体类型的标签，请求的标签不带回
+	h.BodyType = ""
+	if h.Error == "" {
+		h.BodyType, body = taggedBody(body)
 	}
+	err := cc.Write(h, body)
+	//分块传输时响应太大没有发出去，连接还可以用，告诉客户端这次调用失败
+	if errors.Is(err, codec.ErrBodyTooLarge) && h.Error == "" {
+		h.Error, h.BodyType = err.Error(), ""
+		err = cc.Write(h, invalidRequest)
+	}
+	if err != nil {
+		server.logf("rpc server: write response error: %v (request %s)", err, h.Meta[RequestIDMeta])
+	}
+	server.plugins.doPostWriteResponse(h, body, err)
 }
 
 /**
  * 处理请求 handleRequest 协程并发执行请求（go）
  */
-func (server *Server) handleRequest(cc codec.Codec, req *request, sending *sync.Mutex, wg *sync.WaitGroup) {
-	//TODO 应调用已注册的rpc方法去获得正确的replv
-	// 先打印argv和发送hello message
-	defer wg.Done() //自减1
-	//Elem 返回接口包括或者指针指向的值
-	log.Println(req.h, req.argv.Elem()) //打印header和请求参数
-	req.replyv = reflect.ValueOf(fmt.Sprintf("rpc resp %d", req.h.Seq))
+func (server *Server) handleRequest(cc codec.Codec, req *request, clientID string, sending *sendLock) {
+	executed := false
+	//调度时已经拿到的名额，没有执行服务方法就返回时归还；执行时由 invoke 归还
+	if req.acquired {
+		m := req.mtype
+		defer func() {
+			if !executed {
+				m.release()
+			}
+		}()
+	}
+	//故障注入在去重之前，注入的错误不会被当作结果缓存
+	c := server.chaos.Load()
+	delay, fault := c.decide(req.h.ServiceMethod)
+	if delay > 0 && !Sleep(req.ctx, server.clock, delay) {
+		return
+	}
+	switch fault {
+	case chaosFail:
+		req.h.Error = c.err().Error()
+		server.sendResponse(cc, req.h, invalidRequest, sending)
+		return
+	case chaosReset:
+		_ = cc.Close()
+		return
+	}
+	var entry *dedupEntry
+	if key := dedupKey(req.h, clientID); key != "" && server.dedup != nil {
+		var first bool
+		if entry, first = server.dedup.begin(key); !first {
+			server.replyDuplicate(cc, req, entry, sending)
+			return
+		}
+	}
+	ctx := req.ctx
+	timeout := server.methodTimeout(req.mtype)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = WithClockTimeout(ctx, server.clock, timeout)
+		defer cancel()
+	}
+	var err error
+	switch {
+	case req.acquired:
+	case req.acquireErr != nil:
+		err = req.acquireErr
+	default:
+		err = req.mtype.acquire(ctx)
+	}
+	executed = err == nil
+	if executed {
+		//调用注册的方法，结果写入replyv
+		start := time.Now()
+		err = server.invoke(ctx, req, timeout)
+		if err == nil {
+			err = server.checkReply(req, req.codecType)
+		}
+		d := time.Since(start)
+		server.checkSlow(ctx, req.h.ServiceMethod, req.argv, d)
+		req.mtype.stats.record(d, err)
+	}
+	if entry != nil {
+		if executed {
+			server.dedup.finish(entry, req.replyv.Interface(), err)
+		} else {
+			server.dedup.abort(entry, err)
+		}
+	}
+	//调用方已经放弃或者注入了丢弃，不再回复
+	if req.ctx.Err() != nil || fault == chaosDrop {
+		return
+	}
+	if err != nil {
+		req.h.Error = err.Error()
+		server.sendResponse(cc, req.h, invalidRequest, sending)
+		return
+	}
 	//需要Interface()对reflect.Value进行转换
 	server.sendResponse(cc, req.h, req.replyv.Interface(), sending)
-	return
+}
+
+// 方法的处理超时时间，方法没有设置时使用服务器的设置，0表示不限制
+func (server *Server) methodTimeout(m *methodType) time.Duration {
+	if m.opt.Timeout != 0 {
+		return m.opt.Timeout
+	}
+	return server.handleTimeout
+}
+
+// 重复的请求，等第一次的请求处理完后回复同样的结果
+func (server *Server) replyDuplicate(cc codec.Codec, req *request, entry *dedupEntry, sending *sendLock) {
+	select {
+	case <-entry.done:
+	case <-req.ctx.Done():
+		return
+	}
+	if entry.err != "" {
+		req.h.Error = entry.err
+		server.sendResponse(cc, req.h, invalidRequest, sending)
+		return
+	}
+	server.sendResponse(cc, req.h, entry.reply, sending)
+}
+
+/**
+ * 调用方法，方法返回后释放 acquire 得到的名额
+ * 设置了超时时间的方法在超时后直接返回错误，不再等待方法结束
+ */
+func (server *Server) invoke(ctx context.Context, req *request, timeout time.Duration) error {
+	if timeout == 0 {
+		defer req.mtype.release()
+		return server.call(ctx, req.svc, req.mtype, req.argv, req.replyv)
+	}
+	called := make(chan error, 1)
+	//超时返回后 req 会被放回池中复用，goroutine 里只能使用这里取出的值
+	svc, mtype, argv, replyv := req.svc, req.mtype, req.argv, req.replyv
+	go func() {
+		defer mtype.release()
+		called <- server.call(ctx, svc, mtype, argv, replyv)
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("rpc server: request handle timeout: expect within %s", timeout)
+	case err := <-called:
+		return err
+	}
+}
+
+// 请求的优先级，加上方法设置的优先级
+func (req *request) priority() int {
+	if req.mtype == nil {
+		return req.h.Priority
+	}
+	return req.h.Priority + req.mtype.opt.Priority
+}
+
+// 请求开始处理之前的准入检查：按客户端限流和过载保护，priority 为请求的优先级
+func (server *Server) admit(h *codec.Header, priority int, clientID string) error {
+	if server.isDebug() {
+		server.logf("rpc server: debug: %s seq=%d client=%s priority=%d request=%s", h.ServiceMethod, h.Seq, clientID, priority, h.Meta[RequestIDMeta])
+	}
+	//排空时管理服务仍然可用，用于停止排空
+	if server.isDraining() && !strings.HasPrefix(h.ServiceMethod, AdminServiceName+".") {
+		return ErrServerDraining
+	}
+	if server.clientLimit != nil {
+		if err := server.clientLimit.admit(clientID); err != nil {
+			return err
+		}
+	}
+	if server.shed != nil {
+		if err := server.shed.admit(priority); err != nil {
+			if server.clientLimit != nil {
+				server.clientLimit.done(clientID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// 请求处理完成，latency 包括排队时间
+func (server *Server) finish(clientID string, latency time.Duration) {
+	if server.clientLimit != nil {
+		server.clientLimit.done(clientID)
+	}
+	if server.shed != nil {
+		server.shed.done(latency)
+	}
 }
 
 // 这是一个当错误发生后对响应参数的占位符，一个空结构体
 var invalidRequest = struct{}{}
 
-// Codec:编解码器
-func (server *Server) serveCodec(cc codec.Codec) {
+// Codec:编解码器，ctx 是连接上所有请求的 context 的基础，返回导致连接关闭的错误，对端正常关闭时为nil
+func (server *Server) serveCodec(ctx context.Context, cc codec.Codec, opt *Option, cs *connState) (connErr error) {
 	//defer func(){
 	//	_=cc.Close()
 	//}()
-	sending := new(sync.Mutex) //保证发送一个完整的响应
-	wg := new(sync.WaitGroup)  //等待所有请求被处理
+	sending := newSendLock(cc) //保证发送一个完整的响应，多个响应等待时合并写出，见 sendlock.go
+	running := new(connRequests)
+	//连接断开时取消所有还在处理的请求
+	client := ClientInfo{ClientID: opt.ClientID, SessionID: opt.SessionID}
+	cs.clientID.Store(opt.ClientID)
+	baseCtx := context.WithValue(ctx, clientInfoKey{}, client)
+	baseCtx = context.WithValue(baseCtx, peerKey{}, newPeer(cs.conn))
+	var callback *Callback
+	if opt.Flags&FlagCallbacks != 0 {
+		callback = newCallback(cc, sending)
+		baseCtx = context.WithValue(baseCtx, callbackKey{}, callback)
+	}
+	connCtx, cancelConn := context.WithCancel(baseCtx)
+	inflight := newInflightCalls(server.clock)
 
 	/**
 	 * 在一次连接中，允许接收多个请求，即多个 request header 和 request body，因此这里使用了 for 无限制地等待请求的到来，直到发生错误（例如连接被关闭，接收到的报文有问题等）
 	 */
 	for {
-		req, err := server.readRequest(cc)
+		req, err := server.readRequest(cc, callback, client)
+		//客户端对回调的响应，已经在 readRequest 中处理
+		if req != nil && req.h.Callback {
+			req.release()
+			if err != nil {
+				connErr = err
+				break
+			}
+			continue
+		}
+		if req != nil && req.h.ServiceMethod != CancelServiceMethod {
+			atomic.AddUint64(&server.requests, 1)
+			atomic.AddUint64(&cs.requests, 1)
+		}
 		if err != nil {
 			if req == nil {
+				connErr = err
 				break //该错误不可能恢复，所以关闭这个连接
 			}
 			//非请求体为空的错误，可以服务器处理
 			req.h.Error = err.Error()
 			//invalid空结构体
 			server.sendResponse(cc, req.h, invalidRequest, sending)
+			desync := req.desync
+			req.release()
+			if desync {
+				server.logf("rpc server: closing connection after unrecoverable read error: %v", err)
+				connErr = err
+				break
+			}
+			continue
+		}
+		if req.h.ServiceMethod == CancelServiceMethod {
+			inflight.cancel(req.h.Seq)
+			req.release()
+			continue
+		}
+		priority := req.priority()
+		if err = server.admit(req.h, priority, client.ClientID); err != nil {
+			req.h.Error = err.Error()
+			server.sendResponse(cc, req.h, invalidRequest, sending)
+			req.release()
 			continue
 		}
-		//需要让handleRequest完全处理，内部加wg锁响应
-		wg.Add(1)
+		req.ctx = inflight.add(connCtx, req.h)
+		req.codecType = opt.CodecType
+		running.add()
 		//得到请求信息后可以处理请求并返回
-		go server.handleRequest(cc, req, sending, wg)
+		start := time.Now()
+		atomic.AddInt64(&cs.inflight, 1)
+		server.schedule(priority, req, func() {
+			server.handleRequest(cc, req, client.ClientID, sending)
+			inflight.cancel(req.h.Seq)
+			server.finish(client.ClientID, time.Since(start))
+			atomic.AddInt64(&cs.inflight, -1)
+			req.release()
+			running.done()
+		})
+	}
+	if callback != nil {
+		callback.close()
+	}
+	//连接已经不可用：取消所有请求，给它们一段时间返回，卡住的请求不会让连接一直无法释放
+	cancelConn()
+	if n := running.wait(clockOrReal(server.clock), server.drainTimeout()); n > 0 {
+		server.logf("rpc server: closing connection with %d requests still running", n)
 	}
-	wg.Wait()
 	_ = cc.Close()
+	if connErr == io.EOF {
+		connErr = nil
+	}
+	return connErr
+}
+
+/**
+ * 取消
+ *
+ * 客户端放弃一个调用时发送一条 ServiceMethod 为 CancelServiceMethod 的消息，Seq 为被取消的调用编号，请求体为空
+ * 服务端取消该调用的 context，服务方法可以通过 ctx.Done() 提前结束，结束后也不再回复
+ * 服务名 geerpc 不是导出的名字，不会与注册的服务冲突
+ */
+const CancelServiceMethod = "geerpc.Cancel"
+
+// 连接关闭时默认最多等待正在处理的请求的时间
+const DefaultDrainTimeout = 5 * time.Second
+
+/**
+ * 设置连接关闭时等待正在处理的请求的时间，0表示默认的 DefaultDrainTimeout
+ * 请求的 context 在连接关闭时已经被取消，超时后不再等待，它们之后的响应会被丢弃
+ */
+func (server *Server) SetDrainTimeout(d time.Duration) {
+	atomic.StoreInt64(&server.drain, int64(d))
+}
+
+func (server *Server) drainTimeout() time.Duration {
+	if d := time.Duration(atomic.LoadInt64(&server.drain)); d > 0 {
+		return d
+	}
+	return DefaultDrainTimeout
+}
+
+// 一个连接上正在处理（包括排队）的请求数，连接关闭时等待它们结束
+type connRequests struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} //等待时创建，n 归零时关闭
+}
+
+func (r *connRequests) add() {
+	r.mu.Lock()
+	r.n++
+	r.mu.Unlock()
+}
+
+func (r *connRequests) done() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n--
+	if r.n == 0 && r.idle != nil {
+		close(r.idle)
+		r.idle = nil
+	}
+}
+
+// 等待请求全部结束，超时返回还没有结束的请求数
+func (r *connRequests) wait(clock Clock, timeout time.Duration) int {
+	r.mu.Lock()
+	if r.n == 0 {
+		r.mu.Unlock()
+		return 0
+	}
+	idle := make(chan struct{})
+	r.idle = idle
+	r.mu.Unlock()
+
+	t := clock.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-idle:
+		return 0
+	case <-t.C():
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.n
+	}
+}
+
+// 一个连接上正在处理的请求，Seq -> 取消函数
+type inflightCalls struct {
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelFunc
+	clock   Clock //比较请求头中的截止时间，为nil时使用 RealClock
+}
+
+func newInflightCalls(clock Clock) *inflightCalls {
+	return &inflightCalls{cancels: make(map[uint64]context.CancelFunc), clock: clock}
+}
+
+// 请求头带有截止时间时，处理请求的 context 在截止时间到达后自动取消，按 clock 计时
+// 请求元数据放在 context 中，通过 MetadataFromContext 读取
+func (c *inflightCalls) add(parent context.Context, h *codec.Header) context.Context {
+	if h.Meta != nil {
+		parent = context.WithValue(parent, incomingMetadataKey{}, h.Meta)
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if h.Deadline != 0 {
+		d := time.Unix(0, h.Deadline).Sub(clockOrReal(c.clock).Now())
+		ctx, cancel = WithClockTimeout(parent, c.clock, d)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancels[h.Seq] = cancel
+	return ctx
+}
+
+// 取消并移除，请求已经处理完时什么都不做
+func (c *inflightCalls) cancel(seq uint64) {
+	c.mu.Lock()
+	cancel := c.cancels[seq]
+	delete(c.cancels, seq)
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
 }
@@ -0,0 +1,146 @@
+package geerpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 服务端统计和连接管理
+ *
+ * Stats 返回服务器整体的统计数据，Connections 返回每个连接的对端地址、建立时间、在途请求数和读写字节数，
+ * CloseConnection 可以强制关闭某个异常的连接，连接上正在处理的请求会被取消
+ */
+
+type ServerStats struct {
+	Connections       int    //当前连接数
+	Requests          uint64 //收到的请求总数
+	Errors            uint64 //返回错误的响应数
+	Inflight          int64  //正在处理（包括排队）的请求数
+	SlowCalls         uint64 //执行超过慢调用阈值的请求数，见 SetSlowThreshold
+	RejectedConns     uint64 //被来源 IP 过滤或握手限制拒绝的连接数，见 SetIPFilter、SetHandshakeLimits
+	HandshakeTimeouts uint64 //没有在限定时间内完成握手的连接数
+	BytesSent         uint64
+	BytesReceived     uint64
+}
+
+type ConnInfo struct {
+	ID            uint64
+	RemoteAddr    string //对端地址，连接不是 net.Conn 时为空
+	ClientID      string //握手时客户端的标识
+	OpenTime      time.Time
+	Inflight      int64
+	Requests      uint64
+	BytesSent     uint64
+	BytesReceived uint64
+}
+
+var ErrConnNotFound = errors.New("rpc server: connection not found")
+
+// 一个连接的状态
+type connState struct {
+	id       uint64
+	conn     io.ReadWriteCloser
+	remote   string
+	clientID atomic.Value //string，握手后设置
+	opened   time.Time
+	inflight int64
+	requests uint64
+	sent     uint64
+	received uint64
+}
+
+// 统计读写字节数的连接
+type trackedConn struct {
+	io.ReadWriteCloser
+	cs *connState
+}
+
+func (c *trackedConn) Read(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Read(p)
+	atomic.AddUint64(&c.cs.received, uint64(n))
+	return n, err
+}
+
+func (c *trackedConn) Write(p []byte) (int, error) {
+	n, err := c.ReadWriteCloser.Write(p)
+	atomic.AddUint64(&c.cs.sent, uint64(n))
+	return n, err
+}
+
+// 开始跟踪一个连接，返回统计读写字节数的连接
+func (server *Server) trackConn(conn io.ReadWriteCloser) (*connState, io.ReadWriteCloser) {
+	cs := &connState{
+		id:     atomic.AddUint64(&server.nextConnID, 1),
+		conn:   conn,
+		opened: time.Now(),
+	}
+	if nc, ok := conn.(net.Conn); ok && nc.RemoteAddr() != nil {
+		cs.remote = nc.RemoteAddr().String()
+	}
+	server.conns.Store(cs.id, cs)
+	return cs, &trackedConn{ReadWriteCloser: conn, cs: cs}
+}
+
+func (server *Server) untrackConn(cs *connState) {
+	server.conns.Delete(cs.id)
+	//已经关闭的连接的读写字节数计入总数
+	atomic.AddUint64(&server.closedSent, atomic.LoadUint64(&cs.sent))
+	atomic.AddUint64(&server.closedReceived, atomic.LoadUint64(&cs.received))
+}
+
+func (server *Server) Stats() ServerStats {
+	st := ServerStats{
+		Requests:          atomic.LoadUint64(&server.requests),
+		Errors:            atomic.LoadUint64(&server.errors),
+		SlowCalls:         atomic.LoadUint64(&server.slowCalls),
+		RejectedConns:     atomic.LoadUint64(&server.rejectedConns),
+		HandshakeTimeouts: atomic.LoadUint64(&server.hsTimeouts),
+		BytesSent:         atomic.LoadUint64(&server.closedSent),
+		BytesReceived:     atomic.LoadUint64(&server.closedReceived),
+	}
+	server.conns.Range(func(_, v interface{}) bool {
+		cs := v.(*connState)
+		st.Connections++
+		st.Inflight += atomic.LoadInt64(&cs.inflight)
+		st.BytesSent += atomic.LoadUint64(&cs.sent)
+		st.BytesReceived += atomic.LoadUint64(&cs.received)
+		return true
+	})
+	return st
+}
+
+// 当前所有连接，按 ID 排序
+func (server *Server) Connections() []ConnInfo {
+	var conns []ConnInfo
+	server.conns.Range(func(_, v interface{}) bool {
+		cs := v.(*connState)
+		clientID, _ := cs.clientID.Load().(string)
+		conns = append(conns, ConnInfo{
+			ID:            cs.id,
+			RemoteAddr:    cs.remote,
+			ClientID:      clientID,
+			OpenTime:      cs.opened,
+			Inflight:      atomic.LoadInt64(&cs.inflight),
+			Requests:      atomic.LoadUint64(&cs.requests),
+			BytesSent:     atomic.LoadUint64(&cs.sent),
+			BytesReceived: atomic.LoadUint64(&cs.received),
+		})
+		return true
+	})
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	return conns
+}
+
+// 强制关闭一个连接
+func (server *Server) CloseConnection(id uint64) error {
+	v, ok := server.conns.Load(id)
+	if !ok {
+		return ErrConnNotFound
+	}
+	return v.(*connState).conn.Close()
+}
@@ -0,0 +1,343 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geerpc/codec"
+	"go/ast"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+/**
+ * 服务注册
+ *
+ * 通过反射把结构体的方法映射为服务，满足以下条件的方法才会被注册：
+ * 1.方法所属类型和方法本身都是导出的
+ * 2.两个参数，均为导出类型或内置类型，第二个参数必须是指针
+ * 3.返回值只有一个，类型为 error
+ * 即 func (t *T) MethodName(argType T1, replyType *T2) error
+ * 也可以在最前面多一个 context.Context 参数，调用方取消或连接断开时该 context 会被取消：
+ * func (t *T) MethodName(ctx context.Context, argType T1, replyType *T2) error
+ * 也可以直接返回响应，响应实例由框架创建，context.Context 参数同样可选：
+ * func (t *T) MethodName(ctx context.Context, argType T1) (T2, error)
+ * ctx 中还带有对端地址、TLS 状态、元数据等调用信息，见 peer.go
+ * ServiceMethod 为 "T.MethodName"，服务端按照 "." 拆分后找到对应的 service 和 methodType
+ */
+
+// 一个方法的完整信息
+type methodType struct {
+	method    reflect.Method //方法本身
+	ArgType   reflect.Type   //第一个参数的类型
+	ReplyType reflect.Type   //第二个参数的类型
+	hasCtx    bool           //第一个参数是否为 context.Context
+	returns   bool           //响应是否为返回值，此时 ReplyType 为返回值类型的指针
+	numCalls  uint64         //统计方法调用次数
+	opt       MethodOption   //处理选项
+	//注册时指定的拦截器，服务的在前，方法的在后
+	interceptors []Interceptor
+	sem          chan struct{} //并发限制，为nil时不限制
+	queued       int64         //正在排队的请求数
+	stats        methodStats   //调用数和耗时，见 method_stats.go
+}
+
+func (m *methodType) NumCalls() uint64 {
+	return atomic.LoadUint64(&m.numCalls)
+}
+
+// 创建参数实例，参数可能是指针类型也可能是值类型
+func (m *methodType) newArgv() reflect.Value {
+	var argv reflect.Value
+	if m.ArgType.Kind() == reflect.Ptr {
+		argv = reflect.New(m.ArgType.Elem())
+	} else {
+		argv = reflect.New(m.ArgType).Elem()
+	}
+	return argv
+}
+
+// 创建响应实例，响应一定是指针类型，map 和 slice 需要初始化
+func (m *methodType) newReplyv() reflect.Value {
+	replyv := reflect.New(m.ReplyType.Elem())
+	switch m.ReplyType.Elem().Kind() {
+	case reflect.Map:
+		replyv.Elem().Set(reflect.MakeMap(m.ReplyType.Elem()))
+	case reflect.Slice:
+		replyv.Elem().Set(reflect.MakeSlice(m.ReplyType.Elem(), 0, 0))
+	}
+	return replyv
+}
+
+// 一个服务，即一个注册的结构体实例
+type service struct {
+	name   string                 //映射的结构体名称
+	typ    reflect.Type           //结构体类型
+	rcvr   reflect.Value          //结构体实例本身，调用时作为第0个参数
+	method map[string]*methodType //所有符合条件的方法
+}
+
+// name 为空时使用结构体名作为服务名
+func newService(rcvr interface{}, name string) (*service, error) {
+	s := new(service)
+	s.rcvr = reflect.ValueOf(rcvr)
+	s.name = name
+	if s.name == "" {
+		s.name = reflect.Indirect(s.rcvr).Type().Name()
+	}
+	s.typ = reflect.TypeOf(rcvr)
+	//运行时也可能注册服务，名字不合法时返回错误而不是退出进程
+	if !ast.IsExported(s.name) {
+		return nil, fmt.Errorf("rpc server: %s is not a valid service name", s.name)
+	}
+	s.registerMethods()
+	return s, nil
+}
+
+// 过滤出符合条件的方法
+func (s *service) registerMethods() {
+	s.method = make(map[string]*methodType)
+	for i := 0; i < s.typ.NumMethod(); i++ {
+		method := s.typ.Method(i)
+		mType := method.Type
+		mt, ok := methodSignature(mType)
+		if !ok {
+			continue
+		}
+		mt.method = method
+		s.method[method.Name] = mt
+	}
+}
+
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+func isExportedOrBuiltinType(t reflect.Type) bool {
+	return ast.IsExported(t.Name()) || t.PkgPath() == ""
+}
+
+/**
+ * 检查方法的签名，支持两种形式（不含接收者）：
+ *   (ctx)、argv、replyv，出参为 error
+ *   (ctx)、argv，出参为 reply、error
+ */
+func methodSignature(mType reflect.Type) (*methodType, bool) {
+	if mType.NumOut() == 0 || mType.Out(mType.NumOut()-1) != typeOfError || mType.NumOut() > 2 {
+		return nil, false
+	}
+	returns := mType.NumOut() == 2
+	numIn := 3 //接收者、argv、replyv
+	if returns {
+		numIn = 2
+	}
+	hasCtx := mType.NumIn() == numIn+1 && mType.In(1) == typeOfContext
+	if mType.NumIn() != numIn && !hasCtx {
+		return nil, false
+	}
+	argType := mType.In(mType.NumIn() - 1)
+	var replyType reflect.Type
+	if returns {
+		replyType = reflect.PtrTo(mType.Out(0))
+		if !isExportedOrBuiltinType(mType.Out(0)) {
+			return nil, false
+		}
+	} else {
+		argType, replyType = mType.In(mType.NumIn()-2), mType.In(mType.NumIn()-1)
+		if !isExportedOrBuiltinType(replyType) || replyType.Kind() != reflect.Ptr {
+			return nil, false
+		}
+	}
+	if !isExportedOrBuiltinType(argType) {
+		return nil, false
+	}
+	return &methodType{ArgType: argType, ReplyType: replyType, hasCtx: hasCtx, returns: returns}, true
+}
+
+// 通过反射调用方法，方法需要 context 时传入 ctx
+func (s *service) call(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
+	atomic.AddUint64(&m.numCalls, 1)
+	f := m.method.Func
+	in := []reflect.Value{s.rcvr}
+	if m.hasCtx {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	in = append(in, argv)
+	if !m.returns {
+		in = append(in, replyv)
+	}
+	returnValues := f.Call(in)
+	if errInter := returnValues[len(returnValues)-1].Interface(); errInter != nil {
+		return errInter.(error)
+	}
+	if m.returns {
+		replyv.Elem().Set(returnValues[0])
+	}
+	return nil
+}
+
+/**
+ * 服务端注册服务，serviceMap 以服务名为键，opts 可以为方法设置处理选项
+ */
+func (server *Server) Register(rcvr interface{}, opts ...RegisterOption) error {
+	return server.register(rcvr, "", opts...)
+}
+
+/**
+ * 以指定的名字注册服务，名字中可以带版本，如 "User.v2"，
+ * 这样同一个服务的多个版本可以同时注册，客户端通过 "User.v2.Method" 或者在 Option 中指定 Version 来调用
+ */
+func (server *Server) RegisterName(name string, rcvr interface{}, opts ...RegisterOption) error {
+	return server.register(rcvr, name, opts...)
+}
+
+func (server *Server) register(rcvr interface{}, name string, opts ...RegisterOption) error {
+	s, err := server.newServiceWithOptions(rcvr, name, opts...)
+	if err != nil {
+		return err
+	}
+	server.registerMu.Lock()
+	defer server.registerMu.Unlock()
+	if _, dup := server.serviceMap.Load(s.name); dup {
+		return errors.New("rpc: service already defined: " + s.name)
+	}
+	//所有检查都通过后才通知插件，插件不会收到注册失败的服务
+	if err = server.plugins.doRegister(s.name, rcvr); err != nil {
+		return err
+	}
+	server.serviceMap.Store(s.name, s)
+	return nil
+}
+
+/**
+ * 运行时替换服务：不存在时注册，存在时原子地替换为新的实现
+ * 正在处理的请求已经持有旧的 service，会在旧实现上正常完成
+ */
+func (server *Server) Replace(name string, rcvr interface{}, opts ...RegisterOption) error {
+	s, err := server.newServiceWithOptions(rcvr, name, opts...)
+	if err != nil {
+		return err
+	}
+	server.registerMu.Lock()
+	defer server.registerMu.Unlock()
+	if err = server.plugins.doRegister(s.name, rcvr); err != nil {
+		return err
+	}
+	server.serviceMap.Store(s.name, s)
+	return nil
+}
+
+/**
+ * 运行时注销服务，之后的请求会返回找不到服务
+ * 正在处理的请求不受影响，会正常完成并回复
+ */
+func (server *Server) Unregister(name string) error {
+	if _, ok := server.serviceMap.LoadAndDelete(name); !ok {
+		return errors.New("rpc: service not registered: " + name)
+	}
+	return nil
+}
+
+func Unregister(name string) error {
+	return DefaultServer.Unregister(name)
+}
+
+func (server *Server) newServiceWithOptions(rcvr interface{}, name string, opts ...RegisterOption) (*service, error) {
+	s, err := newService(rcvr, name)
+	if err != nil {
+		return nil, err
+	}
+	var o registerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for name, mopt := range o.methods {
+		m, ok := s.method[name]
+		if !ok {
+			return nil, errors.New("rpc: can't set option for unknown method " + s.name + "." + name)
+		}
+		m.setOption(mopt)
+	}
+	for name := range o.methodInterceptors {
+		if _, ok := s.method[name]; !ok {
+			return nil, errors.New("rpc: can't set interceptors for unknown method " + s.name + "." + name)
+		}
+	}
+	for name, m := range s.method {
+		m.interceptors = append(append([]Interceptor(nil), o.interceptors...), o.methodInterceptors[name]...)
+	}
+	for i := 0; i < s.typ.NumMethod(); i++ {
+		if name := s.typ.Method(i).Name; s.method[name] != nil {
+			server.logf("rpc server: register %s.%s", s.name, name)
+		}
+	}
+	return s, nil
+}
+
+// 在默认服务器上注册服务
+func Register(rcvr interface{}, opts ...RegisterOption) error {
+	return DefaultServer.Register(rcvr, opts...)
+}
+
+func RegisterName(name string, rcvr interface{}, opts ...RegisterOption) error {
+	return DefaultServer.RegisterName(name, rcvr, opts...)
+}
+
+// 注册 gob 编码时作为接口值传输的具体类型，客户端和服务端都需要调用，见 codec.RegisterType
+func RegisterType(value interface{}) error {
+	return codec.RegisterType(value)
+}
+
+// 以指定的名字注册类型，用于类型改名后与旧版本兼容，见 codec.RegisterTypeName
+func RegisterTypeName(name string, value interface{}) error {
+	return codec.RegisterTypeName(name, value)
+}
+
+const notFoundPrefix = "rpc server: can't find "
+
+// 请求的服务或方法没有注册，服务端没有调用任何方法，请求体已经读出丢弃，连接可以继续使用
+// 客户端收到的也是 NotFoundError，可以与服务方法返回的错误区分
+type NotFoundError struct {
+	Kind string //"service" 或 "method"
+	Name string //找不到的服务名或方法名
+}
+
+func (e *NotFoundError) Error() string {
+	return notFoundPrefix + e.Kind + " " + e.Name
+}
+
+func parseNotFound(msg string) (error, bool) {
+	if !strings.HasPrefix(msg, notFoundPrefix) {
+		return nil, false
+	}
+	kind, name, ok := strings.Cut(strings.TrimPrefix(msg, notFoundPrefix), " ")
+	if !ok {
+		return nil, false
+	}
+	return &NotFoundError{Kind: kind, Name: name}, true
+}
+
+/**
+ * 根据 ServiceMethod 找到对应的服务和方法
+ */
+func (server *Server) findService(serviceMethod string) (svc *service, mtype *methodType, err error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		err = errors.New("rpc server: service/method request ill-formed: " + serviceMethod)
+		return
+	}
+	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	svci, ok := server.serviceMap.Load(serviceName)
+	if !ok {
+		err = &NotFoundError{Kind: "service", Name: serviceName}
+		return
+	}
+	svc = svci.(*service)
+	mtype = svc.method[methodName]
+	if mtype == nil {
+		err = &NotFoundError{Kind: "method", Name: methodName}
+	}
+	return
+}
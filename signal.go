@@ -0,0 +1,120 @@
+package geerpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/**
+ * 收到信号后优雅关闭
+ *
+ * 部署时进程先收到 SIGTERM，一段时间后才被强制杀掉，这段时间里需要：
+ *   1.从注册中心注销，并等客户端刷新实例列表，不再有新的请求发过来
+ *   2.停止接受新连接和新请求，等待正在处理的请求完成（Shutdown）
+ * ListenAndServeWithSignals 把这些步骤串起来：
+ *   rs, _ := registry.NewRegisteredServer(registryAddr, "tcp@10.0.0.1:8001", nil)
+ *   server := geerpc.NewServer(geerpc.WithGracefulShutdown(geerpc.GracefulOption{
+ *       DrainWindow:     20 * time.Second,
+ *       Deregister:      rs.Close,
+ *       DeregisterDelay: 3 * time.Second,
+ *   }))
+ *   l, _ := net.Listen("tcp", ":8001")
+ *   log.Fatal(geerpc.ListenAndServeWithSignals(server, l))
+ * 等待期间再收到一次信号时不再等待，直接关闭所有连接
+ */
+
+// 默认等待正在处理的请求完成的时间
+const DefaultDrainWindow = 30 * time.Second
+
+type GracefulOption struct {
+	Signals         []os.Signal   //触发优雅关闭的信号，为空时为 SIGTERM 和 SIGINT
+	DrainWindow     time.Duration //等待正在处理的请求完成的时间，0表示 DefaultDrainWindow
+	Deregister      func() error  //收到信号后最先调用，如从注册中心注销，为nil时不调用
+	DeregisterDelay time.Duration //注销后继续正常服务的时间，让客户端刷新实例列表
+}
+
+// 同 SetGracefulShutdown
+func WithGracefulShutdown(opt GracefulOption) ServerOption {
+	return func(server *Server) {
+		server.SetGracefulShutdown(opt)
+	}
+}
+
+// 设置 ListenAndServeWithSignals 收到信号后的关闭方式
+func (server *Server) SetGracefulShutdown(opt GracefulOption) {
+	server.graceful = &opt
+}
+
+/**
+ * 服务 listeners（以及之前通过 AddListener 添加的监听器），收到信号后按 SetGracefulShutdown 的设置优雅关闭
+ * 所有请求在等待时间内完成时返回nil，超时时返回 context.DeadlineExceeded，再次收到信号时返回 context.Canceled，
+ * Shutdown 的其他错误原样返回，没有收到信号而监听器出错时返回该错误
+ */
+func ListenAndServeWithSignals(server *Server, listeners ...net.Listener) error {
+	var opt GracefulOption
+	if server.graceful != nil {
+		opt = *server.graceful
+	}
+	if len(opt.Signals) == 0 {
+		opt.Signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	if opt.DrainWindow <= 0 {
+		opt.DrainWindow = DefaultDrainWindow
+	}
+	for _, l := range listeners {
+		if err := server.AddListener(l); err != nil {
+			return err
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, opt.Signals...)
+	defer signal.Stop(sigs)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	var sig os.Signal
+	select {
+	case err := <-served:
+		return err
+	case sig = <-sigs:
+	}
+	server.logf("rpc server: received %v, shutting down", sig)
+	if opt.Deregister != nil {
+		if err := opt.Deregister(); err != nil {
+			server.logf("rpc server: deregister: %v", err)
+		}
+	}
+	//注销后的等待期间仍然正常服务，再次收到信号时直接关闭
+	if opt.DeregisterDelay > 0 {
+		select {
+		case <-time.After(opt.DeregisterDelay):
+		case sig = <-sigs:
+			server.logf("rpc server: received %v again, closing", sig)
+			_ = server.Close()
+			return context.Canceled
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opt.DrainWindow)
+	defer cancel()
+	go func() {
+		select {
+		case sig := <-sigs:
+			server.logf("rpc server: received %v again, closing", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := server.Shutdown(ctx); err != nil {
+		return err
+	}
+	<-served
+	return nil
+}
@@ -0,0 +1,51 @@
+package geerpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 慢调用
+ *
+ * 服务方法执行超过阈值时记录一条日志，包括方法、对端、耗时和参数摘要，并计入 ServerStats.SlowCalls，
+ * 不需要完整的链路追踪就能发现变慢的方法：
+ *   server.SetSlowThreshold(500 * time.Millisecond)
+ * 耗时只包括服务方法本身，不包括排队和编解码
+ */
+
+const slowArgsLimit = 256 //日志中参数摘要的最大长度
+
+// 设置慢调用阈值，0表示不检测
+func (server *Server) SetSlowThreshold(d time.Duration) {
+	atomic.StoreInt64(&server.slowThreshold, int64(d))
+}
+
+// 方法执行结束后检查是否为慢调用
+func (server *Server) checkSlow(ctx context.Context, serviceMethod string, argv reflect.Value, d time.Duration) {
+	threshold := time.Duration(atomic.LoadInt64(&server.slowThreshold))
+	if threshold <= 0 || d < threshold {
+		return
+	}
+	atomic.AddUint64(&server.slowCalls, 1)
+	peer := "-"
+	if p, ok := PeerFromContext(ctx); ok && p.Addr != nil {
+		peer = p.Addr.String()
+	}
+	server.logf("rpc server: slow call %s from %s took %s (request %s): args %s", serviceMethod, peer, d, RequestIDFromContext(ctx), argsSummary(argv))
+}
+
+// 参数的摘要，过长时截断
+func argsSummary(argv reflect.Value) string {
+	if !argv.IsValid() {
+		return "<nil>"
+	}
+	s := fmt.Sprintf("%+v", argv.Interface())
+	if len(s) > slowArgsLimit {
+		s = s[:slowArgsLimit] + "..."
+	}
+	return s
+}
@@ -0,0 +1,122 @@
+package geerpc
+
+import (
+	"geerpc/codec"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ * 找不到调用的响应
+ *
+ * 客户端收到的响应在 pending 中找不到对应的调用时，按编号区分三种情况：
+ *   StrayLate       调用已经取消、超时或发送失败，之后才到达的响应，属于正常现象
+ *   StrayDuplicate  已经收到过响应的编号又收到一次，通常是服务端的问题
+ *   StrayUnknown    客户端从未发出过这个编号
+ * 三种情况分别计入 ClientStats，响应体仍然会被读出丢弃
+ * 没有设置处理函数时记录 StrayDuplicate 和 StrayUnknown 的日志；
+ * 设置后由它处理，返回错误时关闭客户端（如认为连接上的数据已经错乱）：
+ *   client.SetStrayReplyHandler(func(r geerpc.StrayReply) error {
+ *       if r.Kind == geerpc.StrayUnknown {
+ *           return fmt.Errorf("reply for unknown seq %d", r.Seq)
+ *       }
+ *       return nil
+ *   })
+ * 处理函数在接收响应的 goroutine 中调用，不能阻塞
+ * 取消的调用只记住最近 maxAbandonedSeqs 个，更早的调用的迟到响应会被当作 StrayDuplicate
+ */
+
+type StrayKind int
+
+const (
+	StrayLate StrayKind = iota
+	StrayDuplicate
+	StrayUnknown
+)
+
+func (k StrayKind) String() string {
+	switch k {
+	case StrayLate:
+		return "late"
+	case StrayDuplicate:
+		return "duplicate"
+	case StrayUnknown:
+		return "unknown"
+	}
+	return "invalid"
+}
+
+type StrayReply struct {
+	Kind          StrayKind
+	Seq           uint64
+	ServiceMethod string
+	Error         string //响应头中的错误
+}
+
+const maxAbandonedSeqs = 4096
+
+// 没有收到响应就结束的调用编号
+type abandonedSeqs struct {
+	mu    sync.Mutex
+	set   map[uint64]struct{}
+	order []uint64 //按加入顺序，超过上限时淘汰最早的
+}
+
+func (a *abandonedSeqs) add(seq uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.set == nil {
+		a.set = make(map[uint64]struct{})
+	}
+	if len(a.order) >= maxAbandonedSeqs {
+		delete(a.set, a.order[0])
+		a.order = a.order[1:]
+	}
+	a.set[seq] = struct{}{}
+	a.order = append(a.order, seq)
+}
+
+// 编号在集合中时删除并返回 true，迟到的响应只会有一个
+func (a *abandonedSeqs) take(seq uint64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.set[seq]; !ok {
+		return false
+	}
+	delete(a.set, seq)
+	return true
+}
+
+// 设置找不到调用的响应的处理函数，为nil时恢复默认的日志
+func (client *Client) SetStrayReplyHandler(fn func(StrayReply) error) {
+	client.stats.mu.Lock()
+	defer client.stats.mu.Unlock()
+	client.stats.onStray = fn
+}
+
+// 处理一个找不到调用的响应，返回错误时关闭客户端
+func (client *Client) strayReply(h *codec.Header) error {
+	r := StrayReply{Seq: h.Seq, ServiceMethod: h.ServiceMethod, Error: h.Error}
+	switch {
+	case h.Seq == 0 || h.Seq >= atomic.LoadUint64(&client.seq):
+		r.Kind = StrayUnknown
+		atomic.AddUint64(&client.stats.unknown, 1)
+	case client.abandoned.take(h.Seq):
+		r.Kind = StrayLate
+		atomic.AddUint64(&client.stats.late, 1)
+	default:
+		r.Kind = StrayDuplicate
+		atomic.AddUint64(&client.stats.duplicate, 1)
+	}
+	client.stats.mu.Lock()
+	fn := client.stats.onStray
+	client.stats.mu.Unlock()
+	if fn != nil {
+		return fn(r)
+	}
+	if r.Kind != StrayLate {
+		log.Printf("rpc client: %s reply for seq %d (%s)", r.Kind, r.Seq, r.ServiceMethod)
+	}
+	return nil
+}
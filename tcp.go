@@ -0,0 +1,102 @@
+package geerpc
+
+import (
+	"net"
+	"time"
+)
+
+/**
+ * TCP 连接的参数
+ *
+ * 客户端建立的连接和服务端接受的连接都可以设置，没有设置时使用 Go 的默认值（开启 TCP_NODELAY，15 秒的 keepalive）：
+ *   client, _ := geerpc.Dial("tcp", addr, geerpc.WithTCPOption(geerpc.TCPOption{NoDelay: true, KeepAlive: 30 * time.Second}))
+ *   server.SetTCPOption(&geerpc.TCPOption{NoDelay: false, ReadBuffer: 1 << 20, WriteBuffer: 1 << 20})
+ * 设置了 TCPOption 时 NoDelay 按字段的值生效，NoDelay 为 false 表示开启 Nagle 算法，小消息会合并发送，
+ * 吞吐更高但延迟更大；对延迟敏感的调用保持 NoDelay 为 true
+ * TLS 连接设置在底层的 TCP 连接上，unix 等其他连接不受影响
+ */
+
+type TCPOption struct {
+	NoDelay     bool          //是否设置 TCP_NODELAY，false 表示开启 Nagle 算法
+	KeepAlive   time.Duration //keepalive 的周期（连接空闲多久后开始探测，同 SetKeepAlivePeriod），0表示使用默认值，小于0表示关闭 keepalive
+	ReadBuffer  int           //SO_RCVBUF 的字节数，0表示使用系统的默认值
+	WriteBuffer int           //SO_SNDBUF 的字节数，0表示使用系统的默认值
+}
+
+// 与 Go 的默认行为相同，可以在它的基础上修改
+var DefaultTCPOption = TCPOption{NoDelay: true}
+
+// 找到连接底层的 TCP 连接，TLS 等包装过的连接通过 NetConn 取出，不是 TCP 连接时返回nil
+func tcpConnOf(conn net.Conn) *net.TCPConn {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+}
+
+// 按 opt 设置连接，opt 为nil或者不是 TCP 连接时不做任何事
+func (opt *TCPOption) apply(conn net.Conn) error {
+	if opt == nil {
+		return nil
+	}
+	tc := tcpConnOf(conn)
+	if tc == nil {
+		return nil
+	}
+	if err := tc.SetNoDelay(opt.NoDelay); err != nil {
+		return err
+	}
+	switch {
+	case opt.KeepAlive < 0:
+		if err := tc.SetKeepAlive(false); err != nil {
+			return err
+		}
+	case opt.KeepAlive > 0:
+		if err := tc.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tc.SetKeepAlivePeriod(opt.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if opt.ReadBuffer > 0 {
+		if err := tc.SetReadBuffer(opt.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if opt.WriteBuffer > 0 {
+		if err := tc.SetWriteBuffer(opt.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 设置服务端接受的连接的 TCP 参数，对之后接受的连接生效，opt 为nil时使用 Go 的默认值
+func (server *Server) SetTCPOption(opt *TCPOption) {
+	if opt != nil {
+		o := *opt
+		opt = &o
+	}
+	server.tcpOption.Store(opt)
+}
+
+// 同 SetTCPOption
+func WithServerTCPOption(opt TCPOption) ServerOption {
+	return func(server *Server) {
+		server.SetTCPOption(&opt)
+	}
+}
+
+// 设置客户端建立的连接的 TCP 参数，见 Option.TCP
+func WithTCPOption(opt TCPOption) DialOption {
+	return dialOptionFunc(func(o *Option) {
+		o.TCP = &opt
+	})
+}
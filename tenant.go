@@ -0,0 +1,146 @@
+package geerpc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+/**
+ * 多租户路由
+ *
+ * 同一个 ServiceMethod 可以按租户注册不同的实现，一个进程同时服务多个租户的定制版本：
+ *   server.Register(new(Billing))                       //公共实现
+ *   server.RegisterTenant("acme", new(AcmeBilling))     //租户 acme 的实现，服务名同样是 Billing
+ *   client.Call("Billing.Charge", args, &reply, geerpc.WithTenant("acme"))
+ * 默认按请求元数据 TenantIDMeta 确定租户；也可以按连接的身份（如 ClientID）确定，这样客户端无法冒充其他租户：
+ *   server.SetTenantRouting(geerpc.TenantOption{
+ *       Resolver: func(_ map[string]string, c geerpc.ClientInfo) string { return tenantOf(c.ClientID) },
+ *       Strict:   true,
+ *   })
+ * 租户没有注册自己的实现时使用公共实现，Strict 时返回找不到服务
+ * 确定的租户写回请求元数据，服务方法通过 TenantFromContext 读取
+ * 租户的实现在内部以 "Billing@acme" 的名字注册，客户端不能直接通过这个名字调用
+ * 只对通过连接的请求生效，Invoke、HTTP 网关和回调只使用公共实现
+ */
+
+const TenantIDMeta = "tenant-id"
+
+// 租户实现的服务名中服务名和租户之间的分隔符
+const tenantSep = "@"
+
+// 按请求元数据和调用方的标识确定租户，返回空字符串表示不属于任何租户
+type TenantResolver func(meta map[string]string, client ClientInfo) string
+
+type TenantOption struct {
+	Resolver TenantResolver //为nil时使用元数据 TenantIDMeta
+	Strict   bool           //租户没有自己的实现时返回找不到服务，而不是使用公共实现
+}
+
+// 同 SetTenantRouting
+func WithTenantRouting(opt TenantOption) ServerOption {
+	return func(server *Server) {
+		server.SetTenantRouting(opt)
+	}
+}
+
+// 设置确定租户的方式，没有调用时 RegisterTenant 按元数据 TenantIDMeta 路由
+func (server *Server) SetTenantRouting(opt TenantOption) {
+	if opt.Resolver == nil {
+		opt.Resolver = tenantFromMeta
+	}
+	server.tenancy.Store(&opt)
+}
+
+func tenantFromMeta(meta map[string]string, _ ClientInfo) string {
+	return meta[TenantIDMeta]
+}
+
+// 为租户注册服务，服务名与 Register 相同
+func (server *Server) RegisterTenant(tenant string, rcvr interface{}, opts ...RegisterOption) error {
+	return server.RegisterTenantName(tenant, "", rcvr, opts...)
+}
+
+// 以指定的名字为租户注册服务，name 为空时使用类型名
+func (server *Server) RegisterTenantName(tenant, name string, rcvr interface{}, opts ...RegisterOption) error {
+	if err := checkTenant(tenant); err != nil {
+		return err
+	}
+	if name == "" {
+		name = reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	}
+	if err := server.register(rcvr, name+tenantSep+tenant, opts...); err != nil {
+		return err
+	}
+	server.tenancy.CompareAndSwap(nil, &TenantOption{Resolver: tenantFromMeta})
+	return nil
+}
+
+// 注销租户的服务
+func (server *Server) UnregisterTenant(tenant, name string) error {
+	return server.Unregister(name + tenantSep + tenant)
+}
+
+// 租户名会拼接到服务名中，不能包含 "." 和 "@"
+func checkTenant(tenant string) error {
+	if tenant == "" || strings.ContainsAny(tenant, "."+tenantSep) {
+		return errors.New("rpc: invalid tenant " + tenant)
+	}
+	return nil
+}
+
+// 指定这次调用的租户
+func WithTenant(tenant string) CallOption {
+	return WithMetadata(TenantIDMeta, tenant)
+}
+
+// 服务方法读取当前请求所属的租户
+func TenantFromContext(ctx context.Context) string {
+	return MetadataFromContext(ctx)[TenantIDMeta]
+}
+
+// 确定请求的租户并写回元数据，没有开启多租户路由时返回空字符串
+func (server *Server) resolveTenant(meta map[string]string, client ClientInfo) (string, map[string]string) {
+	opt := server.tenancy.Load()
+	if opt == nil {
+		return "", meta
+	}
+	tenant := opt.Resolver(meta, client)
+	if tenant == meta[TenantIDMeta] {
+		return tenant, meta
+	}
+	if tenant == "" {
+		delete(meta, TenantIDMeta)
+		return "", meta
+	}
+	if meta == nil {
+		meta = make(map[string]string, 1)
+	}
+	meta[TenantIDMeta] = tenant
+	return tenant, meta
+}
+
+// 按租户查找服务：先找租户自己的实现，没有时按设置使用公共实现或返回找不到服务
+func (server *Server) findTenantService(serviceMethod, tenant string) (*service, *methodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot <= 0 {
+		return server.findService(serviceMethod)
+	}
+	serviceName := serviceMethod[:dot]
+	if strings.Contains(serviceName, tenantSep) {
+		return nil, nil, &NotFoundError{Kind: "service", Name: serviceName}
+	}
+	if tenant == "" {
+		return server.findService(serviceMethod)
+	}
+	if checkTenant(tenant) == nil {
+		if svc, mtype, err := server.findService(serviceName + tenantSep + tenant + serviceMethod[dot:]); err == nil {
+			return svc, mtype, nil
+		}
+	}
+	if opt := server.tenancy.Load(); opt != nil && opt.Strict {
+		return nil, nil, &NotFoundError{Kind: "service", Name: serviceName}
+	}
+	return server.findService(serviceMethod)
+}
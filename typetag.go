@@ -0,0 +1,78 @@
+package geerpc
+
+import (
+	"fmt"
+	"geerpc/codec"
+	"reflect"
+)
+
+/**
+ * 接口类型的参数和响应
+ *
+ * 服务方法的参数或响应可以声明为接口，具体类型通过类型标签传递，与编解码方式无关：
+ *   geerpc.RegisterTag("shape.circle", Circle{})   //两端都要注册
+ *   func (g *Geo) Area(s Shape, reply *float64) error
+ *   func (g *Geo) Largest(q Query, reply *Shape) error
+ *   client.Call("Geo.Area", Circle{R: 2}, &area)
+ *   var s Shape
+ *   client.Call("Geo.Largest", q, &s)               //s 为 Circle
+ * 发送方的请求体类型注册了标签时，在请求头 BodyType 中带上标签；
+ * 接收方的参数或响应是接口时，按标签创建具体类型解码后放入接口，标签没有注册或没有实现接口时返回 InvalidArgumentError
+ * 结构体中的接口字段使用 codec.Any
+ */
+
+// 为具体类型注册类型标签，见 codec.RegisterTag
+func RegisterTag(tag string, value interface{}) error {
+	return codec.RegisterTag(tag, value)
+}
+
+// 发送前确定请求体和它的标签：v 是指向接口的指针时发送接口中的值，没有注册标签时标签为空、原样发送
+func taggedBody(v interface{}) (string, interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Interface && !rv.Elem().IsNil() {
+		if tag, ok := codec.TagOf(rv.Elem().Interface()); ok {
+			return tag, rv.Elem().Interface()
+		}
+		return "", v
+	}
+	tag, _ := codec.TagOf(v)
+	return tag, v
+}
+
+/**
+ * 按标签确定解码的目标：v 是指向接口的指针且 bodyType 不为空时，返回标签对应类型的新实例，
+ * 以及解码后把它放入接口的函数；其他情况原样返回 v
+ */
+func typedTarget(bodyType string, v interface{}) (interface{}, func(), error) {
+	if bodyType == "" {
+		return v, nil, nil
+	}
+	pv := reflect.ValueOf(v)
+	if pv.Kind() != reflect.Ptr || pv.IsNil() || pv.Elem().Kind() != reflect.Interface {
+		return v, nil, nil
+	}
+	t, ok := codec.TagType(bodyType)
+	if !ok {
+		return nil, nil, &codec.UnknownTagError{Tag: bodyType}
+	}
+	if !t.AssignableTo(pv.Elem().Type()) {
+		return nil, nil, fmt.Errorf("type %s (tag %q) does not implement %s", t, bodyType, pv.Elem().Type())
+	}
+	nv := reflect.New(t)
+	return nv.Interface(), func() { pv.Elem().Set(nv.Elem()) }, nil
+}
+
+// 客户端按响应的标签读响应体，标签无法使用时丢弃响应体，只让这一个调用失败
+func readTypedBody(cc codec.Codec, bodyType string, v interface{}) error {
+	target, assign, err := typedTarget(bodyType, v)
+	if err != nil {
+		if rerr := cc.ReadBody(nil); rerr != nil {
+			return rerr
+		}
+		return &codec.DecodeError{Err: err}
+	}
+	if err = cc.ReadBody(target); err == nil && assign != nil {
+		assign()
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package geerpc
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+/**
+ * unix domain socket 支持
+ *
+ * ListenUnix 会清理上次进程遗留的 socket 文件，并在 listener 关闭时自动删除
+ * AcceptUnix 可以读取对端进程的 uid/gid/pid（linux 下为 SO_PEERCRED），用于本机的权限校验；
+ * 服务方法也可以通过 PeerFromContext 得到的 Peer.Cred 读取，按调用方的身份做更细的校验：
+ *   func (s *Admin) Reload(ctx context.Context, args Args, reply *Reply) error {
+ *       if p, ok := geerpc.PeerFromContext(ctx); !ok || p.Cred == nil || p.Cred.Uid != 0 {
+ *           return errors.New("permission denied")
+ *       }
+ *       ...
+ *   }
+ */
+
+// 对端进程的凭证
+type PeerCred struct {
+	Pid int32
+	Uid uint32
+	Gid uint32
+}
+
+// 根据对端凭证做权限校验，返回错误则直接关闭连接
+type UnixAuthFunc func(cred *PeerCred) error
+
+var ErrPeerCredUnsupported = errors.New("rpc: peer credentials are not supported on this platform")
+
+// 监听 unix socket，已存在的 socket 文件会被删除
+func ListenUnix(path string) (*net.UnixListener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("rpc: " + path + " exists and is not a socket")
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(true) //关闭时删除 socket 文件
+	return l, nil
+}
+
+// 连接 unix socket 上的服务端
+func DialUnix(path string, opts ...DialOption) (*Client, error) {
+	return Dial("unix", path, opts...)
+}
+
+/**
+ * 接受 unix socket 连接，auth 不为空时先校验对端凭证再处理请求，返回值同 Accept
+ */
+func (server *Server) AcceptUnix(listener *net.UnixListener, auth UnixAuthFunc) error {
+	return server.serveListener(listener, func(conn net.Conn) {
+		if auth != nil {
+			cred, err := GetPeerCred(conn.(*net.UnixConn))
+			if err == nil {
+				err = auth(cred)
+			}
+			if err != nil {
+				server.logf("rpc server:unix peer rejected: %v", err)
+				_ = conn.Close()
+				return
+			}
+		}
+		server.ServeConn(conn)
+	})
+}
+
+func AcceptUnix(listener *net.UnixListener, auth UnixAuthFunc) error {
+	return DefaultServer.AcceptUnix(listener, auth)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package geerpc
+
+import "net"
+
+// 非 linux 平台暂不支持读取对端凭证
+func GetPeerCred(conn *net.UnixConn) (*PeerCred, error) {
+	return nil, ErrPeerCredUnsupported
+}
@@ -0,0 +1,64 @@
+package geerpc
+
+import (
+	"reflect"
+	"strings"
+)
+
+/**
+ * 参数校验
+ *
+ * 参数类型实现了 Validator 时，服务端在调用服务方法之前先调用 Validate，
+ * 还可以通过 SetValidator 设置一个对所有请求生效的校验函数（如基于 struct tag 的校验库）
+ * 校验失败时不调用服务方法，返回 InvalidArgumentError，客户端收到的也是 InvalidArgumentError，
+ * 这样每个服务方法不需要重复同样的检查，调用方也可以据此区分参数错误和其他错误
+ */
+
+type Validator interface {
+	Validate() error
+}
+
+// 对所有请求生效的校验函数，args 为解码后的参数
+type ValidatorFunc func(serviceMethod string, args interface{}) error
+
+const invalidArgumentPrefix = "rpc server: invalid argument: "
+
+type InvalidArgumentError struct {
+	Msg string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return invalidArgumentPrefix + e.Msg
+}
+
+// 设置对所有请求生效的校验函数，在参数自己的 Validate 之后调用，需要在 Accept 之前调用
+func (server *Server) SetValidator(fn ValidatorFunc) {
+	server.validator = fn
+}
+
+// 校验解码后的参数，参数为值类型时也检查它的指针是否实现了 Validator
+func (server *Server) validate(serviceMethod string, argv reflect.Value) error {
+	args := argv.Interface()
+	v, ok := args.(Validator)
+	if !ok && argv.Kind() != reflect.Ptr && argv.CanAddr() {
+		v, ok = argv.Addr().Interface().(Validator)
+	}
+	var err error
+	if ok {
+		err = v.Validate()
+	}
+	if err == nil && server.validator != nil {
+		err = server.validator(serviceMethod, args)
+	}
+	if err != nil {
+		return &InvalidArgumentError{Msg: err.Error()}
+	}
+	return nil
+}
+
+func parseInvalidArgument(msg string) (error, bool) {
+	if !strings.HasPrefix(msg, invalidArgumentPrefix) {
+		return nil, false
+	}
+	return &InvalidArgumentError{Msg: strings.TrimPrefix(msg, invalidArgumentPrefix)}, true
+}
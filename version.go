@@ -0,0 +1,53 @@
+package geerpc
+
+import (
+	"errors"
+	"strings"
+)
+
+/**
+ * 服务版本和方法别名
+ *
+ * 版本：同一个服务的不同版本以 "User.v2" 这样的名字注册（RegisterName），
+ * 客户端在 Option.Version 中固定版本后，每个请求头都带上版本，服务端把 "User.Get" 解析为 "User.v2.Get"
+ * 别名：滚动升级时把旧的 ServiceMethod 映射到新的实现，如 Alias("User.GetName", "User.v2.FetchName")
+ */
+
+// 为 ServiceMethod 设置别名，from 和 to 都是完整的 "Service.Method"，调用 from 时实际调用 to
+func (server *Server) Alias(from, to string) error {
+	if strings.LastIndex(from, ".") <= 0 || strings.LastIndex(to, ".") <= 0 {
+		return errors.New("rpc: alias must be in the form Service.Method")
+	}
+	server.aliases.Store(from, to)
+	return nil
+}
+
+// 删除别名
+func (server *Server) RemoveAlias(from string) {
+	server.aliases.Delete(from)
+}
+
+func Alias(from, to string) error {
+	return DefaultServer.Alias(from, to)
+}
+
+/**
+ * 按别名和版本解析出实际的 ServiceMethod 后查找服务
+ * 先应用版本：请求头带版本且服务名没有包含该版本时，在服务名后追加 ".版本"
+ * 再应用别名：别名可以指向任意版本的方法
+ * 最后按租户查找，见 RegisterTenant
+ */
+func (server *Server) lookupService(serviceMethod, version, tenant string) (*service, *methodType, error) {
+	if version != "" {
+		if dot := strings.LastIndex(serviceMethod, "."); dot > 0 {
+			serviceName := serviceMethod[:dot]
+			if !strings.HasSuffix(serviceName, "."+version) {
+				serviceMethod = serviceName + "." + version + serviceMethod[dot:]
+			}
+		}
+	}
+	if to, ok := server.aliases.Load(serviceMethod); ok {
+		serviceMethod = to.(string)
+	}
+	return server.findTenantService(serviceMethod, tenant)
+}
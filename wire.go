@@ -0,0 +1,44 @@
+package geerpc
+
+import (
+	"encoding/json"
+	"io"
+)
+
+/**
+ * 线上协议
+ *
+ * 不依赖 Go 的实现细节，其他语言按下面的格式读写即可接入（参考实现见 contrib/python）
+ *
+ * 1. 握手：客户端连接后先发送一个 JSON 对象（Option），以换行符结尾，服务端不回复：
+ *      {"MagicNumber":213586,"CodecType":"application/json","Flags":0}\n
+ *    MagicNumber 固定为 0x34252；CodecType 见 codec 包的 Type 常量；
+ *    Flags 见 FlagChecksum 等常量，其他语言的客户端通常为0；其余字段都是可选的
+ *
+ * 2. 消息：之后的数据由编解码器决定，每个请求和响应都是一个请求头加一个请求体，
+ *    JSON 编解码时请求头和请求体各是一个 JSON 值，以换行符分隔：
+ *      {"ServiceMethod":"Foo.Sum","Seq":1}\n{"Num1":1,"Num2":2}\n
+ *    请求头的字段（codec.Header）：
+ *      ServiceMethod  "服务.方法"
+ *      Seq            请求编号，响应带回同样的编号，客户端据此匹配；同一个连接上不能重复
+ *      Error          响应的错误信息，不为空时请求体没有意义（通常为 {}）
+ *      Deadline       调用方的绝对截止时间，Unix 纳秒，0表示没有
+ *      Version        指定的服务版本，为空表示不指定
+ *      Priority       优先级，越大越优先
+ *      Meta           字符串到字符串的元数据
+ *      Callback       服务端回调客户端的请求和它的响应为 true，见 callback.go
+ *      BodyType       请求体具体类型的标签，参数或响应声明为接口时使用，见 typetag.go
+ *    除 ServiceMethod 和 Seq 外都可以省略，接收方必须忽略不认识的字段
+ *
+ *    Flags 中设置了 FlagChunked 时，请求头和请求体合成一个消息后分块发送，格式见 codec/chunk.go
+ *
+ * 3. 取消：ServiceMethod 为 CancelServiceMethod、Seq 为被取消的请求编号的消息，请求体为空值（JSON 为 {}），服务端忽略请求体，不回复
+ *
+ * 响应的顺序与请求的顺序无关，客户端可以在一个连接上同时发出多个请求
+ */
+
+// 客户端握手：写入 Option，之后的数据由 opt.CodecType 对应的编解码器处理
+func WriteHandshake(w io.Writer, opt *Option) error {
+	//json.Encoder 在对象后面追加换行符，即协议中的分隔符
+	return json.NewEncoder(w).Encode(opt)
+}
@@ -0,0 +1,219 @@
+package geerpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"geerpc/codec"
+	"net"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+ * 线上协议的一致性测试，见 wire.go
+ * golden 字节固定了 JSON 编解码时握手、请求头和取消消息的格式，修改这些格式会影响其他语言的客户端，
+ * 需要同时更新 wire.go 和 contrib 中的客户端；有 python3 时还会用 contrib/python 的客户端调用真实的服务端
+ */
+
+type WireFoo int
+
+type WireArgs struct{ Num1, Num2 int }
+
+func (f WireFoo) Sum(args WireArgs, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// 等待取消，取消后通知 wireCancelled
+var wireCancelled = make(chan struct{}, 1)
+
+func (f WireFoo) Wait(ctx context.Context, args WireArgs, reply *int) error {
+	<-ctx.Done()
+	wireCancelled <- struct{}{}
+	return ctx.Err()
+}
+
+func newWireServer(t *testing.T) *Server {
+	t.Helper()
+	server := NewServer()
+	if err := server.Register(new(WireFoo)); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestWireHandshakeGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHandshake(&buf, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType, Flags: FlagCallbacks}); err != nil {
+		t.Fatal(err)
+	}
+	const golden = `{"MagicNumber":213586,"CodecType":"application/json","Version":"","ClientID":"","SessionID":"","Flags":8,"CompressThreshold":0,"ChunkSize":0}` + "\n"
+	if buf.String() != golden {
+		t.Fatalf("handshake:\n got %s\nwant %s", buf.String(), golden)
+	}
+	//服务端读取握手后，同一个包里紧跟的请求不能丢失
+	buf.WriteString(`{"ServiceMethod":"WireFoo.Sum","Seq":1}` + "\n")
+	opt, cc, err := Handshake(nopCloser{&buf}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.MagicNumber != MagicNumber || opt.CodecType != codec.JsonType || opt.Flags != FlagCallbacks {
+		t.Fatalf("handshake decoded as %+v", opt)
+	}
+	var h codec.Header
+	if err = cc.ReadHeader(&h); err != nil || h.ServiceMethod != "WireFoo.Sum" || h.Seq != 1 {
+		t.Fatalf("header after handshake: %+v, %v", h, err)
+	}
+}
+
+func TestWireHeaderGolden(t *testing.T) {
+	var buf bytes.Buffer
+	cc := codec.NewJsonCodec(nopCloser{&buf})
+	h := &codec.Header{
+		ServiceMethod: "WireFoo.Sum",
+		Seq:           7,
+		Deadline:      1700000000000000000,
+		Version:       "v2",
+		Priority:      3,
+		Meta:          map[string]string{"k": "v"},
+		BodyType:      "wire.Args",
+	}
+	if err := cc.Write(h, WireArgs{Num1: 1, Num2: 2}); err != nil {
+		t.Fatal(err)
+	}
+	const golden = `{"ServiceMethod":"WireFoo.Sum","Seq":7,"Error":"","Deadline":1700000000000000000,"Version":"v2","Priority":3,"Meta":{"k":"v"},"Callback":false,"BodyType":"wire.Args"}` + "\n" +
+		`{"Num1":1,"Num2":2}` + "\n"
+	if buf.String() != golden {
+		t.Fatalf("header:\n got %s\nwant %s", buf.String(), golden)
+	}
+	var got codec.Header
+	var args WireArgs
+	if err := cc.ReadHeader(&got); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.ReadBody(&args); err != nil {
+		t.Fatal(err)
+	}
+	if got.ServiceMethod != h.ServiceMethod || got.Seq != h.Seq || got.Deadline != h.Deadline || got.Version != h.Version ||
+		got.Priority != h.Priority || got.Meta["k"] != "v" || got.BodyType != h.BodyType || args != (WireArgs{1, 2}) {
+		t.Fatalf("round trip: %+v %+v", got, args)
+	}
+}
+
+// 客户端取消调用时发送的消息
+func TestWireCancelGolden(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer func() { _ = c2.Close() }()
+	go func() {
+		client, err := NewClient(c1, &Option{MagicNumber: MagicNumber, CodecType: codec.JsonType})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() { _ = client.Close() }()
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_ = client.CallContext(ctx, "WireFoo.Wait", WireArgs{}, new(int))
+	}()
+	const golden = `{"ServiceMethod":"geerpc.Cancel","Seq":1,"Error":"","Deadline":0,"Version":"","Priority":0,"Meta":null,"Callback":false,"BodyType":""}` + "\n" +
+		`{}` + "\n"
+	r := bufio.NewReader(c2)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no cancel message: %v", err)
+		}
+		if !strings.Contains(line, CancelServiceMethod) {
+			continue
+		}
+		body, _ := r.ReadString('\n')
+		if line+body != golden {
+			t.Fatalf("cancel:\n got %s\nwant %s", line+body, golden)
+		}
+		return
+	}
+}
+
+// 按 wire.go 中最简的格式手写字节与服务端交互
+func TestWireServerRawJSON(t *testing.T) {
+	server := newWireServer(t)
+	c1, c2 := net.Pipe()
+	go server.ServeConn(c2)
+	defer func() { _ = c1.Close() }()
+	_, err := c1.Write([]byte(`{"MagicNumber":213586,"CodecType":"application/json","Flags":0}` + "\n" +
+		`{"ServiceMethod":"WireFoo.Sum","Seq":1}` + "\n" + `{"Num1":1,"Num2":2}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(c1)
+	var h codec.Header
+	var reply int
+	if err = dec.Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if h.ServiceMethod != "WireFoo.Sum" || h.Seq != 1 || h.Error != "" || reply != 3 {
+		t.Fatalf("reply: %+v %d", h, reply)
+	}
+
+	//取消：服务方法的 context 被取消，服务端不再回复
+	_, err = c1.Write([]byte(`{"ServiceMethod":"WireFoo.Wait","Seq":2}` + "\n" + `{}` + "\n" +
+		`{"ServiceMethod":"geerpc.Cancel","Seq":2}` + "\n" + `{}` + "\n" +
+		`{"ServiceMethod":"WireFoo.Sum","Seq":3}` + "\n" + `{"Num1":2,"Num2":2}` + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-wireCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancel message did not cancel the call")
+	}
+	if err = dec.Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if h.Seq != 3 || reply != 4 {
+		t.Fatalf("reply after cancel: %+v %d", h, reply)
+	}
+}
+
+// 用 contrib/python 的参考客户端调用服务端，没有 python3 时跳过
+func TestWirePythonClient(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not found")
+	}
+	server := newWireServer(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Accept(l) }()
+	defer func() { _ = server.Close() }()
+
+	out, err := exec.Command(python, "contrib/python/tinyrpc_client.py", l.Addr().String(), "WireFoo.Sum", `{"Num1":20,"Num2":22}`).CombinedOutput()
+	if err != nil {
+		t.Fatalf("python client: %v\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "42" {
+		t.Fatalf("python client got %q", got)
+	}
+	out, err = exec.Command(python, "contrib/python/tinyrpc_client.py", l.Addr().String(), "WireFoo.Missing", `{}`).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "RPCError") {
+		t.Fatalf("python client should fail on unknown method: %v\n%s", err, out)
+	}
+}
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,153 @@
+package xclient
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * 加权轮询和基于延迟的负载均衡
+ *
+ * 加权轮询使用 nginx 的平滑加权轮询：每次选择时所有实例的 current 加上自身权重，
+ * 选 current 最大的实例，再把它的 current 减去总权重，这样权重高的实例不会被连续选中
+ *
+ * 最低负载使用 peak-EWMA：记录每个实例延迟的指数加权平均，新的延迟比平均值大时直接取新值（对变慢敏感），
+ * 负载 = 延迟 * (在途请求数 + 1) / 成功率，随机取两个实例选负载低的那个（power of two choices），
+ * 从未调用过的实例负载为0，会被优先探测
+ */
+
+// 平滑加权轮询的状态
+type weightedRR struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func newWeightedRR() *weightedRR {
+	return &weightedRR{current: make(map[string]int)}
+}
+
+func (w *weightedRR) pick(servers []ServerInfo) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoAvailableServers
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	total, best := 0, -1
+	alive := make(map[string]int, len(servers))
+	for i, s := range servers {
+		weight := s.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		total += weight
+		alive[s.Addr] = w.current[s.Addr] + weight
+		if best < 0 || alive[s.Addr] > alive[servers[best].Addr] {
+			best = i
+		}
+	}
+	addr := servers[best].Addr
+	alive[addr] -= total
+	w.current = alive //下线的实例不再保留状态
+	return addr, nil
+}
+
+const (
+	ewmaDecay    = 10 * time.Second //延迟平均值的衰减时间常数
+	errRateDecay = 0.9              //错误率的衰减系数，越大越平滑
+)
+
+// 一个实例的观测数据
+type nodeStats struct {
+	ewma     float64   //延迟的指数加权平均，单位纳秒
+	errRate  float64   //错误率的指数加权平均
+	inflight int64     //在途请求数
+	last     time.Time //上次观测的时间
+}
+
+// 各个实例的延迟和错误率
+type loadStats struct {
+	mu    sync.Mutex
+	r     *rand.Rand
+	nodes map[string]*nodeStats
+}
+
+func newLoadStats() *loadStats {
+	return &loadStats{
+		r:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		nodes: make(map[string]*nodeStats),
+	}
+}
+
+func (l *loadStats) node(addr string) *nodeStats {
+	n, ok := l.nodes[addr]
+	if !ok {
+		n = &nodeStats{}
+		l.nodes[addr] = n
+	}
+	return n
+}
+
+// 调用开始
+func (l *loadStats) start(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.node(addr).inflight++
+}
+
+// 调用结束，记录延迟和是否出错
+func (l *loadStats) done(addr string, latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.node(addr)
+	n.inflight--
+	now := time.Now()
+	rtt := float64(latency)
+	if rtt > n.ewma || n.last.IsZero() {
+		n.ewma = rtt //peak：变慢时立即反映
+	} else {
+		w := math.Exp(-float64(now.Sub(n.last)) / float64(ewmaDecay))
+		n.ewma = n.ewma*w + rtt*(1-w)
+	}
+	failed := 0.0
+	if err != nil {
+		failed = 1
+	}
+	n.errRate = n.errRate*errRateDecay + failed*(1-errRateDecay)
+	n.last = now
+}
+
+func (n *nodeStats) cost() float64 {
+	return n.ewma * float64(n.inflight+1) / math.Max(1-n.errRate, 0.01)
+}
+
+// 错误率不超过 maxErrRate 的实例是健康的
+// 不健康的实例不会再被选中，错误率也就不会更新，所以一段时间没有调用后重新认为健康，让它有机会被探测
+func (l *loadStats) healthy(addr string, maxErrRate float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, ok := l.nodes[addr]
+	return !ok || n.errRate <= maxErrRate || time.Since(n.last) > ewmaDecay
+}
+
+func (l *loadStats) pick(servers []ServerInfo) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoAvailableServers
+	}
+	if len(servers) == 1 {
+		return servers[0].Addr, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := l.r.Intn(len(servers))
+	j := l.r.Intn(len(servers) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := servers[i].Addr, servers[j].Addr
+	if l.node(b).cost() < l.node(a).cost() {
+		return b, nil
+	}
+	return a, nil
+}
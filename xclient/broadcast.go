@@ -0,0 +1,98 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+)
+
+/**
+ * 广播和分散-聚合调用
+ *
+ * Broadcast 并发调用所有实例，返回每个实例的响应和错误，
+ * 默认等待所有实例都成功才算成功，可以通过 Quorum/FirstSuccess 设置成功数达到要求后取消其余调用
+ * 适用于缓存失效通知、分片查询汇总等场景
+ */
+
+// 单个实例的调用结果
+type BroadcastResult struct {
+	Addr  string
+	Reply interface{} //由 replyFactory 创建，调用失败时为零值
+	Err   error
+}
+
+type BroadcastOption func(*broadcastOptions)
+
+type broadcastOptions struct {
+	quorum int //成功数达到 quorum 即可返回，0 表示需要全部成功
+}
+
+// 成功数达到 n 后取消其余调用
+func Quorum(n int) BroadcastOption {
+	return func(o *broadcastOptions) {
+		o.quorum = n
+	}
+}
+
+// 任意一个实例成功后取消其余调用
+func FirstSuccess() BroadcastOption {
+	return Quorum(1)
+}
+
+/**
+ * 并发调用所有实例，replyFactory 为每个实例创建一个 reply（如 func() interface{} { return new(Reply) }）
+ * 返回的结果与实例一一对应；成功数没有达到要求时同时返回错误
+ */
+func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args interface{},
+	replyFactory func() interface{}, opts ...BroadcastOption) ([]BroadcastResult, error) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, ErrNoAvailableServers
+	}
+	var o broadcastOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	quorum := o.quorum
+	if quorum <= 0 || quorum > len(servers) {
+		quorum = len(servers)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type indexed struct {
+		i   int
+		err error
+	}
+	results := make([]BroadcastResult, len(servers))
+	done := make(chan indexed, len(servers))
+	for i, rpcAddr := range servers {
+		results[i] = BroadcastResult{Addr: rpcAddr, Reply: replyFactory()}
+		go func(i int, rpcAddr string) {
+			done <- indexed{i: i, err: xc.call(rpcAddr, ctx, serviceMethod, args, results[i].Reply)}
+		}(i, rpcAddr)
+	}
+
+	var succeeded int
+	var firstErr error
+	for range servers {
+		r := <-done
+		results[r.i].Err = r.err
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		succeeded++
+		if succeeded == quorum {
+			cancel() //达到要求，取消其余调用
+		}
+	}
+	if succeeded < quorum {
+		return results, fmt.Errorf("rpc xclient: broadcast got %d/%d successes: %w", succeeded, quorum, firstErr)
+	}
+	return results, nil
+}
@@ -0,0 +1,55 @@
+package xclient
+
+import (
+	"fmt"
+	. "geerpc"
+)
+
+/**
+ * 按配置文件创建负载均衡客户端，配置格式见 geerpc.LoadConfig
+ * 设置了 Registry 时从注册中心发现实例，否则使用 Servers 中的静态列表；连接选项使用 cfg.Client
+ */
+
+var selectModes = map[string]SelectMode{
+	"":               RandomSelect,
+	"random":         RandomSelect,
+	"roundrobin":     RoundRobinSelect,
+	"consistenthash": ConsistentHashSelect,
+	"weighted":       WeightedRoundRobinSelect,
+	"leastloaded":    LeastLoadedSelect,
+}
+
+var failModes = map[string]FailMode{
+	"":         Failfast,
+	"failfast": Failfast,
+	"failover": Failover,
+	"failtry":  Failtry,
+}
+
+func NewXClientFromConfig(cfg *Config) (*XClient, error) {
+	c := cfg.XClient
+	mode, ok := selectModes[c.Select]
+	if !ok {
+		return nil, fmt.Errorf("rpc config: unknown select mode %q", c.Select)
+	}
+	failMode, ok := failModes[c.FailMode]
+	if !ok {
+		return nil, fmt.Errorf("rpc config: unknown fail mode %q", c.FailMode)
+	}
+	opt, err := cfg.Client.Option()
+	if err != nil {
+		return nil, err
+	}
+	var d Discovery
+	switch {
+	case c.Registry != "":
+		d = NewGeeRegistryDiscovery(c.Registry, 0)
+	case len(c.Servers) > 0:
+		d = NewMultiServerDiscovery(append([]string(nil), c.Servers...))
+	default:
+		return nil, fmt.Errorf("rpc config: xclient requires servers or registry")
+	}
+	xc := NewXClient(d, mode, opt)
+	xc.SetFailMode(failMode, c.Retries)
+	return xc, nil
+}
@@ -0,0 +1,147 @@
+package xclient
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * 服务发现
+ *
+ * 客户端通过 Discovery 拿到可用的服务实例地址，地址格式为 protocol@addr，如 tcp@127.0.0.1:9999
+ * 再按照负载均衡策略选择一个实例发起调用
+ */
+
+type SelectMode int
+
+const (
+	RandomSelect             SelectMode = iota //随机选择
+	RoundRobinSelect                           //轮询
+	ConsistentHashSelect                       //一致性哈希，相同的 key 总是落到同一个实例上
+	WeightedRoundRobinSelect                   //按静态权重平滑轮询
+	LeastLoadedSelect                          //按观测到的延迟(peak-EWMA)、错误率和在途请求数选择负载最低的实例
+)
+
+type Discovery interface {
+	Refresh() error                      //从注册中心更新服务列表
+	Update(servers []string) error       //手动更新服务列表
+	Get(mode SelectMode) (string, error) //根据负载均衡策略选择一个实例
+	GetAll() ([]string, error)           //返回所有实例
+}
+
+var ErrNoAvailableServers = errors.New("rpc discovery: no available servers")
+
+// 服务实例的信息，Weight 小于等于0时按1处理
+type ServerInfo struct {
+	Addr   string
+	Weight int
+	Meta   map[string]string
+}
+
+// 可以提供实例权重和元数据的服务发现，未实现时所有实例权重为1
+type InfoDiscovery interface {
+	GetAllInfo() ([]ServerInfo, error)
+}
+
+// 从服务发现中获取实例信息
+func getAllInfo(d Discovery) ([]ServerInfo, error) {
+	if id, ok := d.(InfoDiscovery); ok {
+		return id.GetAllInfo()
+	}
+	servers, err := d.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ServerInfo, len(servers))
+	for i, s := range servers {
+		infos[i] = ServerInfo{Addr: s, Weight: 1}
+	}
+	return infos, nil
+}
+
+// 不需要注册中心，服务列表由用户手动维护的服务发现
+type MultiServersDiscovery struct {
+	r       *rand.Rand   //生成随机数
+	mu      sync.RWMutex //保护以下字段
+	servers []string
+	weights map[string]int //实例权重，未设置时为1
+	index   int            //轮询到的位置，初始化为随机值避免每次都从0开始
+}
+
+var (
+	_ Discovery     = (*MultiServersDiscovery)(nil)
+	_ InfoDiscovery = (*MultiServersDiscovery)(nil)
+)
+
+func NewMultiServerDiscovery(servers []string) *MultiServersDiscovery {
+	d := &MultiServersDiscovery{
+		servers: servers,
+		weights: make(map[string]int),
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	d.index = d.r.Intn(math.MaxInt32 - 1)
+	return d
+}
+
+// 手动维护的列表不需要刷新
+func (d *MultiServersDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *MultiServersDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	return nil
+}
+
+func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.servers)
+	if n == 0 {
+		return "", ErrNoAvailableServers
+	}
+	switch mode {
+	case RandomSelect:
+		return d.servers[d.r.Intn(n)], nil
+	case RoundRobinSelect:
+		s := d.servers[d.index%n] //服务列表可能更新，所以取模
+		d.index = (d.index + 1) % n
+		return s, nil
+	default:
+		return "", errors.New("rpc discovery: not supported select mode")
+	}
+}
+
+func (d *MultiServersDiscovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	servers := make([]string, len(d.servers))
+	copy(servers, d.servers)
+	return servers, nil
+}
+
+// 设置实例的权重
+func (d *MultiServersDiscovery) SetWeight(server string, weight int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.weights[server] = weight
+}
+
+func (d *MultiServersDiscovery) GetAllInfo() ([]ServerInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	infos := make([]ServerInfo, len(d.servers))
+	for i, s := range d.servers {
+		w, ok := d.weights[s]
+		if !ok {
+			w = 1
+		}
+		infos[i] = ServerInfo{Addr: s, Weight: w}
+	}
+	return infos, nil
+}
@@ -0,0 +1,175 @@
+package xclient
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * 基于 DNS 的服务发现
+ *
+ * 定期解析一个域名得到服务实例，适用于 Kubernetes headless service 和传统的 DNS 轮询，不需要注册中心
+ * A/AAAA 模式：解析 host 得到所有 IP，与固定端口组成实例地址
+ * SRV 模式：解析 _service._proto.name 得到 target:port，SRV 记录的权重作为实例权重
+ * 与注册中心的服务发现一样，在 Get/GetAll 时发现超过 interval 没有刷新就重新解析
+ * 解析失败时继续使用上一次的结果，按指数退避（最长 interval）再重试，DNS 不可用时不会每次调用都去解析；
+ * 已经有结果时，其他调用正在解析就直接使用已有的结果，不排队等待
+ */
+
+const defaultDNSRefreshInterval = 30 * time.Second
+
+// 解析失败后第一次重试的间隔，之后每次失败翻倍，最长为刷新间隔
+const minDNSRetryInterval = time.Second
+
+type DNSDiscovery struct {
+	*MultiServersDiscovery
+	protocol string //实例地址的协议，如 tcp
+	host     string //A/AAAA 模式下的域名
+	port     string //A/AAAA 模式下的端口
+	srv      bool   //是否为 SRV 模式
+	service  string //SRV 模式下的服务名、协议和域名
+	proto    string
+	name     string
+	resolver *net.Resolver
+	interval time.Duration
+
+	refreshMu sync.Mutex //保证同一时间只有一个刷新，保护以下字段
+	next      time.Time  //下次解析的时间
+	failures  int        //连续解析失败的次数
+	lastErr   error      //上一次解析的错误，成功时为nil
+}
+
+var _ Discovery = (*DNSDiscovery)(nil)
+
+// 解析 host 的 A/AAAA 记录，实例地址为 protocol@ip:port
+func NewDNSDiscovery(protocol, host, port string, interval time.Duration) *DNSDiscovery {
+	return newDNSDiscovery(&DNSDiscovery{protocol: protocol, host: host, port: port}, interval)
+}
+
+// 解析 _service._proto.name 的 SRV 记录，实例地址为 protocol@target:port
+func NewDNSSRVDiscovery(protocol, service, proto, name string, interval time.Duration) *DNSDiscovery {
+	return newDNSDiscovery(&DNSDiscovery{protocol: protocol, srv: true, service: service, proto: proto, name: name}, interval)
+}
+
+func newDNSDiscovery(d *DNSDiscovery, interval time.Duration) *DNSDiscovery {
+	if interval == 0 {
+		interval = defaultDNSRefreshInterval
+	}
+	d.MultiServersDiscovery = NewMultiServerDiscovery(make([]string, 0))
+	d.resolver = net.DefaultResolver
+	d.interval = interval
+	return d
+}
+
+// 到了解析的时间就重新解析，失败时保留上一次的结果；还没到重试时间时返回上一次的错误
+func (d *DNSDiscovery) Refresh() error {
+	d.refreshMu.Lock()
+	defer d.refreshMu.Unlock()
+	return d.refreshLocked()
+}
+
+// 调用时需要持有 refreshMu
+func (d *DNSDiscovery) refreshLocked() error {
+	now := time.Now()
+	if now.Before(d.next) {
+		return d.lastErr
+	}
+	if d.lastErr = d.resolve(); d.lastErr != nil {
+		backoff := minDNSRetryInterval << d.failures
+		if backoff <= 0 || backoff > d.interval {
+			backoff = d.interval
+		} else {
+			d.failures++
+		}
+		d.next = now.Add(backoff)
+		return d.lastErr
+	}
+	d.failures = 0
+	d.next = now.Add(d.interval)
+	return nil
+}
+
+// Get 等调用前刷新：已经有结果时，其他调用正在解析就不等待
+func (d *DNSDiscovery) refreshForCall() error {
+	if d.empty() {
+		return d.Refresh()
+	}
+	if !d.refreshMu.TryLock() {
+		return nil
+	}
+	defer d.refreshMu.Unlock()
+	return d.refreshLocked()
+}
+
+func (d *DNSDiscovery) resolve() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var servers []string
+	weights := make(map[string]int)
+	if d.srv {
+		_, records, err := d.resolver.LookupSRV(ctx, d.service, d.proto, d.name)
+		if err != nil {
+			log.Println("rpc dns discovery: lookup srv error:", err)
+			return err
+		}
+		for _, r := range records {
+			host := strings.TrimSuffix(r.Target, ".")
+			addr := d.protocol + "@" + net.JoinHostPort(host, strconv.Itoa(int(r.Port)))
+			servers = append(servers, addr)
+			weights[addr] = int(r.Weight)
+		}
+	} else {
+		ips, err := d.resolver.LookupIPAddr(ctx, d.host)
+		if err != nil {
+			log.Println("rpc dns discovery: lookup host error:", err)
+			return err
+		}
+		for _, ip := range ips {
+			servers = append(servers, d.protocol+"@"+net.JoinHostPort(ip.String(), d.port))
+		}
+	}
+	_ = d.MultiServersDiscovery.Update(servers)
+	for addr, w := range weights {
+		d.MultiServersDiscovery.SetWeight(addr, w)
+	}
+	return nil
+}
+
+// 手动设置的实例在下次刷新时会被解析结果覆盖
+func (d *DNSDiscovery) Update(servers []string) error {
+	d.refreshMu.Lock()
+	defer d.refreshMu.Unlock()
+	d.next, d.failures, d.lastErr = time.Now().Add(d.interval), 0, nil
+	return d.MultiServersDiscovery.Update(servers)
+}
+
+func (d *DNSDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.refreshForCall(); err != nil && d.empty() {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *DNSDiscovery) GetAll() ([]string, error) {
+	if err := d.refreshForCall(); err != nil && d.empty() {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
+
+func (d *DNSDiscovery) GetAllInfo() ([]ServerInfo, error) {
+	if err := d.refreshForCall(); err != nil && d.empty() {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAllInfo()
+}
+
+func (d *DNSDiscovery) empty() bool {
+	servers, _ := d.MultiServersDiscovery.GetAll()
+	return len(servers) == 0
+}
@@ -0,0 +1,103 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	. "geerpc"
+)
+
+/**
+ * 失败处理策略
+ *
+ * Failfast 失败后直接返回错误
+ * Failover 失败后换一个实例重试，最多重试 retries 次
+ * Failtry  失败后在同一个实例上重试，最多重试 retries 次
+ *
+ * 只对连接错误重试，服务端返回的错误（ServerError）说明请求已经被处理，直接返回
+ * 服务端过载（OverloadedError）时请求没有被处理，可以重试；在同一个实例上重试时先等待服务端建议的间隔
+ * 非幂等的方法只有在请求确定没有发出（建立连接失败）时才会重试，避免重复执行，
+ * 通过 SetIdempotent 标记可以安全重试的方法
+ */
+
+type FailMode int
+
+const (
+	Failfast FailMode = iota
+	Failover
+	Failtry
+)
+
+type failModeKey struct{}
+
+// 为单次调用指定失败处理策略，覆盖 XClient 的设置
+func WithFailMode(ctx context.Context, mode FailMode) context.Context {
+	return context.WithValue(ctx, failModeKey{}, mode)
+}
+
+func (xc *XClient) failModeFrom(ctx context.Context) FailMode {
+	if mode, ok := ctx.Value(failModeKey{}).(FailMode); ok {
+		return mode
+	}
+	return xc.failMode
+}
+
+// 设置默认的失败处理策略和重试次数
+func (xc *XClient) SetFailMode(mode FailMode, retries int) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.failMode = mode
+	xc.retries = retries
+}
+
+// 标记可以安全重试的方法（"Service.Method"）
+func (xc *XClient) SetIdempotent(serviceMethods ...string) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for _, m := range serviceMethods {
+		xc.idempotent[m] = true
+	}
+}
+
+func (xc *XClient) isIdempotent(serviceMethod string) bool {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return xc.idempotent[serviceMethod]
+}
+
+// 请求没有发出去就失败了，任何方法都可以安全重试
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string { return e.err.Error() }
+func (e *dialError) Unwrap() error { return e.err }
+
+// 判断一次失败的调用能否重试
+func (xc *XClient) retryable(ctx context.Context, serviceMethod string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var overloaded *OverloadedError
+	if errors.As(err, &overloaded) {
+		return true
+	}
+	var serverErr ServerError
+	var invalid *InvalidArgumentError
+	var notFound *NotFoundError
+	var internal *InternalError
+	if errors.As(err, &serverErr) || errors.As(err, &invalid) || errors.As(err, &notFound) || errors.As(err, &internal) || errors.Is(err, ErrNoHashKey) || errors.Is(err, ErrNoAvailableServers) {
+		return false
+	}
+	//ErrShutdown 说明连接已经不可用，ErrTooManyPending 说明实例积压了太多调用，请求都没有发出
+	var de *dialError
+	return errors.As(err, &de) || errors.Is(err, ErrShutdown) || errors.Is(err, ErrTooManyPending) || xc.isIdempotent(serviceMethod)
+}
+
+// 服务端过载时等待它建议的间隔，ctx 结束时返回 false
+func waitRetryAfter(ctx context.Context, clock Clock, err error) bool {
+	var overloaded *OverloadedError
+	if !errors.As(err, &overloaded) || overloaded.RetryAfter <= 0 {
+		return true
+	}
+	return Sleep(ctx, clock, overloaded.RetryAfter)
+}
@@ -0,0 +1,228 @@
+package xclient
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+/**
+ * 基于本地文件的服务发现
+ *
+ * 从 JSON 或 YAML 文件中加载实例地址和权重，没有注册中心的部署也可以在线更新实例列表
+ * 文件格式为实例数组，元素可以是地址字符串，也可以是带权重和元数据的对象：
+ *   ["tcp@10.0.0.1:9999", {"addr": "tcp@10.0.0.2:9999", "weight": 3, "meta": {"zone": "a"}}]
+ * 扩展名为 .yaml/.yml 时按 YAML 解析，其他按 JSON 解析：
+ *   - tcp@10.0.0.1:9999
+ *   - addr: tcp@10.0.0.2:9999
+ *     weight: 3
+ *     meta: {zone: a}
+ * 后台按 interval 读取文件，内容变化后重新加载，加载失败时保留上一次的结果
+ * 手动 Update 和 SetWeight 的结果会在文件下一次变化时被覆盖
+ */
+
+const defaultFilePollInterval = 2 * time.Second
+
+type FileDiscovery struct {
+	*MultiServersDiscovery
+	path     string
+	interval time.Duration
+
+	mu    sync.RWMutex
+	infos []ServerInfo
+	sum   [sha256.Size]byte //上一次加载的文件内容的摘要
+
+	done chan struct{}
+	once sync.Once
+}
+
+var (
+	_ Discovery     = (*FileDiscovery)(nil)
+	_ InfoDiscovery = (*FileDiscovery)(nil)
+)
+
+// 加载 path 并开始监听文件变化，interval 为 0 时使用默认值
+func NewFileDiscovery(path string, interval time.Duration) (*FileDiscovery, error) {
+	if interval == 0 {
+		interval = defaultFilePollInterval
+	}
+	d := &FileDiscovery{
+		MultiServersDiscovery: NewMultiServerDiscovery(make([]string, 0)),
+		path:                  path,
+		interval:              interval,
+		done:                  make(chan struct{}),
+	}
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	go d.poll()
+	return d, nil
+}
+
+// 文件中的一个实例，既可以是字符串也可以是对象
+type fileServer ServerInfo
+
+// 对象形式的实例
+type fileServerObject struct {
+	Addr   string            `json:"addr" yaml:"addr"`
+	Weight int               `json:"weight" yaml:"weight"`
+	Meta   map[string]string `json:"meta" yaml:"meta"`
+}
+
+func (v fileServerObject) server() (fileServer, error) {
+	if v.Addr == "" {
+		return fileServer{}, errors.New("rpc file discovery: server without addr")
+	}
+	return fileServer{Addr: v.Addr, Weight: v.Weight, Meta: v.Meta}, nil
+}
+
+func (s *fileServer) UnmarshalJSON(data []byte) error {
+	var addr string
+	if err := json.Unmarshal(data, &addr); err == nil {
+		*s = fileServer{Addr: addr, Weight: 1}
+		return nil
+	}
+	var v fileServerObject
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var err error
+	*s, err = v.server()
+	return err
+}
+
+func (s *fileServer) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = fileServer{Addr: node.Value, Weight: 1}
+		return nil
+	}
+	var v fileServerObject
+	if err := node.Decode(&v); err != nil {
+		return err
+	}
+	var err error
+	*s, err = v.server()
+	return err
+}
+
+// .yaml/.yml 按 YAML 解析，其他按 JSON 解析
+func parseServers(path string, data []byte) ([]fileServer, error) {
+	var list []fileServer
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &list)
+	default:
+		err = json.Unmarshal(data, &list)
+	}
+	return list, err
+}
+
+/*
+文件内容有变化时重新加载
+按内容而不是修改时间判断，修改时间精度内大小不变的改写也能发现
+*/
+func (d *FileDiscovery) Refresh() error {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	d.mu.Lock()
+	unchanged := sum == d.sum
+	//加载失败时也记录下来，文件再次变化前不重复加载
+	d.sum = sum
+	d.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	list, err := parseServers(d.path, data)
+	if err != nil {
+		return err
+	}
+	infos := make([]ServerInfo, len(list))
+	for i, s := range list {
+		infos[i] = ServerInfo(s)
+	}
+	d.setInfos(infos)
+	return nil
+}
+
+// 服务列表和带权重的实例一起更新，GetAll 和 GetAllInfo 不会看到不一致的两份列表
+func (d *FileDiscovery) setInfos(infos []ServerInfo) {
+	servers := make([]string, len(infos))
+	for i, info := range infos {
+		servers[i] = info.Addr
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_ = d.MultiServersDiscovery.Update(servers)
+	d.infos = infos
+}
+
+// 手动更新服务列表，权重为1，文件下一次变化时被覆盖
+func (d *FileDiscovery) Update(servers []string) error {
+	infos := make([]ServerInfo, len(servers))
+	for i, s := range servers {
+		infos[i] = ServerInfo{Addr: s, Weight: 1}
+	}
+	d.setInfos(infos)
+	return nil
+}
+
+// 设置实例的权重，文件下一次变化时被覆盖
+func (d *FileDiscovery) SetWeight(server string, weight int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	infos := make([]ServerInfo, len(d.infos))
+	copy(infos, d.infos)
+	for i := range infos {
+		if infos[i].Addr == server {
+			infos[i].Weight = weight
+		}
+	}
+	d.infos = infos
+}
+
+func (d *FileDiscovery) poll() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			if err := d.Refresh(); err != nil {
+				log.Println("rpc file discovery: reload error:", err)
+			}
+		}
+	}
+}
+
+func (d *FileDiscovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.MultiServersDiscovery.GetAll()
+}
+
+func (d *FileDiscovery) GetAllInfo() ([]ServerInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	infos := make([]ServerInfo, len(d.infos))
+	copy(infos, d.infos)
+	return infos, nil
+}
+
+// 停止监听文件
+func (d *FileDiscovery) Close() error {
+	d.once.Do(func() { close(d.done) })
+	return nil
+}
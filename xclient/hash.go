@@ -0,0 +1,81 @@
+package xclient
+
+import (
+	"context"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * 一致性哈希
+ *
+ * 每个实例在哈希环上放置 replicas 个虚拟节点，key 顺时针找到的第一个虚拟节点对应的实例即为选中的实例
+ * 实例增减时只有少部分 key 会迁移，适合带本地缓存或按 key 分片的服务
+ */
+
+const defaultReplicas = 100
+
+type hashKey struct{}
+
+// 在 ctx 中设置一致性哈希使用的 key，如用户 ID
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+func hashKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKey{}).(string)
+	return key, ok
+}
+
+type hashRing struct {
+	mu       sync.Mutex
+	replicas int
+	members  string            //当前环上的实例，用于判断服务列表是否变化
+	keys     []uint32          //排好序的虚拟节点哈希值
+	nodes    map[uint32]string //虚拟节点 -> 实例
+}
+
+func newHashRing(replicas int) *hashRing {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &hashRing{replicas: replicas}
+}
+
+// 服务列表变化时重建哈希环
+func (h *hashRing) rebuild(servers []string) {
+	sorted := make([]string, len(servers))
+	copy(sorted, servers)
+	sort.Strings(sorted)
+	members := strings.Join(sorted, ",")
+	if members == h.members && h.nodes != nil {
+		return
+	}
+	h.members = members
+	h.keys = h.keys[:0]
+	h.nodes = make(map[uint32]string, len(sorted)*h.replicas)
+	for _, s := range sorted {
+		for i := 0; i < h.replicas; i++ {
+			k := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + s))
+			h.keys = append(h.keys, k)
+			h.nodes[k] = s
+		}
+	}
+	sort.Slice(h.keys, func(i, j int) bool { return h.keys[i] < h.keys[j] })
+}
+
+// 根据 key 在 servers 中选择一个实例
+func (h *hashRing) get(servers []string, key string) (string, error) {
+	if len(servers) == 0 {
+		return "", ErrNoAvailableServers
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rebuild(servers)
+	k := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(h.keys), func(i int) bool { return h.keys[i] >= k })
+	return h.nodes[h.keys[idx%len(h.keys)]], nil
+}
@@ -0,0 +1,143 @@
+package xclient
+
+import (
+	"context"
+	. "geerpc"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+ * 请求对冲
+ *
+ * 第一个请求在一定时间内没有返回时（最近调用延迟的某个百分位，样本不足时使用固定延迟），
+ * 向另一个实例再发一个相同的请求，取先返回的结果并取消另一个，用于降低长尾延迟
+ * 同一个请求可能被执行两次，所以只对 SetIdempotent 标记过的方法生效
+ */
+
+type HedgeOption struct {
+	Percentile float64       //触发对冲的延迟百分位，如 0.95
+	Delay      time.Duration //样本不足时使用的固定延迟
+	MinSamples int           //计算百分位需要的最少样本数，默认 20
+}
+
+const latencyWindow = 256 //参与计算百分位的最近样本数
+
+// 最近成功调用的延迟
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (t *latencyTracker) observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) < latencyWindow {
+		t.samples = append(t.samples, d)
+		return
+	}
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % latencyWindow
+}
+
+func (t *latencyTracker) percentile(p float64, minSamples int) (time.Duration, bool) {
+	t.mu.Lock()
+	sorted := append([]time.Duration(nil), t.samples...)
+	t.mu.Unlock()
+	if len(sorted) < minSamples || len(sorted) == 0 {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p * float64(len(sorted)-1))
+	return sorted[idx], true
+}
+
+// 开启请求对冲，opt 为 nil 时关闭
+func (xc *XClient) SetHedging(opt *HedgeOption) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if opt != nil && opt.MinSamples <= 0 {
+		o := *opt
+		o.MinSamples = 20
+		opt = &o
+	}
+	xc.hedge = opt
+}
+
+// 计算触发对冲的延迟，返回 false 表示不对冲
+func (xc *XClient) hedgeDelay(serviceMethod string) (time.Duration, bool) {
+	xc.mu.Lock()
+	opt := xc.hedge
+	xc.mu.Unlock()
+	if opt == nil || !xc.isIdempotent(serviceMethod) {
+		return 0, false
+	}
+	if d, ok := xc.latency.percentile(opt.Percentile, opt.MinSamples); ok {
+		return d, true
+	}
+	return opt.Delay, opt.Delay > 0
+}
+
+// 一次调用，需要时对冲到另一个实例
+func (xc *XClient) attempt(ctx context.Context, rpcAddr string, serviceMethod string, args, reply interface{}, opts []CallOption) error {
+	delay, ok := xc.hedgeDelay(serviceMethod)
+	if !ok {
+		return xc.timedCall(rpcAddr, ctx, serviceMethod, args, reply, opts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() //返回时取消落后的请求
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	results := make(chan result, 2)
+	launch := func(addr string) {
+		//两个请求各自解码到独立的 reply，胜出者再复制给调用方
+		r := reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+		go func() {
+			results <- result{reply: r, err: xc.timedCall(addr, ctx, serviceMethod, args, r, opts)}
+		}()
+	}
+	launch(rpcAddr)
+	pending := 1
+	timer := xc.clock().NewTimer(delay)
+	defer timer.Stop()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case <-timer.C():
+			if other := xc.pickOther(ctx, serviceMethod, map[string]bool{rpcAddr: true}, false); other != "" {
+				launch(other)
+				pending++
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(r.reply).Elem())
+				return nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		}
+	}
+	return firstErr
+}
+
+// 调用由 Selector 选出的实例，把结果反馈给 Selector 并记录成功调用的延迟
+func (xc *XClient) timedCall(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}, opts []CallOption) error {
+	clock := xc.clock()
+	start := clock.Now()
+	err := xc.call(rpcAddr, ctx, serviceMethod, args, reply, opts...)
+	latency := clock.Now().Sub(start)
+	xc.getSelector().Feedback(rpcAddr, latency, err)
+	if err == nil {
+		xc.latency.observe(latency)
+	}
+	return err
+}
@@ -0,0 +1,343 @@
+package xclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Kubernetes EndpointSlice 服务发现
+ *
+ * 通过 Kubernetes API 监听（list + watch）某个 Service 的 EndpointSlice，把就绪的 Pod 作为服务实例，
+ * Pod 变为 NotReady 或进入 Terminating 时立即从服务列表中移除，不需要 sidecar
+ * 实例的 Meta 中带有 zone 和 node，可用于按区域路由
+ * 只依赖标准库，直接访问 API Server 的 REST 接口，需要 ServiceAccount 有 endpointslices 的 list/watch 权限
+ */
+
+const (
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	k8sServiceNameLabel  = "kubernetes.io/service-name"
+)
+
+type K8sConfig struct {
+	APIServer string       //API Server 地址，如 https://10.0.0.1:443
+	Token     string       //Bearer Token
+	Client    *http.Client //访问 API Server 的客户端，需要配置好 CA
+	Namespace string       //Service 所在的命名空间
+	Service   string       //Service 名称
+	PortName  string       //使用的端口名，为空时使用第一个端口
+	Protocol  string       //实例地址的协议，默认 tcp
+}
+
+// 在 Pod 内运行时，根据 ServiceAccount 和环境变量生成配置
+func InClusterK8sConfig(service, portName string) (*K8sConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("rpc k8s discovery: not running in a kubernetes cluster")
+	}
+	token, err := os.ReadFile(k8sServiceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ns, err := os.ReadFile(k8sServiceAccountDir + "/namespace")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(k8sServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("rpc k8s discovery: invalid ca.crt")
+	}
+	return &K8sConfig{
+		APIServer: "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Client: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		}},
+		Namespace: strings.TrimSpace(string(ns)),
+		Service:   service,
+		PortName:  portName,
+	}, nil
+}
+
+// API 对象中用到的字段
+type k8sEndpointSlice struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready       *bool `json:"ready"`
+			Terminating *bool `json:"terminating"`
+		} `json:"conditions"`
+		NodeName string `json:"nodeName"`
+		Zone     string `json:"zone"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name *string `json:"name"`
+		Port *int32  `json:"port"`
+	} `json:"ports"`
+}
+
+type k8sEndpointSliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []k8sEndpointSlice `json:"items"`
+}
+
+type k8sWatchEvent struct {
+	Type   string          `json:"type"` //ADDED, MODIFIED, DELETED, BOOKMARK, ERROR
+	Object json.RawMessage `json:"object"`
+}
+
+type K8sDiscovery struct {
+	*MultiServersDiscovery
+	cfg    K8sConfig
+	mu     sync.RWMutex
+	slices map[string]*k8sEndpointSlice //EndpointSlice 名称 -> 对象
+	infos  []ServerInfo
+	done   chan struct{}
+	once   sync.Once
+}
+
+var (
+	_ Discovery     = (*K8sDiscovery)(nil)
+	_ InfoDiscovery = (*K8sDiscovery)(nil)
+)
+
+// 首次 list 成功后返回，之后在后台 watch
+func NewK8sDiscovery(cfg K8sConfig) (*K8sDiscovery, error) {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Protocol == "" {
+		cfg.Protocol = "tcp"
+	}
+	d := &K8sDiscovery{
+		MultiServersDiscovery: NewMultiServerDiscovery(make([]string, 0)),
+		cfg:                   cfg,
+		done:                  make(chan struct{}),
+	}
+	rv, err := d.list()
+	if err != nil {
+		return nil, err
+	}
+	go d.watchLoop(rv)
+	return d, nil
+}
+
+func (d *K8sDiscovery) request(ctx context.Context, query url.Values) (*http.Response, error) {
+	u := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s",
+		strings.TrimSuffix(d.cfg.APIServer, "/"), url.PathEscape(d.cfg.Namespace), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.cfg.Token)
+	}
+	resp, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("rpc k8s discovery: api server returned %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// 全量拉取，返回 resourceVersion 用于 watch
+func (d *K8sDiscovery) list() (string, error) {
+	resp, err := d.request(context.Background(), url.Values{"labelSelector": {k8sServiceNameLabel + "=" + d.cfg.Service}})
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var list k8sEndpointSliceList
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	slices := make(map[string]*k8sEndpointSlice, len(list.Items))
+	for i := range list.Items {
+		slices[list.Items[i].Metadata.Name] = &list.Items[i]
+	}
+	d.mu.Lock()
+	d.slices = slices
+	d.mu.Unlock()
+	d.rebuild()
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch 断开后从断开的位置继续，resourceVersion 过期时重新 list
+func (d *K8sDiscovery) watchLoop(rv string) {
+	for {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		next, err := d.watch(rv)
+		if err == nil {
+			rv = next
+			continue
+		}
+		log.Println("rpc k8s discovery: watch error:", err)
+		select {
+		case <-d.done:
+			return
+		case <-time.After(time.Second):
+		}
+		if rv, err = d.list(); err != nil {
+			log.Println("rpc k8s discovery: list error:", err)
+		}
+	}
+}
+
+// 每次 watch 使用自己的 context，返回或者 Close 时取消，断开请求并释放响应
+func (d *K8sDiscovery) watch(rv string) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-d.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	resp, err := d.request(ctx, url.Values{
+		"labelSelector":       {k8sServiceNameLabel + "=" + d.cfg.Service},
+		"watch":               {"true"},
+		"resourceVersion":     {rv},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {"300"},
+	})
+	if err != nil {
+		return rv, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var ev k8sWatchEvent
+		if err = json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return rv, err
+		}
+		if ev.Type == "ERROR" {
+			//一般是 410 Gone，resourceVersion 过期
+			return rv, fmt.Errorf("rpc k8s discovery: watch event error: %s", ev.Object)
+		}
+		var slice k8sEndpointSlice
+		if err = json.Unmarshal(ev.Object, &slice); err != nil {
+			return rv, err
+		}
+		rv = slice.Metadata.ResourceVersion
+		if ev.Type == "BOOKMARK" {
+			continue
+		}
+		d.mu.Lock()
+		if ev.Type == "DELETED" {
+			delete(d.slices, slice.Metadata.Name)
+		} else {
+			d.slices[slice.Metadata.Name] = &slice
+		}
+		d.mu.Unlock()
+		d.rebuild()
+	}
+	return rv, sc.Err()
+}
+
+// 根据所有 EndpointSlice 重新计算就绪的实例
+func (d *K8sDiscovery) rebuild() {
+	d.mu.Lock()
+	seen := make(map[string]bool)
+	var infos []ServerInfo
+	for _, slice := range d.slices {
+		port, ok := d.port(slice)
+		if !ok {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			//ready 为空表示就绪；Terminating 的 Pod 不再接收新请求
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if ep.Conditions.Terminating != nil && *ep.Conditions.Terminating {
+				continue
+			}
+			for _, ip := range ep.Addresses {
+				addr := d.cfg.Protocol + "@" + net.JoinHostPort(ip, strconv.Itoa(int(port)))
+				if seen[addr] {
+					continue
+				}
+				seen[addr] = true
+				infos = append(infos, ServerInfo{
+					Addr:   addr,
+					Weight: 1,
+					Meta:   map[string]string{"zone": ep.Zone, "node": ep.NodeName},
+				})
+			}
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Addr < infos[j].Addr })
+	d.infos = infos
+	d.mu.Unlock()
+
+	servers := make([]string, len(infos))
+	for i, info := range infos {
+		servers[i] = info.Addr
+	}
+	_ = d.MultiServersDiscovery.Update(servers)
+}
+
+func (d *K8sDiscovery) port(slice *k8sEndpointSlice) (int32, bool) {
+	for _, p := range slice.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if d.cfg.PortName == "" || (p.Name != nil && *p.Name == d.cfg.PortName) {
+			return *p.Port, true
+		}
+	}
+	return 0, false
+}
+
+// 服务列表由 watch 实时更新，不需要主动刷新
+func (d *K8sDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *K8sDiscovery) GetAllInfo() ([]ServerInfo, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	infos := make([]ServerInfo, len(d.infos))
+	copy(infos, d.infos)
+	return infos, nil
+}
+
+// 停止 watch
+func (d *K8sDiscovery) Close() error {
+	d.once.Do(func() { close(d.done) })
+	return nil
+}
@@ -0,0 +1,160 @@
+package xclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+ * 基于 registry 包 HTTP 注册中心的服务发现
+ *
+ * 定期从注册中心拉取可用实例，同时得到实例的权重和元数据
+ * 请求注册中心有超时时间（默认 5s，可以通过 SetHTTPClient 修改），拉取失败时继续使用上一次的实例列表，
+ * 按指数退避（最长为过期时间）再重试，注册中心不可用时不会每次调用都去请求；没有拉取成功过时返回错误
+ */
+
+type GeeRegistryDiscovery struct {
+	*MultiServersDiscovery
+	registry string
+	timeout  time.Duration //服务列表的过期时间，过期后重新拉取
+	client   *http.Client  //请求注册中心的客户端
+	mu       sync.Mutex    //保护以下字段，同一时间只有一个拉取
+	infos    []ServerInfo
+	next     time.Time //下次拉取的时间
+	failures int       //连续拉取失败的次数
+	lastErr  error     //上一次拉取的错误，成功时为nil
+}
+
+const defaultUpdateTimeout = time.Second * 10
+
+// 请求注册中心的默认超时时间
+const defaultRegistryRequestTimeout = 5 * time.Second
+
+// 拉取失败后第一次重试的间隔，之后每次失败翻倍，最长为过期时间
+const minRegistryRetryInterval = time.Second
+
+func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration) *GeeRegistryDiscovery {
+	if timeout == 0 {
+		timeout = defaultUpdateTimeout
+	}
+	return &GeeRegistryDiscovery{
+		MultiServersDiscovery: NewMultiServerDiscovery(make([]string, 0)),
+		registry:              registerAddr,
+		timeout:               timeout,
+		client:                &http.Client{Timeout: defaultRegistryRequestTimeout},
+	}
+}
+
+var _ InfoDiscovery = (*GeeRegistryDiscovery)(nil)
+
+// 设置请求注册中心的客户端，需要设置 Timeout，为nil时使用默认的客户端
+func (d *GeeRegistryDiscovery) SetHTTPClient(c *http.Client) {
+	if c == nil {
+		c = &http.Client{Timeout: defaultRegistryRequestTimeout}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.client = c
+}
+
+func (d *GeeRegistryDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.infos = make([]ServerInfo, len(servers))
+	for i, s := range servers {
+		d.infos[i] = ServerInfo{Addr: s, Weight: 1}
+	}
+	d.next, d.failures, d.lastErr = time.Now().Add(d.timeout), 0, nil
+	return d.MultiServersDiscovery.Update(servers)
+}
+
+// 到了拉取的时间就重新拉取，失败时保留上一次的结果；还没到重试时间时返回上一次的错误
+func (d *GeeRegistryDiscovery) Refresh() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if now.Before(d.next) {
+		return d.lastErr
+	}
+	log.Println("rpc registry: refresh servers from registry", d.registry)
+	if d.lastErr = d.fetch(); d.lastErr != nil {
+		log.Println("rpc registry refresh err:", d.lastErr)
+		backoff := minRegistryRetryInterval << d.failures
+		if backoff <= 0 || backoff > d.timeout {
+			backoff = d.timeout
+		} else {
+			d.failures++
+		}
+		d.next = now.Add(backoff)
+		return d.lastErr
+	}
+	d.failures = 0
+	d.next = now.Add(d.timeout)
+	return nil
+}
+
+// 拉取实例列表，调用时需要持有 mu
+func (d *GeeRegistryDiscovery) fetch() error {
+	resp, err := d.client.Get(d.registry)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc registry: registry returned %s", resp.Status)
+	}
+	var infos []ServerInfo
+	if err = json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return err
+	}
+	servers := make([]string, len(infos))
+	for i, info := range infos {
+		servers[i] = info.Addr
+		d.MultiServersDiscovery.SetWeight(info.Addr, info.Weight)
+	}
+	d.infos = infos
+	return d.MultiServersDiscovery.Update(servers)
+}
+
+// 拉取失败但已经有实例列表时使用上一次的结果
+func (d *GeeRegistryDiscovery) refreshForCall() error {
+	err := d.Refresh()
+	if err != nil && !d.empty() {
+		return nil
+	}
+	return err
+}
+
+func (d *GeeRegistryDiscovery) empty() bool {
+	servers, _ := d.MultiServersDiscovery.GetAll()
+	return len(servers) == 0
+}
+
+func (d *GeeRegistryDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.refreshForCall(); err != nil {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+func (d *GeeRegistryDiscovery) GetAll() ([]string, error) {
+	if err := d.refreshForCall(); err != nil {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
+
+func (d *GeeRegistryDiscovery) GetAllInfo() ([]ServerInfo, error) {
+	if err := d.refreshForCall(); err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	infos := make([]ServerInfo, len(d.infos))
+	copy(infos, d.infos)
+	return infos, nil
+}
@@ -0,0 +1,122 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * 选择器
+ *
+ * XClient 通过 Selector 在候选实例中选择一个发起调用，调用结束后把延迟和错误反馈给它
+ * 内置的负载均衡策略都实现了 Selector，通过 NewSelector 按 SelectMode 创建；
+ * 需要按分片表、租户等自定义路由时实现自己的 Selector：
+ *   xc := xclient.NewXClient(d, xclient.RandomSelect, nil)
+ *   xc.SetSelector(&shardSelector{shards: m})
+ * servers 是经过按区域路由等筛选后的候选实例，不为空；Pick 可能被并发调用
+ * 每次 Pick 成功后 XClient 都会发起一次调用，并以同样的地址调用 Feedback；
+ * 只有 Pick 选出的调用才会 Feedback，Broadcast 不经过 Selector，也不会调用 Feedback
+ */
+
+type Selector interface {
+	Pick(ctx context.Context, method string, servers []ServerInfo) (ServerInfo, error)
+	Feedback(addr string, latency time.Duration, err error)
+}
+
+// 返回 mode 对应的内置选择器
+func NewSelector(mode SelectMode) Selector {
+	switch mode {
+	case RandomSelect:
+		return &randomSelector{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	case RoundRobinSelect:
+		return &roundRobinSelector{next: uint64(rand.Int())}
+	case ConsistentHashSelect:
+		return newHashRing(defaultReplicas)
+	case WeightedRoundRobinSelect:
+		return newWeightedRR()
+	case LeastLoadedSelect:
+		return newLoadStats()
+	}
+	return unsupportedSelector{}
+}
+
+type randomSelector struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (s *randomSelector) Pick(_ context.Context, _ string, servers []ServerInfo) (ServerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return servers[s.r.Intn(len(servers))], nil
+}
+
+func (s *randomSelector) Feedback(string, time.Duration, error) {}
+
+type roundRobinSelector struct {
+	next uint64 //原子操作
+}
+
+func (s *roundRobinSelector) Pick(_ context.Context, _ string, servers []ServerInfo) (ServerInfo, error) {
+	return servers[(atomic.AddUint64(&s.next, 1)-1)%uint64(len(servers))], nil
+}
+
+func (s *roundRobinSelector) Feedback(string, time.Duration, error) {}
+
+// 一致性哈希，key 通过 WithHashKey 在 ctx 中设置
+func (h *hashRing) Pick(ctx context.Context, _ string, servers []ServerInfo) (ServerInfo, error) {
+	key, ok := hashKeyFrom(ctx)
+	if !ok {
+		return ServerInfo{}, ErrNoHashKey
+	}
+	addrs := make([]string, len(servers))
+	for i, s := range servers {
+		addrs[i] = s.Addr
+	}
+	addr, err := h.get(addrs, key)
+	return infoOf(servers, addr), err
+}
+
+func (h *hashRing) Feedback(string, time.Duration, error) {}
+
+func (w *weightedRR) Pick(_ context.Context, _ string, servers []ServerInfo) (ServerInfo, error) {
+	addr, err := w.pick(servers)
+	return infoOf(servers, addr), err
+}
+
+func (w *weightedRR) Feedback(string, time.Duration, error) {}
+
+// 选中时计入在途请求，Feedback 时记录延迟和错误
+func (l *loadStats) Pick(_ context.Context, _ string, servers []ServerInfo) (ServerInfo, error) {
+	addr, err := l.pick(servers)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	l.start(addr)
+	return infoOf(servers, addr), nil
+}
+
+func (l *loadStats) Feedback(addr string, latency time.Duration, err error) {
+	l.done(addr, latency, err)
+}
+
+type unsupportedSelector struct{}
+
+func (unsupportedSelector) Pick(context.Context, string, []ServerInfo) (ServerInfo, error) {
+	return ServerInfo{}, errors.New("rpc discovery: not supported select mode")
+}
+
+func (unsupportedSelector) Feedback(string, time.Duration, error) {}
+
+func infoOf(servers []ServerInfo, addr string) ServerInfo {
+	for _, s := range servers {
+		if s.Addr == addr {
+			return s
+		}
+	}
+	return ServerInfo{Addr: addr}
+}
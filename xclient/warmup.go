@@ -0,0 +1,184 @@
+package xclient
+
+import (
+	"context"
+	. "geerpc"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * 新实例预热
+ *
+ * 服务发现新增实例后，先在后台建立连接并探测，通过后才开始分配流量，
+ * 之后在 SlowStart 时间内流量逐渐增加到正常水平，避免冷缓存导致的延迟尖刺和大量客户端同时建立连接：
+ *   xc.SetWarmup(&xclient.WarmupOption{
+ *       Probe: func(ctx context.Context, c *geerpc.Client) error {
+ *           var ok bool
+ *           return c.CallContext(ctx, "Health.Check", struct{}{}, &ok)
+ *       },
+ *       SlowStart: 30 * time.Second,
+ *   })
+ * 开启时已经存在的实例认为已经预热好；探测失败时每隔 RetryInterval 重试，直到实例从服务发现中移除
+ * 渐进期内的实例按已经过去的时间比例随机参与选择，与使用哪种 Selector 无关
+ * 没有预热好的实例时使用所有实例，不会因为预热导致调用失败
+ */
+
+type WarmupOption struct {
+	Probe         func(ctx context.Context, client *Client) error //连接建立后的探测，为nil时只建立连接
+	ProbeTimeout  time.Duration                                   //单次探测的超时时间，0表示默认的 5s
+	RetryInterval time.Duration                                   //探测失败后重试的间隔，0表示默认的 1s
+	SlowStart     time.Duration                                   //探测通过后流量增加到正常水平的时间，0表示不渐进
+}
+
+const minSlowStartShare = 0.05 //渐进期开始时参与选择的概率
+
+type warmer struct {
+	opt      WarmupOption
+	mu       sync.Mutex //保护以下字段
+	r        *rand.Rand
+	backends map[string]*backendState
+	seeded   bool //已经记录过开启时的实例
+}
+
+type backendState struct {
+	ready time.Time     //探测通过的时间，为零值时还在预热
+	stop  chan struct{} //实例被移除时关闭
+}
+
+// 开启新实例预热，opt 为nil时关闭
+func (xc *XClient) SetWarmup(opt *WarmupOption) {
+	var w *warmer
+	if opt != nil {
+		o := *opt
+		if o.ProbeTimeout <= 0 {
+			o.ProbeTimeout = 5 * time.Second
+		}
+		if o.RetryInterval <= 0 {
+			o.RetryInterval = time.Second
+		}
+		w = &warmer{
+			opt:      o,
+			r:        rand.New(rand.NewSource(time.Now().UnixNano())),
+			backends: make(map[string]*backendState),
+		}
+	}
+	xc.mu.Lock()
+	old := xc.warmup
+	xc.warmup = w
+	xc.mu.Unlock()
+	old.stopAll()
+}
+
+func (xc *XClient) warmupOption() *warmer {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return xc.warmup
+}
+
+// 记录实例的变化，返回可以分配流量的实例
+func (xc *XClient) warm(w *warmer, infos []ServerInfo) []ServerInfo {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seen := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		seen[info.Addr] = true
+		if _, ok := w.backends[info.Addr]; ok {
+			continue
+		}
+		st := &backendState{stop: make(chan struct{})}
+		if w.seeded {
+			go xc.warmBackend(w, info.Addr, st)
+		} else {
+			st.ready = now.Add(-w.opt.SlowStart)
+		}
+		w.backends[info.Addr] = st
+	}
+	w.seeded = true
+	for addr, st := range w.backends {
+		if !seen[addr] {
+			close(st.stop)
+			delete(w.backends, addr)
+		}
+	}
+
+	var out []ServerInfo
+	for _, info := range infos {
+		st := w.backends[info.Addr]
+		if st.ready.IsZero() {
+			continue
+		}
+		if elapsed := now.Sub(st.ready); elapsed < w.opt.SlowStart {
+			share := float64(elapsed) / float64(w.opt.SlowStart)
+			if share < minSlowStartShare {
+				share = minSlowStartShare
+			}
+			if w.r.Float64() >= share {
+				continue
+			}
+		}
+		out = append(out, info)
+	}
+	if len(out) == 0 {
+		return infos
+	}
+	return out
+}
+
+// 建立连接并探测，直到通过或实例被移除
+func (xc *XClient) warmBackend(w *warmer, addr string, st *backendState) {
+	for {
+		err := xc.probe(w, addr)
+		if err == nil {
+			w.mu.Lock()
+			st.ready = time.Now()
+			w.mu.Unlock()
+			return
+		}
+		t := time.NewTimer(w.opt.RetryInterval)
+		select {
+		case <-st.stop:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+/**
+ * 用单独建立的连接探测，不持有 mu，也不放入缓存：不可用的实例反复重试不会影响其他调用，
+ * 探测通过后连接才放入缓存，之后分配到这个实例的调用直接使用
+ */
+func (xc *XClient) probe(w *warmer, addr string) error {
+	client, err := XDial(addr, xc.opt)
+	if err != nil {
+		return err
+	}
+	if w.opt.Probe != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), w.opt.ProbeTimeout)
+		err = w.opt.Probe(ctx, client)
+		cancel()
+		if err != nil {
+			_ = client.Close()
+			return err
+		}
+	}
+	xc.adopt(addr, client)
+	return nil
+}
+
+// 停止所有预热
+func (w *warmer) stopAll() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for addr, st := range w.backends {
+		close(st.stop)
+		delete(w.backends, addr)
+	}
+	w.seeded = false
+}
@@ -0,0 +1,312 @@
+package xclient
+
+import (
+	"context"
+	"errors"
+	. "geerpc"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+/**
+ * 支持负载均衡的客户端
+ *
+ * 通过 Discovery 得到服务实例，由 Selector 选择一个实例调用（默认是 SelectMode 对应的内置策略），
+ * 每个实例的 Client 会被缓存复用，不可用时重新建立连接
+ */
+type XClient struct {
+	d       Discovery
+	opt     *Option
+	load    *loadStats //各个实例的观测数据，用于按区域路由时判断健康
+	mu      sync.Mutex //保护以下字段
+	clients map[string]*Client
+	dialing map[string]*dialCall //正在建立的连接，每个地址同时只有一个
+	//负载均衡
+	selector Selector
+	//失败处理
+	failMode   FailMode
+	retries    int
+	idempotent map[string]bool
+	//请求对冲
+	hedge   *HedgeOption
+	latency latencyTracker
+	//按区域路由
+	zone *ZoneOption
+	//新实例预热，为nil时不开启
+	warmup *warmer
+	//响应缓存和调用合并，为nil时不开启
+	cache    atomic.Pointer[ResponseCache]
+	coalesce atomic.Pointer[Coalescer]
+}
+
+var _ io.Closer = (*XClient)(nil)
+
+// 一致性哈希模式下调用没有设置 key
+var ErrNoHashKey = errors.New("rpc xclient: consistent hash select requires a key, use WithHashKey")
+
+func NewXClient(d Discovery, mode SelectMode, opt *Option) *XClient {
+	return &XClient{
+		d:        d,
+		opt:      opt,
+		load:     newLoadStats(),
+		clients:  make(map[string]*Client),
+		dialing:  make(map[string]*dialCall),
+		selector: NewSelector(mode),
+		//默认失败直接返回
+		failMode:   Failfast,
+		idempotent: make(map[string]bool),
+	}
+}
+
+// 重试等待、请求对冲和延迟统计的时间源，即 opt 中的 Clock
+func (xc *XClient) clock() Clock {
+	if xc.opt == nil || xc.opt.Clock == nil {
+		return RealClock
+	}
+	return xc.opt.Clock
+}
+
+func (xc *XClient) Close() error {
+	xc.warmupOption().stopAll()
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for key, client := range xc.clients {
+		_ = client.Close()
+		delete(xc.clients, key)
+	}
+	return nil
+}
+
+// 一次建立连接，同一个地址的其他调用等待它的结果
+type dialCall struct {
+	done   chan struct{}
+	client *Client
+	err    error
+}
+
+/**
+ * 复用已有的连接，不可用时重新建立
+ * 建立连接时不持有 mu，一个很慢或者不响应的实例不会阻塞其他实例的调用；
+ * 同一个地址同时只建立一个连接，其他调用等待它的结果
+ */
+func (xc *XClient) dial(rpcAddr string) (*Client, error) {
+	xc.mu.Lock()
+	client, stale := xc.cached(rpcAddr)
+	if client != nil {
+		xc.mu.Unlock()
+		return client, nil
+	}
+	dc, ok := xc.dialing[rpcAddr]
+	if !ok {
+		dc = &dialCall{done: make(chan struct{})}
+		xc.dialing[rpcAddr] = dc
+	}
+	xc.mu.Unlock()
+	if stale != nil {
+		_ = stale.Close()
+	}
+	if ok {
+		<-dc.done
+		return dc.client, dc.err
+	}
+
+	client, err := XDial(rpcAddr, xc.opt)
+	xc.mu.Lock()
+	delete(xc.dialing, rpcAddr)
+	xc.mu.Unlock()
+	if err == nil {
+		client = xc.adopt(rpcAddr, client)
+	}
+	dc.client, dc.err = client, err
+	close(dc.done)
+	return client, err
+}
+
+// 缓存中可用的连接；不可用的连接从缓存中移除并返回，由调用方在锁外关闭。调用时需要持有 mu
+func (xc *XClient) cached(rpcAddr string) (client, stale *Client) {
+	client, ok := xc.clients[rpcAddr]
+	if !ok {
+		return nil, nil
+	}
+	if client.IsAvailable() {
+		return client, nil
+	}
+	delete(xc.clients, rpcAddr)
+	return nil, client
+}
+
+// 把新建立的连接放入缓存；已经有可用的连接时关闭新的连接，返回缓存中的连接
+func (xc *XClient) adopt(rpcAddr string, client *Client) *Client {
+	xc.mu.Lock()
+	existing, stale := xc.cached(rpcAddr)
+	if existing == nil {
+		xc.clients[rpcAddr] = client
+	}
+	xc.mu.Unlock()
+	if stale != nil {
+		_ = stale.Close()
+	}
+	if existing != nil {
+		_ = client.Close()
+		return existing
+	}
+	return client
+}
+
+func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	xc.load.start(rpcAddr)
+	clock := xc.clock()
+	start := clock.Now()
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		err = &dialError{err: err}
+	} else {
+		err = client.CallContext(ctx, serviceMethod, args, reply, opts...)
+	}
+	latency := clock.Now().Sub(start)
+	xc.load.done(rpcAddr, latency, err)
+	return err
+}
+
+// 替换负载均衡策略，s 为nil时不做修改
+func (xc *XClient) SetSelector(s Selector) {
+	if s == nil {
+		return
+	}
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.selector = s
+}
+
+func (xc *XClient) getSelector() Selector {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return xc.selector
+}
+
+// 候选实例，开启了预热和按区域路由时先筛选
+func (xc *XClient) candidates() ([]ServerInfo, error) {
+	infos, err := getAllInfo(xc.d)
+	if err != nil {
+		return nil, err
+	}
+	if w := xc.warmupOption(); w != nil {
+		infos = xc.warm(w, infos)
+	}
+	if zone := xc.zoneOption(); zone != nil {
+		infos = xc.localize(zone, infos)
+	}
+	if len(infos) == 0 {
+		return nil, ErrNoAvailableServers
+	}
+	return infos, nil
+}
+
+// 按负载均衡策略选择实例
+func (xc *XClient) pick(ctx context.Context, serviceMethod string) (string, error) {
+	infos, err := xc.candidates()
+	if err != nil {
+		return "", err
+	}
+	info, err := xc.getSelector().Pick(ctx, serviceMethod, infos)
+	return info.Addr, err
+}
+
+/**
+ * 调用一个合适的实例，一致性哈希模式下需要通过 WithHashKey 在 ctx 中设置 key
+ * 失败后按照失败处理策略重试，opts 应用于每一次尝试（如 WithTimeout 是单次尝试的超时时间）
+ */
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}, opts ...CallOption) error {
+	call := func() error {
+		return xc.callWithRetry(ctx, serviceMethod, args, reply, opts)
+	}
+	if g := xc.coalesce.Load(); g != nil {
+		next := call
+		call = func() error { return g.Do(ctx, serviceMethod, args, reply, opts, next) }
+	}
+	if cache := xc.cache.Load(); cache != nil {
+		return cache.Do(ctx, serviceMethod, args, reply, opts, call)
+	}
+	return call()
+}
+
+func (xc *XClient) callWithRetry(ctx context.Context, serviceMethod string, args, reply interface{}, opts []CallOption) error {
+	mode := xc.failModeFrom(ctx)
+	xc.mu.Lock()
+	retries := xc.retries
+	xc.mu.Unlock()
+
+	rpcAddr, err := xc.pick(ctx, serviceMethod)
+	if err != nil {
+		return err
+	}
+	tried := map[string]bool{rpcAddr: true}
+	for attempt := 0; ; attempt++ {
+		err = xc.attempt(ctx, rpcAddr, serviceMethod, args, reply, opts)
+		if err == nil || mode == Failfast || attempt >= retries || !xc.retryable(ctx, serviceMethod, err) {
+			return err
+		}
+		if mode == Failover {
+			other := xc.pickOther(ctx, serviceMethod, tried, true)
+			if other == "" {
+				return err
+			}
+			rpcAddr = other
+			tried[rpcAddr] = true
+		} else if !waitRetryAfter(ctx, xc.clock(), err) {
+			return err
+		}
+	}
+}
+
+/*
+在没有尝试过的实例中选择一个；都尝试过时 allowTried 为 true 则在所有实例中选择，否则返回空字符串
+选择失败时返回空字符串
+*/
+func (xc *XClient) pickOther(ctx context.Context, serviceMethod string, tried map[string]bool, allowTried bool) string {
+	infos, err := xc.candidates()
+	if err != nil {
+		return ""
+	}
+	var untried []ServerInfo
+	for _, info := range infos {
+		if !tried[info.Addr] {
+			untried = append(untried, info)
+		}
+	}
+	if len(untried) == 0 {
+		if !allowTried {
+			return ""
+		}
+		untried = infos
+	}
+	info, err := xc.getSelector().Pick(ctx, serviceMethod, untried)
+	if err != nil {
+		return ""
+	}
+	return info.Addr
+}
+
+// 开启响应缓存，用法与 Client.SetCache 相同，缓存在所有实例之间共享；opt 为nil时关闭
+func (xc *XClient) SetCache(opt *CacheOption) {
+	if opt == nil {
+		xc.cache.Store(nil)
+		return
+	}
+	xc.cache.Store(NewResponseCache(*opt))
+}
+
+// 当前的响应缓存，没有开启时为nil
+func (xc *XClient) Cache() *ResponseCache {
+	return xc.cache.Load()
+}
+
+// 合并 serviceMethods 中方法的并发调用，用法与 Client.SetCoalesce 相同，不传参数时关闭
+func (xc *XClient) SetCoalesce(serviceMethods ...string) {
+	if len(serviceMethods) == 0 {
+		xc.coalesce.Store(nil)
+		return
+	}
+	xc.coalesce.Store(NewCoalescer(serviceMethods...))
+}
@@ -0,0 +1,63 @@
+package xclient
+
+/**
+ * 按区域路由
+ *
+ * 实例的元数据中带有 zone（注册中心、Kubernetes 服务发现都会填入），设置了本地区域后，
+ * 只在同区域的健康实例中由 Selector 选择，减少跨可用区的延迟和流量费用；
+ * 同区域健康实例少于 MinHealthy 时溢出到所有区域的健康实例，全部不健康时退回到所有实例
+ * 实例是否健康根据最近调用的错误率判断，从未调用过的实例认为是健康的
+ */
+
+// 元数据中区域的键
+const ZoneMetaKey = "zone"
+
+type ZoneOption struct {
+	Zone       string  //本地区域，如 us-east-1a
+	MinHealthy int     //同区域至少有这么多健康实例时才只用同区域，默认为1
+	MaxErrRate float64 //错误率超过该值的实例认为不健康，默认为0.5
+}
+
+// 开启按区域路由，zone 为空时关闭
+func (xc *XClient) SetZone(opt ZoneOption) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if opt.Zone == "" {
+		xc.zone = nil
+		return
+	}
+	if opt.MinHealthy <= 0 {
+		opt.MinHealthy = 1
+	}
+	if opt.MaxErrRate <= 0 {
+		opt.MaxErrRate = 0.5
+	}
+	xc.zone = &opt
+}
+
+func (xc *XClient) zoneOption() *ZoneOption {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	return xc.zone
+}
+
+// 筛选出本次选择的候选实例
+func (xc *XClient) localize(opt *ZoneOption, infos []ServerInfo) []ServerInfo {
+	var local, healthy []ServerInfo
+	for _, info := range infos {
+		if !xc.load.healthy(info.Addr, opt.MaxErrRate) {
+			continue
+		}
+		healthy = append(healthy, info)
+		if info.Meta[ZoneMetaKey] == opt.Zone {
+			local = append(local, info)
+		}
+	}
+	switch {
+	case len(local) >= opt.MinHealthy:
+		return local
+	case len(healthy) > 0:
+		return healthy
+	}
+	return infos
+}